@@ -9,7 +9,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,7 +18,14 @@ import (
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/fsnotify/fsnotify"
 	"github.com/highperformance-tech/ts-olly/cmd/ts-olly/process"
+	"github.com/highperformance-tech/ts-olly/internal/checkpoint"
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
+	"github.com/highperformance-tech/ts-olly/internal/matcher"
+	"github.com/highperformance-tech/ts-olly/internal/multiline"
 	"github.com/highperformance-tech/ts-olly/internal/pipeline"
+	"github.com/highperformance-tech/ts-olly/internal/poller"
+	"github.com/highperformance-tech/ts-olly/internal/startpos"
+	"github.com/highperformance-tech/ts-olly/internal/timestamp"
 	"github.com/nxadm/tail"
 )
 
@@ -37,7 +44,9 @@ type tailedFile struct {
 	processName string
 	processId   uint8
 	component   string
-	logFormat   string
+	format      logformat.Format
+	device      uint64
+	lineOffset  int
 }
 
 type line struct {
@@ -47,6 +56,11 @@ type line struct {
 	processName string
 	processId   uint8
 	component   string
+	timestamp   time.Time           // when the entry was written, according to the entry itself
+	level       string              // the entry's level, according to its format's level group
+	leveled     bool                // whether the entry's format has a level group, which alone gives its level
+	envelope    *logformat.Envelope // the entry's native JSON envelope, if it was written in one
+	ack         func()              // called once every sink has accepted the line
 }
 
 func (l line) String() string {
@@ -54,6 +68,12 @@ func (l line) String() string {
 }
 
 func (l line) Level() string {
+	if l.level != "" || l.leveled {
+		return l.level
+	}
+	if l.envelope != nil {
+		return l.envelope.Level
+	}
 	return getLevel(l.Text)
 }
 
@@ -97,6 +117,8 @@ func (app *application) logs(ctx context.Context) <-chan line {
 	go app.watchConfigDir(ctx, configWatcher, pendingFiles, retryFileCh)
 
 	// Recursively watch the data directory and inventory its files
+	seen := make(map[uint64]bool)
+	var backlog []event
 	walkDirFunc := func(path string, d fs.DirEntry, err error) error {
 		path = filepath.Clean(filepath.Join(app.config.logsDir, string(filepath.Separator), path))
 		if err != nil {
@@ -110,9 +132,15 @@ func (app *application) logs(ctx context.Context) <-chan line {
 		if err != nil {
 			return fmt.Errorf("get file id for %s: %w", path, err)
 		}
-		seekInfoCache.Store(fid, &tail.SeekInfo{Offset: fileInfo.Size(), Whence: io.SeekStart})
+		seen[uint64(fid)] = true
 		if d.IsDir() {
-			return w.Add(path)
+			seekInfoCache.Store(fid, &tail.SeekInfo{Offset: fileInfo.Size(), Whence: io.SeekStart})
+			app.watch(w, path)
+			return nil
+		}
+		if app.inventoryFile(path, fid, fileInfo, seekInfoCache) {
+			// There's existing content to read, so don't wait for the file to be written to
+			backlog = append(backlog, event{fsnotify.Event{Name: path, Op: fsnotify.Create}, fid})
 		}
 		return nil
 	}
@@ -121,9 +149,41 @@ func (app *application) logs(ctx context.Context) <-chan line {
 		app.logger.Fatal().Str("component", "logprocessor").Err(err)
 	}
 
+	// Forget checkpoints for files that no longer exist
+	for _, cp := range app.checkpoints.All() {
+		if !seen[cp.FileID] {
+			app.checkpoints.Delete(cp.FileID)
+		}
+	}
+
 	// Capture the fileId for each event
 	eventsCounter := metrics.NewCounter("tslogs_events_total")
-	events := pipeline.TransformerFunc(ctx, w.Events, addFileId(eventsCounter))
+	watchedEvents := pipeline.TransformerFunc(ctx, w.Events, addFileId(eventsCounter))
+
+	// Poll the directories whose changes aren't notified, and the whole logs directory if none are
+	pollEventsCounter := metrics.NewCounter("tslogs_poll_events_total")
+	polledEvents := pipeline.TransformerFunc(ctx, app.poller.Run(ctx, app.settings.GetDuration("polling.interval")), addFileId(pollEventsCounter))
+	if app.settings.GetBool("polling.auto") {
+		go app.pollUnnotified(ctx, tailing, eventsCounter)
+	}
+
+	// Feed files with existing content to read alongside the watcher's events
+	existingFiles := make(chan event)
+	go func(ctx context.Context, backlog []event) {
+		defer close(existingFiles)
+		for _, e := range backlog {
+			select {
+			case <-ctx.Done():
+				return
+			case existingFiles <- e:
+			}
+		}
+	}(ctx, backlog)
+	// Rescan the logs directory after the watcher loses events
+	rescannedEvents := make(chan event)
+	go app.watchErrors(ctx, w, rescannedEvents)
+
+	events := pipeline.Merge(ctx, watchedEvents, polledEvents, existingFiles, rescannedEvents)
 
 	// Filter the events to just the actionable ones
 	actionableEventsCounter := metrics.NewCounter("tslogs_actionable_events_total")
@@ -170,8 +230,10 @@ func addFileId(counter *metrics.Counter) func(context.Context, fsnotify.Event) e
 }
 
 func filterActionableEvents(app *application, tailing *sync.Map, counter *metrics.Counter) func(context.Context, event) bool {
-	skipFiles := app.config.skipFiles
 	return func(ctx context.Context, e event) bool {
+		if e.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+			app.files.Delete(logsPath(e.Name, app.config.logsDir))
+		}
 		if _, ok := tailing.Load(e.fileId); ok {
 			return false
 		}
@@ -188,10 +250,8 @@ func filterActionableEvents(app *application, tailing *sync.Map, counter *metric
 			// Neither a directory nor a regular file, so not actionable
 			return false
 		}
-		for _, skipFile := range skipFiles {
-			if strings.Contains(e.Name, skipFile) {
-				return false
-			}
+		if !fileInfo.IsDir() && !app.includeFile(e.Name, fileInfo) {
+			return false
 		}
 		counter.Inc()
 		return true
@@ -212,10 +272,7 @@ func separateFilesAndDirs(_ context.Context, e event) bool {
 func handleDirs(app *application, w *fsnotify.Watcher, counter *metrics.Counter) func(event) []event {
 	return func(e event) []event {
 		counter.Inc()
-		if err := w.Add(e.Name); err != nil {
-			app.logger.Warn().Err(err).Str("directory", e.Name).Msg("failed to add directory to watcher")
-			return nil
-		}
+		app.watch(w, e.Name)
 
 		// Scan directory for existing files and return synthetic events
 		entries, err := os.ReadDir(e.Name)
@@ -230,6 +287,10 @@ func handleDirs(app *application, w *fsnotify.Watcher, counter *metrics.Counter)
 				continue // Only handle files; nested dirs will get their own events
 			}
 			filePath := filepath.Join(e.Name, entry.Name())
+			fileInfo, err := entry.Info()
+			if err != nil || !fileInfo.Mode().IsRegular() || !app.includeFile(filePath, fileInfo) {
+				continue
+			}
 			fid, err := getFileId(filePath)
 			if err != nil {
 				app.logger.Debug().Err(err).Str("file", filePath).Msg("failed to get file ID")
@@ -249,14 +310,25 @@ func handleFiles(app *application, tailing *sync.Map, seekInfoCache *sync.Map, p
 		if _, ok := tailing.Load(e.fileId); ok { // If we're already tailing this file, skip this event
 			return tailedFile{}
 		}
-		seekInfo, ok := seekInfoCache.Load(e.fileId) // Load the seekInfo from the cache
-		if !ok {                                     // If it's not in the cache, it's a new file
+		device, err := getDevice(e.Name)
+		if err != nil {
+			app.logger.Err(err).Str("filename", e.Name).Int64("fileid", int64(e.fileId)).Msg("could not get device of file. skipping")
+			return tailedFile{}
+		}
+		var lineOffset int
+		// A checkpoint from this or a previous run takes precedence over the cached seekInfo
+		seekInfo, ok := seekInfoCache.Load(e.fileId)
+		if cp, found := checkpointFor(app.checkpoints, e, device); found {
+			seekInfo = &tail.SeekInfo{Offset: cp.Offset, Whence: io.SeekStart}
+			lineOffset = cp.Line
+		} else if !ok { // If it's not in the cache, it's a new file
 			seekInfo = &tail.SeekInfo{Offset: 0, Whence: io.SeekStart} // so we'll tail from the beginning
 			seekInfoCache.Store(e.fileId, seekInfo)                    // and store the seekInfo in the cache
 		}
 		c := tail.Config{
 			Location: seekInfo.(*tail.SeekInfo),
 			Follow:   true,
+			Poll:     app.poller.Polls(e.Name),
 			Logger:   tail.DiscardingLogger,
 		}
 		t, err := tail.TailFile(e.Name, c)
@@ -294,14 +366,86 @@ func handleFiles(app *application, tailing *sync.Map, seekInfoCache *sync.Map, p
 				Msg("could not get process instance. skipping")
 			return tailedFile{}
 		}
-		logFormat := instance.GetLogFormat(e.Name)
+		format := withLevels(instance.GetLogFormat(e.Name), app.settings.GetStringMapString("levels."+processName))
+		format = withMultiline(format, app.multiline, processName, component, e.Name, app.config.logsDir)
 		tailing.Store(e.fileId, t)
-		return tailedFile{t, e.fileId, processName, processId, component, logFormat}
+		return tailedFile{t, e.fileId, processName, processId, component, format, device, lineOffset}
+	}
+}
+
+// inventoryFile records where tailing of a file found at startup begins, and says whether there's existing
+// content to read. A file the filter excludes begins at its end, like a directory's files, so that if a rule
+// includes it later, e.g. because it's written to again, its old content isn't read.
+func (app *application) inventoryFile(path string, fid fileId, fileInfo fs.FileInfo, seekInfoCache *sync.Map) bool {
+	if !app.includeFile(path, fileInfo) {
+		seekInfoCache.Store(fid, &tail.SeekInfo{Offset: fileInfo.Size(), Whence: io.SeekStart})
+		return false
+	}
+	offset := app.initialOffset(path, fid, fileInfo)
+	seekInfoCache.Store(fid, &tail.SeekInfo{Offset: offset, Whence: io.SeekStart})
+	return offset < fileInfo.Size()
+}
+
+// initialOffset returns where tailing of a file found at startup begins, according to the start-position policy.
+// Unless the policy is to resume from checkpoints, any checkpoint for the file is discarded so it doesn't take precedence.
+func (app *application) initialOffset(path string, fid fileId, fileInfo fs.FileInfo) int64 {
+	policy := app.config.readExistingLogs
+	if policy.Mode == startpos.Checkpoint {
+		device, err := getDevice(path)
+		if err != nil {
+			return fileInfo.Size()
+		}
+		if cp, ok := checkpointFor(app.checkpoints, event{fsnotify.Event{Name: path}, fid}, device); ok {
+			return cp.Offset
+		}
+		return fileInfo.Size()
+	}
+	app.checkpoints.Delete(uint64(fid))
+	switch policy.Mode {
+	case startpos.Beginning:
+		return 0
+	case startpos.Since:
+		if fileInfo.ModTime().Before(policy.Since) {
+			return fileInfo.Size()
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			app.logger.Warn().Err(err).Str("filename", path).Msg("could not open file to search for start position. starting at end")
+			return fileInfo.Size()
+		}
+		defer f.Close()
+		offset, err := startpos.Search(f, fileInfo.Size(), policy.Since, timestamp.Sniff)
+		if errors.Is(err, startpos.ErrNoTimestamps) {
+			// Written to since, but we can't tell when, so read all of it
+			return 0
+		}
+		if err != nil {
+			app.logger.Warn().Err(err).Str("filename", path).Msg("could not search file for start position. starting at end")
+			return fileInfo.Size()
+		}
+		return offset
+	default:
+		return fileInfo.Size()
+	}
+}
+
+// checkpointFor returns the stored checkpoint for the event's file if it still describes that file,
+// i.e. the file lives on the same device and has not been truncated below the checkpointed offset.
+func checkpointFor(checkpoints *checkpoint.Store, e event, device uint64) (checkpoint.Checkpoint, bool) {
+	cp, ok := checkpoints.Get(uint64(e.fileId))
+	if !ok || cp.Device != device {
+		return checkpoint.Checkpoint{}, false
+	}
+	fileInfo, err := os.Stat(e.Name)
+	if err != nil || fileInfo.Size() < cp.Offset {
+		return checkpoint.Checkpoint{}, false
 	}
+	return cp, true
 }
 
 func lineProcessor(tailing *sync.Map, seekInfoCache *sync.Map, app *application, counter *metrics.Counter) func(ctx context.Context, t tailedFile) <-chan line {
 	counters := make(map[string]*metrics.Counter)
+	limits := multilineLimits(app.settings)
 	return func(ctx context.Context, t tailedFile) <-chan line {
 		linesCounter := metrics.GetOrCreateCounter(fmt.Sprintf("tslogs_lines_received_total{filename=%q, fileid=%q}", t.Filename, t.fileId))
 		lineCh := make(chan line)
@@ -314,60 +458,47 @@ func lineProcessor(tailing *sync.Map, seekInfoCache *sync.Map, app *application,
 			linesCounter.Set(0)
 			path := t.Filename
 			fid := t.fileId
-			var re *regexp.Regexp
+			logFormat := t.format.Regexp
+			var re *matcher.Matcher
 			var err error
-			if t.logFormat != "json" && t.logFormat != "" {
-				re, err = regexp.Compile(t.logFormat)
+			if logFormat != logformat.JSON && logFormat != "" {
+				re, err = matcher.Cached(logFormat)
 				if err != nil {
 					app.logger.Err(err).Str("filename", t.Filename).Int64("fileid", int64(t.fileId)).Msg("could not compile parser. skipping")
 					return
 				}
 			}
-			newEntry := func(line string) bool {
-				if t.logFormat == "json" {
-					if len(line) > 0 && line[0] == '{' {
-						return true
-					}
-					return false
-				}
-				if t.logFormat == "" {
-					return true
-				}
-				if re != nil {
-					return re.MatchString(line)
-				}
-				return true
+			rules, err := multilineRules(t.format, re)
+			if err != nil {
+				app.logger.Err(err).Str("filename", t.Filename).Int64("fileid", int64(t.fileId)).Msg("could not compile multiline rules. skipping")
+				return
 			}
-			completeEntry := func(line string) completeness {
-				if t.logFormat == "json" {
-					if line[0] == '{' && line[len(line)-1] == '}' {
-						return complete
-					}
-					return incomplete
-				}
-				if t.logFormat == "" {
-					return complete
-				}
-				return unknownCompleteness
+			fileLimits := limits
+			if t.format.Multiline.MaxLines > 0 {
+				fileLimits.MaxLines = t.format.Multiline.MaxLines
 			}
+			assembler := multiline.New[*tail.Line](rules, fileLimits)
+			// submatches is reused by parse and describe, which only run on this goroutine.
+			var submatches []int
 			parse := func(text string) string {
-				if t.logFormat == "json" {
+				if logFormat == logformat.JSON {
 					return text
 				}
-				if t.logFormat == "" {
+				if logFormat == "" {
 					return text
 				}
 				if re != nil {
-					matches := re.FindStringSubmatch(text)
-					if len(matches) == 0 {
+					var ok bool
+					if submatches, ok = re.SubmatchIndex(text, submatches); !ok {
 						return text
 					}
-					result := make(map[string]string)
+					result := make(map[string]any)
 					for i, name := range re.SubexpNames() {
 						if i != 0 && name != "" {
-							result[name] = matches[i]
+							result[name] = t.format.Value(name, submatch(text, submatches, i))
 						}
 					}
+					addException(result)
 					b, err := json.Marshal(result)
 					if err != nil {
 						return text
@@ -376,29 +507,79 @@ func lineProcessor(tailing *sync.Map, seekInfoCache *sync.Map, app *application,
 				}
 				return text
 			}
-			sendAccumulatedLines := func(l []*tail.Line) {
-				combinedLine := &tail.Line{
-					Num:      l[0].Num,
-					SeekInfo: l[len(l)-1].SeekInfo,
-					Time:     l[0].Time,
-					Err:      l[0].Err,
+			// describe returns the time an entry was written, taken from the format's time fields, or failing that,
+			// from the first timestamp found in it, and its level, taken from the format's level group.
+			levelGroup := -1
+			if re != nil {
+				levelGroup = re.SubexpIndex("level")
+			}
+			describe := func(text string) (time.Time, string) {
+				var ts time.Time
+				var level string
+				if logFormat == logformat.JSON {
+					ts, _ = logformat.JSONTime(text)
+				} else if re != nil && (len(t.format.Time) > 0 || levelGroup > 0) {
+					var ok bool
+					if submatches, ok = re.SubmatchIndex(text, submatches); ok {
+						values := make([]string, 0, len(t.format.Time))
+						for _, name := range t.format.Time {
+							if i := re.SubexpIndex(name); i > 0 {
+								values = append(values, submatch(text, submatches, i))
+							}
+						}
+						ts, _ = t.format.ParseTime(values...)
+						if levelGroup > 0 {
+							level = t.format.Level(submatch(text, submatches, levelGroup))
+						}
+					}
 				}
-				var rawText string
-				for i, v := range l {
-					if i == 0 {
-						rawText += v.Text
-					} else {
-						rawText += "\n" + v.Text
+				if ts.IsZero() {
+					ts, _ = timestamp.Sniff(text)
+				}
+				return ts, level
+			}
+			// emit sends an entry whose unparsed text is raw and whose last line is last. From then on, the file
+			// is resumed after it, and its checkpoint advances past it once every sink has accepted it. It returns
+			// the entry's level.
+			emit := func(entry *tail.Line, last *tail.Line, raw string) string {
+				ts, level := describe(raw)
+				seekInfo := last.SeekInfo
+				seekInfoCache.Store(fid, &seekInfo)
+				ack := app.tracker.Track(checkpoint.Checkpoint{
+					FileID: uint64(fid),
+					Device: t.device,
+					Path:   path,
+					Offset: seekInfo.Offset,
+					Line:   last.Num,
+				})
+				var envelope *logformat.Envelope
+				if logFormat == logformat.JSON {
+					if e, ok := logformat.ParseEnvelope(entry.Text); ok {
+						envelope = &e
+					}
+				}
+				l := line{entry, path, fid, t.processName, t.processId, t.component, ts, level, levelGroup > 0, envelope, ack}
+				lineCh <- l
+				return l.Level()
+			}
+			// send emits an assembled entry, parsed if need be, and counts it.
+			send := func(e multiline.Entry[*tail.Line]) {
+				entry := e.First
+				if e.Lines > 1 || e.Truncated {
+					entry = &tail.Line{
+						Num:      e.First.Num,
+						SeekInfo: e.Last.SeekInfo,
+						Time:     e.First.Time,
+						Err:      e.First.Err,
 					}
 				}
 				if app.config.parse {
-					combinedLine.Text = parse(rawText)
+					entry.Text = parse(e.Text)
 				} else {
-					combinedLine.Text = rawText
+					entry.Text = e.Text
 				}
-				output := line{combinedLine, path, fid, t.processName, t.processId, t.component}
-				lineCh <- output
-				logEntryCounterName := fmt.Sprintf("tslogs_entries_total{process=%q, node=%q, component=%q, level=%q}", t.processName, app.config.node, t.component, output.Level())
+				level := emit(entry, e.Last, e.Text)
+				logEntryCounterName := fmt.Sprintf("tslogs_entries_total{process=%q, node=%q, component=%q, level=%q}", t.processName, app.config.node, t.component, level)
 				if logEntryCounter, ok := counters[logEntryCounterName]; !ok {
 					logEntryCounter = metrics.NewCounter(logEntryCounterName)
 					counters[logEntryCounterName] = logEntryCounter
@@ -406,20 +587,38 @@ func lineProcessor(tailing *sync.Map, seekInfoCache *sync.Map, app *application,
 				} else {
 					logEntryCounter.Inc()
 				}
+				if e.Truncated {
+					truncatedCounterName := fmt.Sprintf("tslogs_entries_truncated_total{process=%q, node=%q, component=%q}", t.processName, app.config.node, t.component)
+					if truncatedCounter, ok := counters[truncatedCounterName]; !ok {
+						truncatedCounter = metrics.NewCounter(truncatedCounterName)
+						counters[truncatedCounterName] = truncatedCounter
+						truncatedCounter.Inc()
+					} else {
+						truncatedCounter.Inc()
+					}
+				}
+			}
+			flush := func() {
+				if e, ok := assembler.Flush(); ok {
+					send(e)
+				}
 			}
-			lines := make([]*tail.Line, 0)
+			// A pending entry is flushed once no line has continued it for the flush timeout.
+			flushTimer := time.NewTimer(limits.FlushTimeout)
+			flushTimer.Stop()
+			defer flushTimer.Stop()
+			var flushCh <-chan time.Time
 			for {
 				select {
 				case <-ctx.Done():
-					if len(lines) > 0 {
-						sendAccumulatedLines(lines)
-					}
+					flush()
 					return
 				case l, ok := <-t.Lines:
 					if !ok {
+						flush()
 						return
 					}
-					seekInfoCache.Store(fid, &l.SeekInfo)
+					l.Num += t.lineOffset
 					// Metrics
 					{
 						linesCounter.Inc()
@@ -436,26 +635,20 @@ func lineProcessor(tailing *sync.Map, seekInfoCache *sync.Map, app *application,
 
 					}
 
-					if !newEntry(l.Text) {
-						lines = append(lines, l)
-						continue
-					}
-					// It is a new entry
-					// Do we have any accumulated lines to send?
-					if len(lines) > 0 {
-						sendAccumulatedLines(lines)
-						lines = make([]*tail.Line, 0)
+					assembler.Add(l.Text, l, send)
+					flushTimer.Stop()
+					flushCh = nil
+					if assembler.Pending() && limits.FlushTimeout > 0 {
+						flushTimer.Reset(limits.FlushTimeout)
+						flushCh = flushTimer.C
 					}
-					// If it's a complete entry, no need to accumulate lines. Send it!
-					if completeEntry(l.Text) == complete {
-						output := line{l, path, fid, t.processName, t.processId, t.component}
-						lineCh <- output
-						continue
-					}
-					// Otherwise, accumulate lines
-					lines = append(lines, l)
+
+				case <-flushCh:
+					flushCh = nil
+					flush()
 
 				case <-time.After(time.Minute * 5):
+					flush()
 					t.Cleanup()
 					return
 				}
@@ -465,13 +658,51 @@ func lineProcessor(tailing *sync.Map, seekInfoCache *sync.Map, app *application,
 	}
 }
 
-type completeness int
-
-const (
-	incomplete completeness = iota
-	complete
-	unknownCompleteness
-)
+// pollUnnotified polls the whole logs directory once its files, outside the directories already polled, are seen to
+// change while the watcher notifies no event, e.g. because it's on an NFS mount. Tails waiting for notifications are stopped, and are resumed by the
+// next poll from where they left off.
+func (app *application) pollUnnotified(ctx context.Context, tailing *sync.Map, eventsCounter *metrics.Counter) {
+	logsDir := app.config.logsDir
+	interval := app.settings.GetDuration("polling.auto_after")
+	if interval <= 0 || app.poller.Polls(logsDir) {
+		return
+	}
+	probe := poller.New()
+	probe.Add(logsDir)
+	notified := eventsCounter.Get()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// The changes of directories that are already polled are never notified
+		changes := slices.DeleteFunc(probe.Poll(), func(e fsnotify.Event) bool { return app.poller.Polls(e.Name) })
+		previous := notified
+		notified = eventsCounter.Get()
+		if len(changes) == 0 || notified != previous || app.poller.Polls(logsDir) {
+			continue
+		}
+		app.logger.Warn().
+			Str("component", "logprocessor").
+			Str("logsdir", logsDir).
+			Int("changes", len(changes)).
+			Dur("interval", interval).
+			Msg("files changed without notification. polling the logs directory")
+		app.poller.Add(logsDir)
+		tailing.Range(func(_, value any) bool {
+			if t := value.(*tail.Tail); !t.Poll {
+				t.Stop()
+				t.Cleanup()
+				app.poller.Forget(t.Filename)
+			}
+			return true
+		})
+		return
+	}
+}
 
 // watchConfigDir monitors the config directory for new process instance directories.
 // When a new config directory appears (e.g., vizqlserver_1/), it checks if there are
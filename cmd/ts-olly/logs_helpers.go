@@ -1,11 +1,21 @@
 package main
 
 import (
+	"fmt"
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/highperformance-tech/ts-olly/internal/filefilter"
 	"github.com/highperformance-tech/ts-olly/internal/fileid"
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
+	"github.com/highperformance-tech/ts-olly/internal/matcher"
+	"github.com/highperformance-tech/ts-olly/internal/multiline"
+	"github.com/highperformance-tech/ts-olly/internal/stacktrace"
+	"github.com/spf13/viper"
+	"io/fs"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func getFileId(path string) (fileId, error) {
@@ -13,6 +23,10 @@ func getFileId(path string) (fileId, error) {
 	return fileId(fid), err
 }
 
+func getDevice(path string) (uint64, error) {
+	return fileid.QueryDevice(path)
+}
+
 func getProcessName(path, logsDir string) string {
 	path = strings.Replace(path, logsDir+string(filepath.Separator), "", 1)
 	path, _, ok := strings.Cut(path, string(filepath.Separator))
@@ -36,6 +50,221 @@ func getProcessId(filename string) uint8 {
 	return 0
 }
 
+// submatch returns the ith submatch of s, given the index pairs of a match's submatches, or "" if it didn't
+// participate in the match.
+func submatch(s string, submatches []int, i int) string {
+	if submatches[2*i] < 0 {
+		return ""
+	}
+	return s[submatches[2*i]:submatches[2*i+1]]
+}
+
+// addException adds the Java exception, if any, in a parsed entry's throwable, or failing that its message, to
+// the entry's fields as exception.
+func addException(fields map[string]any) {
+	text, _ := fields["throwable"].(string)
+	if text == "" {
+		text, _ = fields["message"].(string)
+	}
+	if e, ok := stacktrace.Parse(text); ok {
+		fields["exception"] = e
+	}
+}
+
+// withLevels returns the format with levels added to its level normalization table, overriding its own.
+func withLevels(format logformat.Format, levels map[string]string) logformat.Format {
+	if len(levels) == 0 {
+		return format
+	}
+	merged := make(map[string]string, len(format.Levels)+len(levels))
+	for value, level := range format.Levels {
+		merged[value] = level
+	}
+	for value, level := range levels {
+		merged[strings.ToLower(value)] = strings.ToLower(level)
+	}
+	format.Levels = merged
+	return format
+}
+
+// multilineRules returns the rules that group the lines of a file of the given format into entries. re is the
+// format's compiled Regexp, if any.
+func multilineRules(format logformat.Format, re *matcher.Matcher) (multiline.Rules, error) {
+	m := format.Multiline
+	if m.Empty() {
+		switch format.Regexp {
+		case "":
+			m = logformat.TextMultiline
+		case logformat.JSON:
+			m = logformat.JSONMultiline
+		}
+		m.MaxLines = format.Multiline.MaxLines
+	}
+	var rules multiline.Rules
+	if re != nil {
+		rules.Start = re.MatchString
+	}
+	for _, rule := range []struct {
+		name string
+		expr string
+		fn   *func(string) bool
+	}{
+		{"start", m.Start, &rules.Start},
+		{"continue", m.Continue, &rules.Continue},
+		{"end", m.End, &rules.End},
+	} {
+		if rule.expr == "" {
+			continue
+		}
+		rm, err := matcher.Cached(rule.expr)
+		if err != nil {
+			return multiline.Rules{}, fmt.Errorf("compile multiline %s rule %q: %w", rule.name, rule.expr, err)
+		}
+		*rule.fn = rm.MatchString
+	}
+	if start := rules.Start; m.Negate && start != nil {
+		rules.Start = func(s string) bool { return !start(s) }
+	}
+	// Without a start rule, lines that don't continue an entry start one.
+	if continues := rules.Continue; rules.Start == nil && continues != nil {
+		rules.Start = func(s string) bool { return !continues(s) }
+	}
+	return rules, nil
+}
+
+// multilineRule sets the multi-line rules of the files it selects by process, component and path, the doublestar
+// glob Files matched against the file's path in the logs directory. Empty selectors select any file.
+type multilineRule struct {
+	Process   string `mapstructure:"process"`
+	Component string `mapstructure:"component"`
+	Files     string `mapstructure:"files"`
+	Start     string `mapstructure:"start"`
+	Continue  string `mapstructure:"continue"`
+	End       string `mapstructure:"end"`
+	Negate    bool   `mapstructure:"negate"`
+	MaxLines  int    `mapstructure:"max_lines"`
+}
+
+// multiline returns the rule's multi-line rules.
+func (r multilineRule) multiline() logformat.Multiline {
+	return logformat.Multiline{Start: r.Start, Continue: r.Continue, End: r.End, Negate: r.Negate, MaxLines: r.MaxLines}
+}
+
+// getMultilineRules returns the multi-line rules of the multiline.rules section of settings, in order.
+func getMultilineRules(settings *viper.Viper) ([]multilineRule, error) {
+	var rules []multilineRule
+	if err := settings.UnmarshalKey("multiline.rules", &rules); err != nil {
+		return nil, fmt.Errorf("read multiline rules: %w", err)
+	}
+	for i, r := range rules {
+		if r.Files != "" && !doublestar.ValidatePattern(r.Files) {
+			return nil, fmt.Errorf("multiline rule %d: invalid files glob %q", i+1, r.Files)
+		}
+		if _, err := multilineRules(logformat.Format{Multiline: r.multiline()}, nil); err != nil {
+			return nil, fmt.Errorf("multiline rule %d: %w", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// withMultiline returns the format with the multi-line rules of the first rule that selects the file of a
+// process and component, if any, in place of its own.
+func withMultiline(format logformat.Format, rules []multilineRule, processName, component, filename, logsDir string) logformat.Format {
+	for _, r := range rules {
+		if r.Process != "" && r.Process != processName || r.Component != "" && r.Component != component {
+			continue
+		}
+		if r.Files != "" && !doublestar.MatchUnvalidated(r.Files, logsPath(filename, logsDir)) {
+			continue
+		}
+		format.Multiline = r.multiline()
+		return format
+	}
+	return format
+}
+
+// setMultilineDefaults sets the default limits of multi-line entries.
+func setMultilineDefaults(settings *viper.Viper) {
+	settings.SetDefault("multiline.flush_timeout", multiline.DefaultLimits.FlushTimeout)
+	settings.SetDefault("multiline.max_lines", multiline.DefaultLimits.MaxLines)
+	settings.SetDefault("multiline.max_bytes", multiline.DefaultLimits.MaxBytes)
+}
+
+// multilineLimits returns the limits of multi-line entries set in settings.
+func multilineLimits(settings *viper.Viper) multiline.Limits {
+	return multiline.Limits{
+		FlushTimeout: settings.GetDuration("multiline.flush_timeout"),
+		MaxLines:     settings.GetInt("multiline.max_lines"),
+		MaxBytes:     settings.GetInt("multiline.max_bytes"),
+	}
+}
+
+// setFileDefaults sets the default file rules, which exclude the search server's own log, whose lines are
+// duplicated in others, and compressed archives of rotated logs.
+func setFileDefaults(settings *viper.Viper) {
+	settings.SetDefault("files.rules", []map[string]any{
+		{"action": "exclude", "glob": "**/searchserver-0.log*"},
+		{"action": "exclude", "glob": "**/*.gz"},
+	})
+}
+
+// getFileFilter returns the filter of the files.rules section of settings.
+func getFileFilter(settings *viper.Viper) (*filefilter.Filter, error) {
+	var rules []filefilter.Rule
+	if err := settings.UnmarshalKey("files.rules", &rules); err != nil {
+		return nil, fmt.Errorf("read file rules: %w", err)
+	}
+	return filefilter.New(rules)
+}
+
+// logsPath returns the path of a log file in the logs directory, with forward slashes.
+func logsPath(path, logsDir string) string {
+	rel, err := filepath.Rel(logsDir, path)
+	if err != nil {
+		rel = path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// fileOf returns the file a filter decides on of a log file at path.
+func fileOf(path, logsDir string, fileInfo fs.FileInfo) filefilter.File {
+	return filefilter.File{
+		Path:      logsPath(path, logsDir),
+		Process:   getProcessName(path, logsDir),
+		Component: getComponent(filepath.Base(path)),
+		ModTime:   fileInfo.ModTime(),
+		Size:      fileInfo.Size(),
+	}
+}
+
+// includeFile says whether the log file at path is tailed, recording the decision for the /files view.
+func (app *application) includeFile(path string, fileInfo fs.FileInfo) bool {
+	file := fileOf(path, app.config.logsDir, fileInfo)
+	decision := app.filter.Decide(file)
+	app.files.Add(file, decision)
+	return decision.Included
+}
+
+// setPollingDefaults sets the default polling settings: no directory is polled unless the logs directory's changes
+// aren't notified.
+func setPollingDefaults(settings *viper.Viper) {
+	settings.SetDefault("polling.interval", 2*time.Second)
+	settings.SetDefault("polling.auto", true)
+	settings.SetDefault("polling.auto_after", time.Minute)
+}
+
+// pollsDir says whether the directory at path is selected for polling by a glob of polling.dirs, matched against
+// its path in the logs directory.
+func (app *application) pollsDir(path string) bool {
+	rel := logsPath(path, app.config.logsDir)
+	for _, glob := range app.settings.GetStringSlice("polling.dirs") {
+		if ok, _ := doublestar.Match(glob, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func getComponent(filename string) string {
 	var component string
 	switch {
@@ -2,7 +2,17 @@ package main
 
 import (
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/filefilter"
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
+	"github.com/highperformance-tech/ts-olly/internal/matcher"
+	"github.com/highperformance-tech/ts-olly/internal/multiline"
+	"github.com/highperformance-tech/ts-olly/internal/stacktrace"
+	"github.com/spf13/viper"
 )
 
 func TestLogsHelpers(t *testing.T) {
@@ -83,6 +93,198 @@ func TestLogsHelpers(t *testing.T) {
 			})
 		}
 	})
+	t.Run("withLevels", func(t *testing.T) {
+		format := logformat.Format{Levels: map[string]string{"notice": "info", "log": "info"}}
+		got := withLevels(format, map[string]string{"LOG": "Debug", "verbose": "trace"})
+		if got.Level("notice") != "info" || got.Level("log") != "debug" || got.Level("VERBOSE") != "trace" {
+			t.Errorf("expected configured levels to extend and override the format's, got %v", got.Levels)
+		}
+		if format.Levels["log"] != "info" {
+			t.Errorf("expected the format's own table to be unchanged, got %v", format.Levels)
+		}
+	})
+	t.Run("multilineRules", func(t *testing.T) {
+		log4j := logformat.Format{Regexp: `^(?P<date>\d{4}-\d{2}-\d{2}) (?P<message>.*)`}
+		re, err := matcher.Cached(log4j.Regexp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			name  string
+			lines []string
+			want  []string
+		}{
+			{"unknown format", []string{"one", "java.lang.Exception: two", "\tat a.B.c(B.java:1)", "Caused by: three", "four"}, []string{"one", "java.lang.Exception: two\n\tat a.B.c(B.java:1)\nCaused by: three", "four"}},
+			{"json", []string{`{"a":1}`, "{", `  "b": {"c": 2}`, "}", `{"d":3}`}, []string{`{"a":1}`, "{\n  \"b\": {\"c\": 2}\n}", `{"d":3}`}},
+			{"regexp", []string{"2022-08-02 first", "\tat com.tableau.Foo.bar(Foo.java:12)", "2022-08-02 second"}, []string{"2022-08-02 first\n\tat com.tableau.Foo.bar(Foo.java:12)", "2022-08-02 second"}},
+			{"negated start", []string{"2022-08-02 first", "detail", "2022-08-02 second"}, []string{"2022-08-02 first\ndetail", "2022-08-02 second"}},
+			{"continue only", []string{"first", "+ more", "second"}, []string{"first\n+ more", "second"}},
+		}
+		formats := map[string]logformat.Format{
+			"unknown format": {}, "json": {Regexp: logformat.JSON}, "regexp": log4j,
+			"negated start": {Multiline: logformat.Multiline{Start: `^\D`, Negate: true}},
+			"continue only": {Multiline: logformat.Multiline{Continue: `^\+ `}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				format := formats[tt.name]
+				var formatRe *matcher.Matcher
+				if format.Regexp == log4j.Regexp {
+					formatRe = re
+				}
+				rules, err := multilineRules(format, formatRe)
+				if err != nil {
+					t.Fatal(err)
+				}
+				a := multiline.New[int](rules, multiline.Limits{})
+				var got []string
+				for i, l := range tt.lines {
+					a.Add(l, i, func(e multiline.Entry[int]) { got = append(got, e.Text) })
+				}
+				if e, ok := a.Flush(); ok {
+					got = append(got, e.Text)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("expected %q, got %q", tt.want, got)
+				}
+			})
+		}
+		if _, err := multilineRules(logformat.Format{Multiline: logformat.Multiline{End: "("}}, nil); err == nil {
+			t.Errorf("expected an invalid rule to be an error")
+		}
+	})
+	t.Run("getMultilineRules", func(t *testing.T) {
+		settings := viper.New()
+		settings.SetConfigType("yaml")
+		if err := settings.ReadConfig(strings.NewReader(`
+multiline:
+  rules:
+    - process: pgsql
+      start: '^\d{4}-'
+      max_lines: 50
+    - component: stdout
+      files: "**/stdout_*.log"
+      continue: '^\s'
+`)); err != nil {
+			t.Fatal(err)
+		}
+		rules, err := getMultilineRules(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []multilineRule{
+			{Process: "pgsql", Start: `^\d{4}-`, MaxLines: 50},
+			{Component: "stdout", Files: "**/stdout_*.log", Continue: `^\s`},
+		}
+		if !reflect.DeepEqual(rules, want) {
+			t.Fatalf("expected %+v, got %+v", want, rules)
+		}
+		tests := []struct {
+			name        string
+			processName string
+			component   string
+			filename    string
+			want        logformat.Multiline
+		}{
+			{"by process", "pgsql", "", "/logs/pgsql/postgresql-Tue.csv", logformat.Multiline{Start: `^\d{4}-`, MaxLines: 50}},
+			{"by component and file", "vizqlserver", "stdout", "/logs/vizqlserver/stdout_vizqlserver_0.log", logformat.Multiline{Continue: `^\s`}},
+			{"file mismatch", "vizqlserver", "stdout", "/logs/vizqlserver/stdout_vizqlserver_0.txt", logformat.Multiline{End: "x"}},
+			{"unselected", "vizqlserver", "", "/logs/vizqlserver/vizqlserver_0.log", logformat.Multiline{End: "x"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				format := logformat.Format{Multiline: logformat.Multiline{End: "x"}}
+				if got := withMultiline(format, rules, tt.processName, tt.component, tt.filename, "/logs"); got.Multiline != tt.want {
+					t.Errorf("expected %+v, got %+v", tt.want, got.Multiline)
+				}
+			})
+		}
+		settings.Set("multiline.rules", []map[string]any{{"files": "[", "start": "x"}})
+		if _, err := getMultilineRules(settings); err == nil {
+			t.Errorf("expected an invalid glob to be an error")
+		}
+		settings.Set("multiline.rules", []map[string]any{{"start": "("}})
+		if _, err := getMultilineRules(settings); err == nil {
+			t.Errorf("expected an invalid rule to be an error")
+		}
+	})
+	t.Run("getFileFilter", func(t *testing.T) {
+		settings := viper.New()
+		setFileDefaults(settings)
+		filter, err := getFileFilter(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for path, included := range map[string]bool{
+			"searchserver/searchserver-0.log":            false,
+			"httpd/access.2022_08_02_00_00_00.log.gz":    false,
+			"searchserver/searchserver_node1-0.log":      true,
+			"vizqlserver/Logs/vizqlserver_node1-0.log":   true,
+			"searchserver/searchserver-0.log.2022-08-02": false,
+		} {
+			if got := filter.Decide(filefilter.File{Path: path}); got.Included != included {
+				t.Errorf("expected %s to be included: %t, got %+v", path, included, got)
+			}
+		}
+		settings.Set("files.rules", []map[string]any{{"action": "exclude", "older_than": "168h"}})
+		filter, err = getFileFilter(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := filter.Decide(filefilter.File{Path: "a.log", ModTime: time.Now().AddDate(0, 0, -8)}); got.Included {
+			t.Errorf("expected an old file to be excluded, got %+v", got)
+		}
+		settings.Set("files.rules", []map[string]any{{"action": "skip"}})
+		if _, err := getFileFilter(settings); err == nil {
+			t.Errorf("expected an unknown action to be an error")
+		}
+	})
+	t.Run("pollsDir", func(t *testing.T) {
+		settings := viper.New()
+		settings.Set("polling.dirs", []string{"httpd", "vizqlserver/**"})
+		app := &application{config: config{logsDir: filepath.FromSlash("/data/logs")}, settings: settings}
+		for dir, want := range map[string]bool{
+			"httpd":              true,
+			"httpd/archive":      false,
+			"vizqlserver":        true,
+			"vizqlserver/Logs":   true,
+			"backgrounder":       false,
+			"searchserver/httpd": false,
+		} {
+			if got := app.pollsDir(filepath.Join(app.config.logsDir, filepath.FromSlash(dir))); got != want {
+				t.Errorf("expected polls %s: %t, got %t", dir, want, got)
+			}
+		}
+	})
+	t.Run("multilineLimits", func(t *testing.T) {
+		settings := viper.New()
+		setMultilineDefaults(settings)
+		if got := multilineLimits(settings); got != multiline.DefaultLimits {
+			t.Errorf("expected the default limits, got %+v", got)
+		}
+		settings.Set("multiline.flush_timeout", "250ms")
+		if got := multilineLimits(settings); got.FlushTimeout != 250*time.Millisecond {
+			t.Errorf("expected the configured flush timeout, got %v", got.FlushTimeout)
+		}
+	})
+	t.Run("addException", func(t *testing.T) {
+		trace := "java.io.IOException: Broken pipe\n\tat a.B.c(B.java:1)"
+		fields := map[string]any{"message": "Write failed", "throwable": trace}
+		addException(fields)
+		if e, ok := fields["exception"].(*stacktrace.Exception); !ok || e.Type != "java.io.IOException" {
+			t.Errorf("expected exception from throwable, got %v", fields["exception"])
+		}
+		fields = map[string]any{"message": "Write failed\n" + trace, "throwable": ""}
+		addException(fields)
+		if _, ok := fields["exception"].(*stacktrace.Exception); !ok {
+			t.Errorf("expected exception from message, got %v", fields["exception"])
+		}
+		fields = map[string]any{"message": "Write failed"}
+		addException(fields)
+		if _, ok := fields["exception"]; ok {
+			t.Errorf("expected no exception, got %v", fields["exception"])
+		}
+	})
 	t.Run("test getting process instance details from file paths", func(t *testing.T) {
 		files := []struct {
 			path      string
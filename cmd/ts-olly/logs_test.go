@@ -10,8 +10,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/VictoriaMetrics/metrics"
 	"github.com/fsnotify/fsnotify"
+	"github.com/highperformance-tech/ts-olly/internal/checkpoint"
+	"github.com/highperformance-tech/ts-olly/internal/poller"
+	"github.com/highperformance-tech/ts-olly/internal/startpos"
+	"github.com/nxadm/tail"
 	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
 )
 
 func TestPendingFilesKeyFormat(t *testing.T) {
@@ -176,3 +182,143 @@ func TestWatchConfigDirDetectsNewDirectory(t *testing.T) {
 // Note: TestWatchConfigDirIgnoresNonMatchingDirectory was removed because the
 // VictoriaMetrics counter registration doesn't support multiple test runs.
 // The matching logic is covered by TestConfigDirectoryMatching instead.
+
+func TestCheckpointFor(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vizportal_node1-0.log")
+	if err := os.WriteFile(path, []byte("line one\nline two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fid, err := getFileId(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device, err := getDevice(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := event{Event: fsnotify.Event{Name: path, Op: fsnotify.Create}, fileId: fid}
+
+	tests := []struct {
+		name string
+		cp   *checkpoint.Checkpoint
+		want bool
+	}{
+		{"no checkpoint", nil, false},
+		{"matching checkpoint", &checkpoint.Checkpoint{FileID: uint64(fid), Device: device, Path: path, Offset: 9, Line: 1}, true},
+		{"checkpoint at end of file", &checkpoint.Checkpoint{FileID: uint64(fid), Device: device, Path: path, Offset: 18, Line: 2}, true},
+		{"checkpoint on another device", &checkpoint.Checkpoint{FileID: uint64(fid), Device: device + 1, Path: path, Offset: 9, Line: 1}, false},
+		{"checkpoint beyond truncated file", &checkpoint.Checkpoint{FileID: uint64(fid), Device: device, Path: path, Offset: 100, Line: 10}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, _ := checkpoint.Open("")
+			if tt.cp != nil {
+				store.Set(*tt.cp)
+			}
+			cp, ok := checkpointFor(store, e, device)
+			if ok != tt.want {
+				t.Fatalf("checkpointFor() ok = %v, want %v", ok, tt.want)
+			}
+			if ok && cp != *tt.cp {
+				t.Errorf("checkpointFor() = %+v, want %+v", cp, *tt.cp)
+			}
+		})
+	}
+}
+
+func TestPollUnnotified(t *testing.T) {
+	logsDir := t.TempDir()
+	settings := viper.New()
+	setPollingDefaults(settings)
+	settings.Set("polling.auto_after", "20ms")
+	app := &application{
+		config:   config{logsDir: logsDir},
+		logger:   zerolog.New(os.Stderr).Level(zerolog.Disabled),
+		settings: settings,
+		poller:   poller.New(),
+	}
+	httpd := filepath.Join(logsDir, "httpd")
+	if err := os.Mkdir(httpd, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	app.poller.Add(httpd)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		app.pollUnnotified(ctx, &sync.Map{}, metrics.NewSet().NewCounter("tslogs_events_total"))
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if app.poller.Polls(logsDir) {
+		t.Fatal("expected the logs directory not to be polled while its files don't change")
+	}
+	// The changes of a directory that's already polled aren't notified by the watcher
+	if err := os.WriteFile(filepath.Join(httpd, "access.log"), []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if app.poller.Polls(logsDir) {
+		t.Fatal("expected the logs directory not to be polled because a polled directory's files changed")
+	}
+	if err := os.WriteFile(filepath.Join(logsDir, "vizqlserver.log"), []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("pollUnnotified did not return")
+	}
+	if !app.poller.Polls(logsDir) {
+		t.Error("expected the logs directory to be polled once its files changed without notification")
+	}
+}
+
+func TestInventoryFile(t *testing.T) {
+	logsDir := t.TempDir()
+	for _, name := range []string{"vizqlserver.log", "vizqlserver.log.gz"} {
+		if err := os.WriteFile(filepath.Join(logsDir, name), []byte("line one\nline two\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settings := viper.New()
+	settings.Set("files.rules", []map[string]any{{"action": "exclude", "glob": "**/*.gz"}})
+	filter, err := getFileFilter(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoints, _ := checkpoint.Open("")
+	app := &application{
+		config:      config{logsDir: logsDir, readExistingLogs: startpos.Policy{Mode: startpos.Beginning}},
+		logger:      zerolog.New(os.Stderr).Level(zerolog.Disabled),
+		filter:      filter,
+		checkpoints: checkpoints,
+	}
+	seekInfoCache := &sync.Map{}
+	for name, want := range map[string]struct {
+		backlog bool
+		offset  int64
+	}{
+		"vizqlserver.log":    {true, 0},
+		"vizqlserver.log.gz": {false, 18}, // excluded, so begins at its end should a rule include it later
+	} {
+		path := filepath.Join(logsDir, name)
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fid, err := getFileId(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := app.inventoryFile(path, fid, fileInfo, seekInfoCache); got != want.backlog {
+			t.Errorf("%s: expected backlog %t, got %t", name, want.backlog, got)
+		}
+		seekInfo, ok := seekInfoCache.Load(fid)
+		if !ok || seekInfo.(*tail.SeekInfo).Offset != want.offset {
+			t.Errorf("%s: expected to begin at %d, got %v", name, want.offset, seekInfo)
+		}
+	}
+}
@@ -4,8 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"flag"
+	"github.com/VictoriaMetrics/metrics"
 	"github.com/fsnotify/fsnotify"
+	"github.com/highperformance-tech/ts-olly/internal/checkpoint"
+	"github.com/highperformance-tech/ts-olly/internal/filefilter"
+	"github.com/highperformance-tech/ts-olly/internal/poller"
+	"github.com/highperformance-tech/ts-olly/internal/sink"
+	"github.com/highperformance-tech/ts-olly/internal/spool"
+	"github.com/highperformance-tech/ts-olly/internal/startpos"
 	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
@@ -16,32 +24,40 @@ import (
 )
 
 type config struct {
-	port             int
-	env              string
-	node             string
-	logsDir          string
-	configDir        string
-	parse            bool
-	skipFiles        []string
-	readExistingLogs bool
+	port               int
+	env                string
+	node               string
+	logsDir            string
+	configDir          string
+	parse              bool
+	readExistingLogs   startpos.Policy
+	checkpointFile     string
+	checkpointInterval time.Duration
+	configFile         string
 }
 type application struct {
-	config  config
-	logger  zerolog.Logger
-	wg      sync.WaitGroup
-	watcher *fsnotify.Watcher
+	config      config
+	logger      zerolog.Logger
+	wg          sync.WaitGroup
+	watcher     *fsnotify.Watcher
+	checkpoints *checkpoint.Store
+	tracker     *checkpoint.Tracker
+	settings    *viper.Viper
+	sinks       map[string]sink.Sink
+	output      *sink.Dispatcher
+	spool       *spool.Spool
+	multiline   []multilineRule
+	filter      *filefilter.Filter
+	files       filefilter.Records
+	poller      *poller.Poller
+	watches     watcherTracker
 }
 
 func main() {
 	//go func() {
 	//	log.Println(http.ListenAndServe("localhost:6060", nil))
 	//}()
-	cfg := config{
-		skipFiles: []string{
-			"searchserver-0.log",
-			".gz",
-		},
-	}
+	var cfg config
 
 	flag.IntVar(&cfg.port, "port", 2112, "application port")
 	flag.StringVar(&cfg.env, "env", "development", "environment (development|staging|production)")
@@ -49,7 +65,10 @@ func main() {
 	flag.StringVar(&cfg.logsDir, "logsdir", "", "logs directory")
 	flag.StringVar(&cfg.configDir, "configdir", "", "config directory")
 	flag.BoolVar(&cfg.parse, "parse", false, "parse recognizable logs lines into json")
-	flag.BoolVar(&cfg.readExistingLogs, "read-existing-logs", false, "read existing logs")
+	flag.Var(&cfg.readExistingLogs, "read-existing-logs", "where to start reading logs that exist at startup (checkpoint|end|beginning|since=<RFC3339>)")
+	flag.StringVar(&cfg.checkpointFile, "checkpoint-file", "", "file to persist tail positions in across restarts (disabled if empty)")
+	flag.StringVar(&cfg.configFile, "config", "", "ts-olly configuration file (yaml)")
+	flag.DurationVar(&cfg.checkpointInterval, "checkpoint-interval", 5*time.Second, "how often tail positions are written to the checkpoint file")
 	flag.Parse()
 
 	logger := zerolog.New(os.Stdout).With().
@@ -63,14 +82,76 @@ func main() {
 	}
 	cfg.logsDir = path
 
-	app := &application{
-		config: cfg,
-		logger: logger.With().Logger(),
+	settings := viper.New()
+	if cfg.configFile != "" {
+		settings.SetConfigFile(cfg.configFile)
+		if err := settings.ReadInConfig(); err != nil {
+			logger.Fatal().Err(err).Str("config", cfg.configFile).Msg("could not read configuration")
+		}
+	}
+	setOutputDefaults(settings)
+	setMultilineDefaults(settings)
+	setFileDefaults(settings)
+	setPollingDefaults(settings)
+	multilineSettings, err := getMultilineRules(settings)
+	if err != nil {
+		logger.Fatal().Err(err).Str("config", cfg.configFile).Msg("could not read configuration")
+	}
+
+	filter, err := getFileFilter(settings)
+	if err != nil {
+		logger.Fatal().Err(err).Str("config", cfg.configFile).Msg("could not read configuration")
+	}
+
+	checkpoints, err := checkpoint.Open(cfg.checkpointFile)
+	if err != nil {
+		logger.Fatal().Err(err).Send()
 	}
+	tracker := checkpoint.NewTracker(checkpoints)
+	metrics.NewGauge("tslogs_checkpoint_pending_entries", func() float64 {
+		return float64(tracker.Pending())
+	})
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	outputSinks := settings.GetStringSlice("output.sinks")
+	selfLogSink := settings.GetString("output.selflog")
+	sinks, err := openSinks(ctx, settings, append([]string{selfLogSink}, outputSinks...)...)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("could not open sinks")
+	}
+	defer closeSinks(sinks)
+	logger = logger.Output(sink.NewLogWriter(sinks[selfLogSink], cfg.node, "ts-olly"))
+
+	sp, err := openSpool(settings)
+	if err != nil {
+		logger.Fatal().Err(err).Send()
+	}
+	if sp != nil {
+		defer sp.Close()
+	}
+
+	app := &application{
+		config:      cfg,
+		logger:      logger.With().Logger(),
+		checkpoints: checkpoints,
+		tracker:     tracker,
+		settings:    settings,
+		sinks:       sinks,
+		spool:       sp,
+		multiline:   multilineSettings,
+		filter:      filter,
+		poller:      poller.New(),
+	}
+	output := make(map[string]sink.Sink)
+	for _, name := range outputSinks {
+		output[name] = sinks[name]
+	}
+	app.output = sink.NewDispatcher(output, settings.GetInt("output.batch_size"), settings.GetDuration("output.flush_interval"), func(name string, err error) {
+		app.logger.Err(err).Str("component", "sink").Str("sink", name).Msg("could not write to sink")
+	})
+
 	go func(cancel context.CancelFunc, app *application) {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -83,6 +164,9 @@ func main() {
 	wg.Add(1)
 	runServe(ctx, app, &wg)
 
+	wg.Add(1)
+	runCheckpoints(ctx, app, &wg)
+
 	i := 1
 WatchForLogsDir:
 	for {
@@ -119,25 +203,52 @@ func runServe(ctx context.Context, app *application, wg *sync.WaitGroup) {
 	}(ctx, app, wg)
 }
 
+func runCheckpoints(ctx context.Context, app *application, wg *sync.WaitGroup) {
+	go func(ctx context.Context, app *application, wg *sync.WaitGroup) {
+		defer wg.Done()
+		app.checkpoints.Run(ctx, app.config.checkpointInterval, func(err error) {
+			app.logger.Err(err).Str("component", "checkpoint").Msg("could not write checkpoints")
+		})
+	}(ctx, app, wg)
+}
+
 func runLogs(ctx context.Context, app *application, wg *sync.WaitGroup) {
 	go func(ctx context.Context, app *application, wg *sync.WaitGroup) {
 		defer wg.Done()
 		lines := app.logs(ctx)
-		for l := range lines {
-			outputLine(app.logger, l)
+		records := make(chan sink.Record)
+		go func() {
+			defer close(records)
+			for l := range lines {
+				records <- newRecord(app.logger, app.config.node, l)
+			}
+		}()
+		if app.spool != nil {
+			app.output.RunSpooled(ctx, records, app.spool)
+		} else {
+			app.output.Run(ctx, records)
 		}
 	}(ctx, app, wg)
 }
 
+// eventTimeFormat is how the time an entry was written is output as @timestamp: in UTC, to the millisecond.
+const eventTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
 func outputLine(logger zerolog.Logger, l line) {
-	lineLogger := logger.With().
+	lineContext := logger.With().
 		Str("filename", l.filename).
 		Stringer("fileid", l.fileId).
 		Str("process", l.processName).
 		Uint8("processid", l.processId).
 		Int("line", l.Num).
-		Int64("offset", l.SeekInfo.Offset).
-		Logger()
+		Int64("offset", l.SeekInfo.Offset)
+	if !l.timestamp.IsZero() {
+		// ingest_lag is how long after the entry was written ts-olly read it, in milliseconds
+		lineContext = lineContext.
+			Str("@timestamp", l.timestamp.UTC().Format(eventTimeFormat)).
+			Dur("ingest_lag", l.Time.Sub(l.timestamp))
+	}
+	lineLogger := lineContext.Logger()
 	if l.Err != nil {
 		lineLogger.Err(l.Err).Send()
 	} else {
@@ -147,14 +258,34 @@ func outputLine(logger zerolog.Logger, l line) {
 		if l.Level() != "" {
 			level, err = zerolog.ParseLevel(l.Level())
 			if err != nil {
-				lineLogger.Err(err).Str("component", "ts-olly").Send()
-				log = lineLogger.Log().Str("level", l.Level())
+				// A level zerolog doesn't know is written as is, so the entry stays a single event
+				log = lineLogger.Log().Str("level", l.Level()).Str("component", l.component)
 			} else {
 				log = lineLogger.WithLevel(level).Str("component", l.component)
 			}
 		} else {
 			log = lineLogger.Log().Str("component", l.component)
 		}
+		if e := l.envelope; e != nil {
+			// Promote the envelope's fields, leaving out those the process didn't write
+			for _, f := range [][2]string{
+				{"pid", e.PID},
+				{"thread", e.Thread},
+				{"request_id", e.Request},
+				{"session", e.Session},
+				{"site", e.Site},
+				{"user", e.User},
+				{"event", e.Key},
+			} {
+				if f[1] != "" {
+					log = log.Str(f[0], f[1])
+				}
+			}
+			if len(e.Value) > 0 {
+				log.RawJSON("message", e.Value).Send()
+				return
+			}
+		}
 		if lineBytes := []byte(l.Line.Text); json.Valid(lineBytes) {
 			log.RawJSON("message", lineBytes).Send()
 		} else {
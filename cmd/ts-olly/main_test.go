@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
 	"github.com/nxadm/tail"
 	"github.com/rs/zerolog"
 	"io"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -92,6 +94,37 @@ func TestLogOutput(t *testing.T) {
 		}
 
 	})
+	t.Run("the level from the format's level group takes precedence", func(t *testing.T) {
+		// A message that merely mentions ERROR keeps the level its format gave it.
+		defer buf.Truncate(0)
+		outputLine(logger, line{Line: &tail.Line{Text: "retrying after ERROR"}, level: "info"})
+		if !bytes.Contains(buf.Bytes(), []byte(`"level":"info"`)) {
+			t.Errorf(`expected "level":"info" to be in %s`, buf.Bytes())
+		}
+	})
+	t.Run("an entry that doesn't match its format's level group has no level", func(t *testing.T) {
+		// Its text isn't searched for a level either.
+		defer buf.Truncate(0)
+		outputLine(logger, line{Line: &tail.Line{Text: "retrying after ERROR"}, leveled: true})
+		if bytes.Contains(buf.Bytes(), []byte(`"level"`)) {
+			t.Errorf("expected no level in %s", buf.Bytes())
+		}
+	})
+	t.Run("native JSON envelopes are flattened", func(t *testing.T) {
+		// The envelope's fields are promoted, its payload becomes the message and its severity the level.
+		defer buf.Truncate(0)
+		text := `{"ts":"2022-07-28T13:41:28.862","pid":1234,"tid":"7f3a","sev":"warning","req":"YuKyGH","sess":"-","site":"Default","user":"admin","k":"end-query","v":{"rows":10}}`
+		envelope, _ := logformat.ParseEnvelope(text)
+		outputLine(logger, line{Line: &tail.Line{Text: text}, envelope: &envelope})
+		for _, expected := range []string{`"level":"warn"`, `"pid":"1234"`, `"thread":"7f3a"`, `"request_id":"YuKyGH"`, `"site":"Default"`, `"user":"admin"`, `"event":"end-query"`, `"message":{"rows":10}`} {
+			if !bytes.Contains(buf.Bytes(), []byte(expected)) {
+				t.Errorf("expected %s to be in %s", expected, buf.Bytes())
+			}
+		}
+		if bytes.Contains(buf.Bytes(), []byte(`"session"`)) {
+			t.Errorf("expected the missing session to be absent in %s", buf.Bytes())
+		}
+	})
 	// If a log line is erroneous, the logger's output represents the error.
 	t.Run("outputs error when log line is erroneous", func(t *testing.T) {
 		defer buf.Truncate(0)
@@ -108,17 +141,20 @@ func TestLogOutput(t *testing.T) {
 		}
 	})
 
-	// If a log line's level is invalid, the logger's output sends an error for that
-	t.Run("outputs error when log line's level is not valid", func(t *testing.T) {
+	// If a log line's level is invalid, the logger's output is still a single event.
+	t.Run("outputs a single event when log line's level is not valid", func(t *testing.T) {
 		defer buf.Truncate(0)
 		fields := fields
 		fields["level"] = "not-a-level"
 		fields["message"] = `{"sev":"not-a-level"}`
 
 		log(fields)
+		if n := bytes.Count(bytes.TrimSpace(buf.Bytes()), []byte("\n")); n != 0 {
+			t.Errorf("expected a single event, got %d more in output %s", n, buf.Bytes())
+		}
 		invalidLevelError := "Unknown Level String" // string from zerolog/log.go in ParseLevel function
-		if !bytes.Contains(buf.Bytes(), []byte(invalidLevelError)) {
-			t.Errorf("expected error %q to be in output %s", invalidLevelError, buf.Bytes())
+		if bytes.Contains(buf.Bytes(), []byte(invalidLevelError)) {
+			t.Errorf("expected no error %q in output %s", invalidLevelError, buf.Bytes())
 		}
 	})
 
@@ -136,3 +172,62 @@ func TestLogOutput(t *testing.T) {
 		}
 	})
 }
+
+func TestNewRecord(t *testing.T) {
+	logger := zerolog.New(io.Discard).With().Str("node", "node1").Logger()
+	l := line{
+		Line: &tail.Line{
+			Text:     "2022-07-28 13:41:28.862 +0000 main : ERROR com.tableau.Main - boom",
+			Num:      7,
+			SeekInfo: tail.SeekInfo{Offset: 512, Whence: io.SeekStart},
+			Time:     time.Now(),
+		},
+		filename:    "/logs/vizportal/vizportal_node1-0.log",
+		fileId:      fileId(0xbeef),
+		processName: "vizportal",
+		processId:   0,
+		component:   "",
+		timestamp:   time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.UTC),
+	}
+	r := newRecord(logger, "node1", l)
+	if r.Node != "node1" || r.Process != "vizportal" || r.FileID != "beef" || r.Line != 7 || r.Offset != 512 {
+		t.Errorf("unexpected record metadata %+v", r)
+	}
+	if r.Level != "error" {
+		t.Errorf("expected level error, got %q", r.Level)
+	}
+	if r.Message != l.Text {
+		t.Errorf("expected message %q, got %q", l.Text, r.Message)
+	}
+	if want := time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.UTC); !r.Time.Equal(want) {
+		t.Errorf("expected the logged time %v, got %v", want, r.Time)
+	}
+	// The record's JSON is exactly what outputLine writes
+	buf := &bytes.Buffer{}
+	outputLine(logger.Output(buf), l)
+	if string(r.JSON) != strings.TrimSuffix(buf.String(), "\n") {
+		t.Errorf("expected JSON %s, got %s", buf.String(), r.JSON)
+	}
+	if !bytes.Contains(r.JSON, []byte(`"@timestamp":"2022-07-28T13:41:28.862Z"`)) || !bytes.Contains(r.JSON, []byte(`"ingest_lag":`)) {
+		t.Errorf("expected the logged time and ingest lag in %s", r.JSON)
+	}
+	// Output that isn't a single object is replaced by the record's own
+	r = newRecord(logger.With().RawJSON("raw", []byte(`1}`+"\n"+`{"b":1`)).Logger(), "node1", l)
+	if !singleObject(r.JSON) || !bytes.Contains(r.JSON, []byte(`"message":"2022-07-28`)) {
+		t.Errorf("expected a single object, got %s", r.JSON)
+	}
+}
+
+func TestSingleObject(t *testing.T) {
+	for given, want := range map[string]bool{
+		`{"a":1}`:          true,
+		`{"a":1}` + "\n{}": false,
+		`"a"`:              false,
+		``:                 false,
+		`{"a":`:            false,
+	} {
+		if got := singleObject([]byte(given)); got != want {
+			t.Errorf("expected %q single object %t, got %t", given, want, got)
+		}
+	}
+}
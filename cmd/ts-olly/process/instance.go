@@ -6,10 +6,12 @@ import (
 	"github.com/highperformance-tech/ts-olly/internal/httpd"
 	"github.com/highperformance-tech/ts-olly/internal/log4j"
 	"github.com/highperformance-tech/ts-olly/internal/log4j2"
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
+	"github.com/highperformance-tech/ts-olly/internal/matcher"
 	"github.com/spf13/viper"
 	"os"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -40,46 +42,114 @@ func (i instance) Config() *viper.Viper {
 	return &i.config
 }
 
+// genericFormats are the formats of files that have no dedicated format, tried in order against their first line.
+var genericFormats = []logformat.Format{
+	// httpd error logs: [Tue Aug 02 15:16:44.042345 2022]
+	httpd.ErrorFormat,
+	{
+		Regexp: `(?P<level>\w+)\s* (?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}[\.,]\d{3} [+-]\d{4}) (?P<thread>\S*) : (?P<class>\S+) - (?s)(?P<message>.*)(?-s)[$\n]?`,
+		Time:   []string{"date"},
+		Layout: "2006-01-02 15:04:05.000 -0700",
+	},
+	// tomcat: 28-Jul-2022 13:41:28.862
+	{
+		Regexp: `^(?P<date>\d{2}-\w{3}-\d{4} \d{2}:\d{2}:\d{2}[\.,]\d{3}) (?P<level>\w+) \[(?P<thread>.*)\] (?P<class>\S+) (?s)(?P<message>.*)(?-s)[$\n]?`,
+		Time:   []string{"date"},
+		Layout: "02-Jan-2006 15:04:05.000",
+		Levels: julLevels,
+	},
+	{
+		Regexp: `^\[(?P<pid>\d+)\] \[(?P<level>\w+)\] (?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}[\.,]\d{3} [+-]\d{4}) : (?s)(?P<message>.*)(?-s)[$\n]?`,
+		Time:   []string{"date"},
+		Layout: "2006-01-02 15:04:05.000 -0700",
+	},
+	// redis: 1234:M 28 Jul 2022 13:41:28.862
+	{
+		Regexp: `(?P<pid>\d+):(?P<role>\w) (?P<date>\d{2} \w{3} \d{4} \d{2}:\d{2}:\d{2}[\.,]\d{3}) (?P<level>\S) (?s)(?P<message>.*)(?-s)[$\n]?`,
+		Time:   []string{"date"},
+		Layout: "02 Jan 2006 15:04:05.000",
+		Levels: map[string]string{".": "debug", "-": "debug", "*": "info", "#": "warn"},
+	},
+	{
+		Regexp: `^(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}[\.,]\d{3} [-+]\d{4}) (?P<thread>\S*) : (?P<level>\w+)\s* (?P<class>\S+) - (?s)(?P<message>.*)(?-s)[$\n]?`,
+		Time:   []string{"date"},
+		Layout: "2006-01-02 15:04:05.000 -0700",
+	},
+	// elasticsearch: [2022-07-28T13:41:28,862]
+	{
+		Regexp: `^\[(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})\]\[(?P<level>\w+)\s*\]\[(?P<logger>\S*)\s*\] \[(?P<node>\S*)\s*\](?s)(?P<message>.*)(?-s)[$\n]?`,
+		Time:   []string{"date"},
+		Layout: "2006-01-02T15:04:05.000",
+	},
+	// postgres: 2022-07-28 13:41:28.862 UTC [1234] LOG:  checkpoint starting: time
+	{
+		Regexp: `^(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3} [A-Z]+) (?P<prefix>.*?)(?P<level>DEBUG[1-5]|LOG|INFO|NOTICE|WARNING|ERROR|FATAL|PANIC|STATEMENT|DETAIL|HINT|CONTEXT|QUERY|LOCATION):  (?s)(?P<message>.*)(?-s)[$\n]?`,
+		Time:   []string{"date"},
+		Layout: "2006-01-02 15:04:05.000 MST",
+		Levels: postgresLevels,
+	},
+}
+
+// julLevels are the java.util.logging levels tomcat writes that aren't shared with other processes.
+var julLevels = map[string]string{
+	"config": "info",
+	"fine":   "debug",
+	"finer":  "trace",
+	"finest": "trace",
+}
+
+// postgresLevels are postgres' message severities. The lines that detail a message, e.g. STATEMENT, take the
+// level of a log line.
+var postgresLevels = map[string]string{
+	"debug1": "debug", "debug2": "debug", "debug3": "debug", "debug4": "debug", "debug5": "debug",
+	"log":       "info",
+	"notice":    "info",
+	"statement": "info",
+	"detail":    "info",
+	"hint":      "info",
+	"context":   "info",
+	"query":     "info",
+	"location":  "info",
+}
+
 // GetLogFormat returns the log format for the given file.
-func (i instance) GetLogFormat(file string) string {
+func (i instance) GetLogFormat(file string) logformat.Format {
 	line, err := firstLine(file)
 	if err != nil {
-		return ""
+		return logformat.Format{}
 	}
 
 	// Is this a JSON format? We test this first because some log4j2-based processes log the message in json
 	// with a log4j2 format of just the message.
 	if line[0] == '{' {
-		return "json"
+		return logformat.Format{Regexp: logformat.JSON}
 	}
 
-	// Does this file have a dedicated format?
-	namedLogFormats := i.Config().GetStringMapString("logs.formats.named")
-	for name, format := range namedLogFormats {
-		if strings.Contains(file, name) {
-			return format
+	// Does this file have a dedicated format? Its name is either part of the file's path, or a pattern matching
+	// the file's name. The longest name is the most specific, e.g. *_deprecation.log rather than *.log.
+	namedLogFormats, _ := i.Config().Get("logs.formats.named").(map[string]logformat.Format)
+	var named string
+	for name := range namedLogFormats {
+		if len(name) <= len(named) {
+			continue
 		}
+		if ok, _ := filepath.Match(name, filepath.Base(file)); ok || strings.Contains(file, name) {
+			named = name
+		}
+	}
+	if named != "" {
+		return namedLogFormats[named]
 	}
 
 	// Does this file match a generic format?
-	patterns := []string{
-		`^\[(?P<date>\w{3} \w{3} \d{2} \d{2}:\d{2}:\d{2}[\.,]\d{6} \d{4})\] \[(?P<module>\S*):(?P<level>\w+)\] \[pid (?P<pid>\d+):tid (?P<tid>\d+)\] (?s)(?P<message>.*)(?-s)[$\n]?`,
-		`(?P<level>\w+)\s* (?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}[\.,]\d{3} [+-]\d{4}) (?P<thread>\S*) : (?P<class>\S+) - (?s)(?P<message>.*)(?-s)[$\n]?`,
-		`^(?P<date>\d{2}-\w{3}-\d{4} \d{2}:\d{2}:\d{2}[\.,]\d{3}) (?P<level>\w+) \[(?P<thread>.*)\] (?P<class>\S+) (?s)(?P<message>.*)(?-s)[$\n]?`,
-		`^\[(?P<pid>\d+)\] \[(?P<level>\w+)\] (?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}[\.,]\d{3} [+-]\d{4}) : (?s)(?P<message>.*)(?-s)[$\n]?`,
-		`(?P<pid>\d+):(?P<role>\w) (?P<date>\d{2} \w{3} \d{4} \d{2}:\d{2}:\d{2}[\.,]\d{3}) (?P<level>\S) (?s)(?P<message>.*)(?-s)[$\n]?`,
-		`^(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}[\.,]\d{3} [-+]\d{4}) (?P<thread>\S*) : (?P<level>\w+)\s* (?P<class>\S+) - (?s)(?P<message>.*)(?-s)[$\n]?`,
-		`^\[(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})\]\[(?P<level>\w+)\s*\]\[(?P<logger>\S*)\s*\] \[(?P<node>\S*)\s*\](?s)(?P<message>.*)(?-s)[$\n]?`,
-	}
-	patterns = append(i.Config().GetStringSlice("logs.formats.generic"), patterns...)
-	for _, format := range patterns {
-		if regexp.MustCompile(format).MatchString(line) {
+	for _, format := range genericFormats {
+		if m, err := matcher.Cached(format.Regexp); err == nil && m.MatchString(line) {
 			return format
 		}
 	}
 
-	// Otherwise, we don't know what the format is, so return an empty string.
-	return ""
+	// Otherwise, we don't know what the format is, so return an empty format.
+	return logformat.Format{}
 }
 
 func firstLine(file string) (string, error) {
@@ -134,42 +204,43 @@ func FromConfig(directory string) (*instance, error) {
 		}
 		return nil, fmt.Errorf("read config %s: %w", filepath.Join(directory, "workgroup.yml"), err)
 	}
-	namedFormats := make(map[string]string)
+	namedFormats := make(map[string]logformat.Format)
 	dirEntries, err := os.ReadDir(directory)
 	if err != nil {
 		return nil, fmt.Errorf("read directory %s: %w", directory, err)
 	}
-	for _, entry := range dirEntries { // Sometimes we'll have more than one with this pattern
-		if strings.Contains(entry.Name(), "log4j2.xml") {
-			if _, err := os.Stat(filepath.Join(directory, entry.Name())); err == nil {
-				formats, err := GetLog4j2Config(filepath.Join(directory, entry.Name()))
-				if err != nil {
-					return nil, fmt.Errorf("get log4j2 config from %s: %w", filepath.Join(directory, entry.Name()), err)
-				}
-				for name, format := range formats {
-					namedFormats[name] = format
-				}
+	for _, entry := range dirEntries { // Sometimes we'll have more than one of each, e.g. controlapp.log4j2.xml
+		path := filepath.Join(directory, entry.Name())
+		switch configKind(entry.Name()) {
+		case "log4j2":
+			log4j2Formats, err := GetLog4j2Config(path)
+			if err != nil {
+				return nil, fmt.Errorf("get log4j2 config from %s: %w", path, err)
+			}
+			for name, format := range log4j2Formats {
+				namedFormats[name] = format
+			}
+		case "log4j":
+			log4jFormats, err := GetLog4jConfig(path)
+			if err != nil {
+				return nil, fmt.Errorf("get log4j config from %s: %w", path, err)
+			}
+			for name, format := range log4jFormats {
+				namedFormats[name] = format
 			}
-		}
-	}
-	if len(namedFormats) != 0 {
-		cfg.Set("logs.formats.named", namedFormats)
-	}
-	var formats []string
-	if _, err := os.Stat(filepath.Join(directory, "log4j.xml")); err == nil {
-		formats, err = GetLog4jConfig(filepath.Join(directory, "log4j.xml"))
-		if err != nil {
-			return nil, fmt.Errorf("get log4j config from %s: %w", filepath.Join(directory, "log4j.xml"), err)
 		}
 	}
 	if _, err := os.Stat(filepath.Join(directory, "httpd.conf")); err == nil {
-		formats, err = GetHttpdConfig(filepath.Join(directory, "httpd.conf"))
+		httpdFormats, err := GetHttpdConfig(filepath.Join(directory, "httpd.conf"))
 		if err != nil {
 			return nil, fmt.Errorf("get httpd config from %s: %w", filepath.Join(directory, "httpd.conf"), err)
 		}
+		for name, format := range httpdFormats {
+			namedFormats[name] = format
+		}
 	}
-	if len(formats) != 0 {
-		cfg.Set("logs.formats.generic", formats)
+	if len(namedFormats) != 0 {
+		cfg.Set("logs.formats.named", namedFormats)
 	}
 
 	i := instance{
@@ -178,7 +249,21 @@ func FromConfig(directory string) (*instance, error) {
 	return &i, nil
 }
 
-func GetLog4j2Config(path string) (map[string]string, error) {
+// configKind returns the logging library a configuration file is for, log4j or log4j2, from its name, e.g.
+// log4j.properties or controlapp.log4j2.yaml, or "" if it's neither.
+func configKind(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	switch {
+	case strings.HasSuffix(base, "log4j2") && slices.Contains([]string{".xml", ".properties", ".yaml", ".yml", ".json"}, ext):
+		return "log4j2"
+	case strings.HasSuffix(base, "log4j") && (ext == ".xml" || ext == ".properties"):
+		return "log4j"
+	}
+	return ""
+}
+
+func GetLog4j2Config(path string) (map[string]logformat.Format, error) {
 	formats, err := log4j2.GetFormats(path)
 	if err != nil && strings.Contains(err.Error(), "invalid configuration") {
 		return nil, ErrInvalidConfigFile
@@ -189,7 +274,7 @@ func GetLog4j2Config(path string) (map[string]string, error) {
 	return formats, nil
 }
 
-func GetLog4jConfig(path string) ([]string, error) {
+func GetLog4jConfig(path string) (map[string]logformat.Format, error) {
 	formats, err := log4j.GetFormats(path)
 	if err != nil && strings.Contains(err.Error(), "invalid configuration") {
 		return nil, ErrInvalidConfigFile
@@ -200,7 +285,7 @@ func GetLog4jConfig(path string) ([]string, error) {
 	return formats, nil
 }
 
-func GetHttpdConfig(path string) ([]string, error) {
+func GetHttpdConfig(path string) (map[string]logformat.Format, error) {
 	formats, err := httpd.GetFormats(path)
 	if err != nil && strings.Contains(err.Error(), "invalid configuration") {
 		return nil, ErrInvalidConfigFile
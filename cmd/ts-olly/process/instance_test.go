@@ -2,10 +2,15 @@ package process_test
 
 import (
 	"github.com/highperformance-tech/ts-olly/cmd/ts-olly/process"
+	"github.com/highperformance-tech/ts-olly/internal/httpd"
+	"github.com/highperformance-tech/ts-olly/internal/matcher"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestFromConfig(t *testing.T) {
@@ -51,6 +56,34 @@ func TestFromConfig(t *testing.T) {
 			}
 		}
 	})
+	t.Run("log4j and log4j2 properties are discovered", func(t *testing.T) {
+		p, err := process.FromConfig("testdata/valid/indexandsearchserver_0.20221.22.0712.0324")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		format := p.GetLogFormat("testdata/logs/indexandsearchserver/tableau_deprecation.log")
+		if !strings.HasPrefix(format.Regexp, `\[(?P<date>`) {
+			t.Errorf("expected the format of log4j2.properties' deprecation appender, got %s", format.Regexp)
+		}
+		p, err = process.FromConfig("testdata/valid/activemqserver_0.20221.22.0712.0324")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// log4j.properties' logfile appender writes activemq.log
+		format = p.GetLogFormat("testdata/logs/activemqserver/activemq.log")
+		line := "2022-07-28 13:41:28,862 | INFO  | Apache ActiveMQ 5.16.4 (localhost, ID:node1-37913-1659015688601-0:1) started | org.apache.activemq.broker.BrokerService | main"
+		re := regexp.MustCompile(format.Regexp)
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("expected the format of log4j.properties' logfile appender to match, got %s", format.Regexp)
+		}
+		if level, logger := format.Level(m[re.SubexpIndex("level")]), m[re.SubexpIndex("logger")]; level != "info" || logger != "org.apache.activemq.broker.BrokerService" {
+			t.Errorf("expected info from org.apache.activemq.broker.BrokerService, got %q from %q", level, logger)
+		}
+		if ts, ok := format.ParseTime(m[re.SubexpIndex("date")]); !ok || ts.Year() != 2022 || ts.Nanosecond() != 862e6 {
+			t.Errorf("unexpected time %v", ts)
+		}
+	})
 	t.Run("invalid configuration returns error", func(t *testing.T) {
 		_, err := process.FromConfig("testdata/invalid")
 		if err != process.ErrInvalidConfigFile {
@@ -90,6 +123,25 @@ func TestLog4j2Config(t *testing.T) {
 			t.Errorf("expected no error, got %v", err)
 		}
 	})
+	t.Run("every shipped configuration parses to a valid regexp with a time layout", func(t *testing.T) {
+		for _, pattern := range []string{"testdata/valid/*/log4j2.xml", "testdata/valid/*/controlapp.log4j2.xml", "testdata/valid/*/log4j2.properties"} {
+			paths, _ := filepath.Glob(pattern)
+			for _, path := range paths {
+				formats, err := process.GetLog4j2Config(path)
+				if err != nil {
+					t.Fatalf("%s: %v", path, err)
+				}
+				for name, format := range formats {
+					if _, err := regexp.Compile(format.Regexp); err != nil {
+						t.Errorf("%s: invalid regexp for %s: %v", path, name, err)
+					}
+					if len(format.Time) > 0 && format.Layout == "" {
+						t.Errorf("%s: expected a time layout for %s", path, name)
+					}
+				}
+			}
+		}
+	})
 	t.Run("invalid configuration returns error", func(t *testing.T) {
 		_, err := process.GetLog4j2Config("testdata/invalid/bad-log4j2.xml")
 		if err != process.ErrInvalidConfigFile {
@@ -105,6 +157,20 @@ func TestLog4jConfig(t *testing.T) {
 			t.Errorf("expected no error, got %v", err)
 		}
 	})
+	t.Run("the dates of every shipped configuration have a time layout", func(t *testing.T) {
+		paths, _ := filepath.Glob("testdata/valid/*/log4j.*")
+		for _, path := range paths {
+			formats, err := process.GetLog4jConfig(path)
+			if err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			for _, format := range formats {
+				if len(format.Time) > 0 && format.Layout == "" {
+					t.Errorf("%s: expected a time layout for %s", path, format.Regexp)
+				}
+			}
+		}
+	})
 	t.Run("invalid configuration returns error", func(t *testing.T) {
 		_, err := process.GetLog4jConfig("testdata/invalid/bad-log4j.xml")
 		if err != process.ErrInvalidConfigFile {
@@ -137,9 +203,13 @@ func TestInstance_GetLogFormat(t *testing.T) {
 	t.Run("named log format", func(t *testing.T) {
 		logfile := "testdata/logs/tabadmincontroller/tabadmincontroller_node1-0.log"
 		logFormat := i.GetLogFormat(logfile)
-		want := "(?P<date>\\d{2}\\d{2}-\\d{2}-\\d{2} \\d{2}:\\d{2}:\\d{2}\\.\\d{3} [+-]\\d{4}) (?P<pid>.*?) (?P<thread>\\S*) : (?P<level>\\w+)\\s* (?P<logger>\\S+) - (?s)(?P<message>.*)(?-s)"
-		if logFormat != want {
-			t.Errorf("expected log format to be %s, got %s", want, logFormat)
+		want := "(?P<date>\\d{4}-\\d{2}-\\d{2} \\d{2}:\\d{2}:\\d{2}\\.\\d{3} [+-]\\d{4}) (?P<pid>.*?) (?P<thread>\\S*) : (?P<level>\\w+)\\s* (?P<logger>\\S+) - (?s)(?P<message>.*)(?-s)"
+		if logFormat.Regexp != want {
+			t.Errorf("expected log format to be %s, got %s", want, logFormat.Regexp)
+		}
+		ts, ok := logFormat.ParseTime("2022-08-03 00:09:31.809 +0000")
+		if !ok || !ts.Equal(time.Date(2022, 8, 3, 0, 9, 31, 809e6, time.UTC)) {
+			t.Errorf("expected the format's time layout to parse its dates, got %v", ts)
 		}
 	})
 
@@ -147,8 +217,8 @@ func TestInstance_GetLogFormat(t *testing.T) {
 		logfile := "testdata/logs/tabadmincontroller/tabadmincontroller-metrics_node1-0.log"
 		logFormat := i.GetLogFormat(logfile)
 		want := "json"
-		if logFormat != want {
-			t.Errorf("expected log format to be %s, got %s", want, logFormat)
+		if logFormat.Regexp != want {
+			t.Errorf("expected log format to be %s, got %s", want, logFormat.Regexp)
 		}
 	})
 
@@ -224,7 +294,7 @@ func TestInstance_GetLogFormat(t *testing.T) {
 					t.Fatalf("failed to create test file: %v", err)
 				}
 
-				got := i.GetLogFormat(testFile)
+				got := i.GetLogFormat(testFile).Regexp
 				if got != tt.wantFormat {
 					t.Errorf("GetLogFormat() = %q, want %q", got, tt.wantFormat)
 				}
@@ -232,6 +302,47 @@ func TestInstance_GetLogFormat(t *testing.T) {
 		}
 	})
 
+	t.Run("levels of generic log formats", func(t *testing.T) {
+		tempDir := t.TempDir()
+		tests := []struct {
+			name  string
+			line  string
+			level string
+		}{
+			{"httpd_error", "[Tue Aug 02 15:16:44.042345 2022] [mpm_winnt:notice] [pid 1234:tid 567] AH00354: Child: Starting 64 worker threads.", "info"},
+			{"httpd_error_trace", "[Tue Aug 02 15:16:44.042345 2022] [core:trace3] [pid 1234:tid 567] request.c(311): request authorized", "trace"},
+			{"redis", "1234:M 28 Jul 2022 13:41:28.862 * Ready to accept connections", "info"},
+			{"redis_warning", "1234:M 28 Jul 2022 13:41:28.862 # WARNING overcommit_memory is set to 0!", "warn"},
+			{"postgres", "2022-07-28 13:41:28.862 UTC [1234] LOG:  checkpoint starting: time", "info"},
+			{"postgres_panic", "2022-07-28 13:41:28.862 UTC [1234] PANIC:  could not write to file", "panic"},
+			{"tomcat", "28-Jul-2022 13:41:28.862 SEVERE [main] org.apache.catalina.startup.Catalina.start Server startup failed", "error"},
+			{"tomcat_fine", "28-Jul-2022 13:41:28.862 FINE [main] org.apache.catalina.core.StandardContext.filterStart Starting filters", "debug"},
+			{"tomcat_finest", "28-Jul-2022 13:41:28.862 FINEST [main] org.apache.tomcat.util.IntrospectionUtils.setProperty IntrospectionUtils: setProperty", "trace"},
+			{"tomcat_config", "28-Jul-2022 13:41:28.862 CONFIG [main] org.apache.catalina.startup.ContextConfig.processDefaultWebConfig Processing default web.xml", "info"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				testFile := tempDir + "/" + tt.name + ".log"
+				if err := os.WriteFile(testFile, []byte(tt.line+"\n"), 0644); err != nil {
+					t.Fatalf("failed to create test file: %v", err)
+				}
+				format := i.GetLogFormat(testFile)
+				re, err := matcher.Compile(format.Regexp)
+				if err != nil {
+					t.Fatalf("expected a generic format for %q, got %q: %v", tt.line, format.Regexp, err)
+				}
+				submatches, ok := re.SubmatchIndex(tt.line, nil)
+				if !ok {
+					t.Fatalf("expected %s to match %q", format.Regexp, tt.line)
+				}
+				j := re.SubexpIndex("level")
+				if got := format.Level(tt.line[submatches[2*j]:submatches[2*j+1]]); got != tt.level {
+					t.Errorf("expected level %q, got %q", tt.level, got)
+				}
+			})
+		}
+	})
+
 	//t.Run("generic log format", func(t *testing.T) {
 	// There do not seem to be any of these in the wild.
 	//})
@@ -245,9 +356,23 @@ func TestHttpdLogs(t *testing.T) {
 		}
 		logfile := "testdata/logs/httpd/access.2022_08_03_00_00_00.log"
 		logFormat := i.GetLogFormat(logfile)
-		want := `(?P<requested_hostname>\S+) (?P<remote_hostname>\S+) (?P<remote_user>\S+) (?P<timestamp>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}) \"(?P<timezone>[\+\-]\d{4})\" (?P<request_port>\d+) \"(?P<request>[^\"]+)\" \"(?P<xff>\S*)\" (?P<status>\d{3}) (?P<bytes>\d+|-) \"(?P<content_length>\d+|-)\" (?P<ms>\d+) (?P<unique_id>\S+) (?P<tableau_error_source>\S+) (?P<tableau_status_code>\S+) (?P<tableau_error_code>\S+) (?P<tableau_service_name>\S+) \"(?P<tableau_trace_id>\S+)\"`
-		if logFormat != want {
-			t.Errorf("expected log format to be %s, got %s", want, logFormat)
+		want := `(?P<requested_hostname>\S+) (?P<remote_hostname>\S+) (?P<remote_user>\S+) (?P<timestamp>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}) "(?P<timezone>[+-]\d{4})" (?P<request_port>\d+) "(?P<request>[^\"]+)" "(?P<xff>\S*)" (?P<status>\d{3}) (?P<bytes>\d+|-) "(?P<content_length>\d+|-)" (?P<ms>\d+) (?P<unique_id>\S+) (?P<tableau_error_source>\S+) (?P<tableau_status_code>\S+) (?P<tableau_error_code>\S+) (?P<tableau_service_name>\S+) "(?P<tableau_trace_id>\S+)"`
+		if logFormat.Regexp != want {
+			t.Errorf("expected log format to be %s, got %s", want, logFormat.Regexp)
+		}
+		ts, ok := logFormat.ParseTime("2022-08-02T15:16:44.042", "-0700")
+		if !ok || !ts.Equal(time.Date(2022, 8, 2, 22, 16, 44, 42e6, time.UTC)) {
+			t.Errorf("expected the format's time layout to parse its timestamp and timezone, got %v", ts)
+		}
+	})
+	t.Run("httpd error log", func(t *testing.T) {
+		i, err := process.FromConfig("testdata/valid/gateway_0.20221.22.0712.0324")
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		logFormat := i.GetLogFormat("testdata/logs/httpd/error.log")
+		if logFormat.Regexp != httpd.ErrorFormat.Regexp {
+			t.Errorf("expected the ErrorLog's file to have the error format, got %s", logFormat.Regexp)
 		}
 	})
 }
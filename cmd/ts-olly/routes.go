@@ -1,8 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/VictoriaMetrics/metrics"
+	"github.com/highperformance-tech/ts-olly/internal/filefilter"
+	"github.com/highperformance-tech/ts-olly/internal/sink"
 	"net/http"
+	"slices"
+	"strconv"
 )
 
 func (app *application) routes() http.Handler {
@@ -10,5 +16,43 @@ func (app *application) routes() http.Handler {
 	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
 		metrics.WritePrometheus(w, true)
 	})
+	mux.HandleFunc("/health", app.healthHandler)
+	mux.HandleFunc("/files", app.filesHandler)
 	return mux
 }
+
+// healthHandler reports the health of every sink and of the logs directory's watcher, and responds with 503
+// Service Unavailable if any sink or the watcher is unhealthy.
+func (app *application) healthHandler(w http.ResponseWriter, req *http.Request) {
+	health := make(map[string]sink.Health, len(app.sinks))
+	status := http.StatusOK
+	for name, s := range app.sinks {
+		health[name] = s.Health()
+		if !health[name].Healthy {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	watcher := app.watches.Health()
+	if !watcher.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"sinks": health, "watcher": watcher})
+}
+
+// filesHandler lists the log files found and whether each is tailed, with the rule that decided it. The query
+// parameter included=false lists only the excluded files, and included=true only the tailed ones.
+func (app *application) filesHandler(w http.ResponseWriter, req *http.Request) {
+	files := app.files.All()
+	if included := req.URL.Query().Get("included"); included != "" {
+		want, err := strconv.ParseBool(included)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid included %q", included), http.StatusBadRequest)
+			return
+		}
+		files = slices.DeleteFunc(files, func(r filefilter.Record) bool { return r.Included != want })
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"files": files})
+}
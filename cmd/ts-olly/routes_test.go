@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	app := &application{}
+	rec := httptest.NewRecorder()
+	app.healthHandler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rec.Code)
+	}
+
+	app.watches.observe(fmt.Errorf("add watch: %w", syscall.ENOSPC), true)
+	rec = httptest.NewRecorder()
+	app.healthHandler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected exhausted watches to fail the health check, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/highperformance-tech/ts-olly/internal/sink"
+	_ "github.com/highperformance-tech/ts-olly/internal/sink/elasticsearch"
+	_ "github.com/highperformance-tech/ts-olly/internal/sink/loki"
+	_ "github.com/highperformance-tech/ts-olly/internal/sink/otlp"
+	_ "github.com/highperformance-tech/ts-olly/internal/sink/splunk"
+	"github.com/highperformance-tech/ts-olly/internal/spool"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+// setOutputDefaults configures where output goes when the config file doesn't say otherwise:
+// both the parsed log stream and ts-olly's own logs are written to stdout.
+func setOutputDefaults(settings *viper.Viper) {
+	settings.SetDefault("output.sinks", []string{"stdout"})
+	settings.SetDefault("output.selflog", "stdout")
+	settings.SetDefault("output.batch_size", 500)
+	settings.SetDefault("output.flush_interval", time.Second)
+	settings.SetDefault("output.spool.segment_size", 16<<20)
+	settings.SetDefault("output.spool.max_size", 1<<30)
+	settings.SetDefault("output.spool.policy", "block")
+}
+
+// openSpool opens the spool configured under output.spool, or returns nil if output.spool.dir isn't set.
+func openSpool(settings *viper.Viper) (*spool.Spool, error) {
+	dir := settings.GetString("output.spool.dir")
+	if dir == "" {
+		return nil, nil
+	}
+	policy, err := spool.ParsePolicy(settings.GetString("output.spool.policy"))
+	if err != nil {
+		return nil, err
+	}
+	sp, err := spool.Open(dir, spool.Options{
+		SegmentBytes: settings.GetInt64("output.spool.segment_size"),
+		MaxBytes:     settings.GetInt64("output.spool.max_size"),
+		Policy:       policy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("open spool: %w", err)
+	}
+	return sp, nil
+}
+
+// openSinks creates and opens the named sinks. Each sink is configured under sinks.<name>, and its type is
+// taken from sinks.<name>.type, defaulting to the name itself so that e.g. "stdout" needs no configuration.
+func openSinks(ctx context.Context, settings *viper.Viper, names ...string) (map[string]sink.Sink, error) {
+	sinks := make(map[string]sink.Sink)
+	for _, name := range names {
+		if _, ok := sinks[name]; ok {
+			continue
+		}
+		cfg := settings.Sub("sinks." + name)
+		if cfg == nil {
+			cfg = viper.New()
+		}
+		typ := cfg.GetString("type")
+		if typ == "" {
+			typ = name
+		}
+		s, err := sink.New(typ, cfg)
+		if err != nil {
+			closeSinks(sinks)
+			return nil, fmt.Errorf("sink %s: %w", name, err)
+		}
+		if err := s.Open(ctx); err != nil {
+			closeSinks(sinks)
+			return nil, fmt.Errorf("open sink %s: %w", name, err)
+		}
+		sinks[name] = s
+	}
+	return sinks, nil
+}
+
+func closeSinks(sinks map[string]sink.Sink) error {
+	var errs []error
+	for name, s := range sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close sink %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newRecord encodes a line the same way ts-olly has always written it to stdout, and wraps it in a record
+// carrying the metadata sinks need to route and label it.
+func newRecord(logger zerolog.Logger, node string, l line) sink.Record {
+	buf := &bytes.Buffer{}
+	outputLine(logger.Output(buf), l)
+	r := sink.Record{
+		Time:         l.Time,
+		ObservedTime: l.Time,
+		Node:         node,
+		Filename:     l.filename,
+		FileID:       l.fileId.String(),
+		Process:      l.processName,
+		ProcessID:    l.processId,
+		Component:    l.component,
+		Line:         l.Num,
+		Offset:       l.SeekInfo.Offset,
+		JSON:         bytes.TrimRight(buf.Bytes(), "\n"),
+		Ack:          l.ack,
+	}
+	if !l.timestamp.IsZero() {
+		r.Time = l.timestamp
+	}
+	if l.Err != nil {
+		r.Level = zerolog.LevelErrorValue
+		r.Message = l.Err.Error()
+	} else {
+		r.Level = l.Level()
+		r.Message = l.Text
+	}
+	if !singleObject(r.JSON) {
+		// Sinks frame records by their JSON, so anything else outputLine writes is replaced by the record itself
+		invalidRecords.Inc()
+		r.JSON = recordJSON(r)
+	}
+	return r
+}
+
+var invalidRecords = metrics.NewCounter("tslogs_records_invalid_total")
+
+// singleObject says whether b holds exactly one JSON object.
+func singleObject(b []byte) bool {
+	return len(b) > 0 && b[0] == '{' && json.Valid(b)
+}
+
+// recordJSON encodes a record's metadata and message as a single JSON object.
+func recordJSON(r sink.Record) []byte {
+	b, _ := json.Marshal(map[string]any{
+		"level":     r.Level,
+		"node":      r.Node,
+		"filename":  r.Filename,
+		"fileid":    r.FileID,
+		"process":   r.Process,
+		"processid": r.ProcessID,
+		"component": r.Component,
+		"line":      r.Line,
+		"offset":    r.Offset,
+		"message":   r.Message,
+	})
+	return b
+}
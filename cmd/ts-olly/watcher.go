@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/fsnotify/fsnotify"
+)
+
+var (
+	watcherOverflows = metrics.NewCounter("tslogs_watcher_overflows_total")
+	watcherErrors    = metrics.NewCounter("tslogs_watcher_errors_total")
+	watcherFallbacks = metrics.NewCounter("tslogs_watcher_fallbacks_total")
+)
+
+// watcherHealth is the health of the logs directory's watcher. It's unhealthy once the system's watches or file
+// descriptors are exhausted, e.g. by fs.inotify.max_user_watches, as directories are then polled rather than
+// watched.
+type watcherHealth struct {
+	Healthy   bool   `json:"healthy"`
+	Exhausted bool   `json:"exhausted"`
+	Overflows uint64 `json:"overflows"`
+	Errors    uint64 `json:"errors"`
+	Polled    int    `json:"polled_dirs"` // directories polled because they couldn't be watched
+	LastError string `json:"last_error,omitempty"`
+}
+
+// watcherTracker keeps the watcher's health up to date. The zero value is healthy.
+type watcherTracker struct {
+	mu     sync.Mutex
+	health watcherHealth
+}
+
+// Health returns the watcher's health.
+func (t *watcherTracker) Health() watcherHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := t.health
+	h.Healthy = !h.Exhausted
+	return h
+}
+
+// observe records an error of the watcher. fallback says whether a directory is polled because of it.
+func (t *watcherTracker) observe(err error, fallback bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.health.LastError = err.Error()
+	switch {
+	case errors.Is(err, fsnotify.ErrEventOverflow):
+		t.health.Overflows++
+		watcherOverflows.Inc()
+	default:
+		t.health.Errors++
+		watcherErrors.Inc()
+	}
+	if exhausted(err) {
+		t.health.Exhausted = true
+	}
+	if fallback {
+		t.health.Polled++
+		watcherFallbacks.Inc()
+	}
+}
+
+// exhausted says whether err is due to the system's watches or file descriptors running out.
+func exhausted(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE)
+}
+
+// dirWatcher is the part of fsnotify.Watcher that watch uses.
+type dirWatcher interface {
+	Add(name string) error
+}
+
+// watch watches a directory of the logs directory for changes, or polls it if it's selected for polling or
+// can't be watched because the system's watches are exhausted. Directories that can't be watched for other
+// reasons, e.g. because they were removed or aren't readable, are skipped.
+func (app *application) watch(w dirWatcher, dir string) {
+	if app.poller.Polls(dir) || app.pollsDir(dir) {
+		app.poller.Add(dir)
+		return
+	}
+	err := w.Add(dir)
+	switch {
+	case err == nil:
+	case exhausted(err):
+		app.watches.observe(err, true)
+		app.logger.Warn().Err(err).Str("component", "logprocessor").Str("directory", dir).Msg("could not watch directory. polling it instead")
+		app.poller.Add(dir)
+	default:
+		app.watches.observe(err, false)
+		app.logger.Warn().Err(err).Str("component", "logprocessor").Str("directory", dir).Msg("could not watch directory")
+	}
+}
+
+// watchErrors records the watcher's errors until ctx is done or the watcher is closed. After events are lost to
+// an overflow of the watcher's queue, every directory of the logs directory is sent to rescan, so that files
+// created or written meanwhile aren't missed.
+func (app *application) watchErrors(ctx context.Context, w *fsnotify.Watcher, rescan chan<- event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			app.watches.observe(err, false)
+			if !errors.Is(err, fsnotify.ErrEventOverflow) {
+				app.logger.Err(err).Str("component", "logprocessor").Msg("watcher error")
+				continue
+			}
+			app.logger.Warn().Err(err).Str("component", "logprocessor").Msg("watcher events lost. rescanning the logs directory")
+			for _, e := range app.rescan() {
+				select {
+				case <-ctx.Done():
+					return
+				case rescan <- e:
+				}
+			}
+		}
+	}
+}
+
+// rescan returns a Create event for every directory of the logs directory, whose files are then scanned by
+// handleDirs.
+func (app *application) rescan() []event {
+	var events []event
+	filepath.WalkDir(app.config.logsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			app.logger.Warn().Err(err).Str("component", "logprocessor").Str("path", path).Msg("could not rescan")
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		fid, err := getFileId(path)
+		if err != nil {
+			return nil
+		}
+		events = append(events, event{fsnotify.Event{Name: path, Op: fsnotify.Create}, fid})
+		return nil
+	})
+	return events
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/highperformance-tech/ts-olly/internal/poller"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func TestWatcherTracker(t *testing.T) {
+	var tracker watcherTracker
+	if h := tracker.Health(); !h.Healthy {
+		t.Errorf("expected the zero value to be healthy, got %+v", h)
+	}
+	tracker.observe(fsnotify.ErrEventOverflow, false)
+	if h := tracker.Health(); !h.Healthy || h.Overflows != 1 || h.Errors != 0 {
+		t.Errorf("expected an overflow to be counted without being unhealthy, got %+v", h)
+	}
+	tracker.observe(fmt.Errorf("add watch: %w", syscall.ENOENT), false)
+	if h := tracker.Health(); !h.Healthy || h.Errors != 1 {
+		t.Errorf("expected a missing directory to be counted without being unhealthy, got %+v", h)
+	}
+	tracker.observe(fmt.Errorf("add watch: %w", syscall.ENOSPC), true)
+	h := tracker.Health()
+	if h.Healthy || !h.Exhausted || h.Errors != 2 || h.Polled != 1 || h.LastError == "" {
+		t.Errorf("expected exhausted watches to be unhealthy, got %+v", h)
+	}
+
+	tracker = watcherTracker{}
+	tracker.observe(fmt.Errorf("add watch: %w", syscall.EMFILE), true)
+	if h := tracker.Health(); h.Healthy || !h.Exhausted {
+		t.Errorf("expected exhausted file descriptors to be unhealthy, got %+v", h)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	logsDir := t.TempDir()
+	for _, dir := range []string{"httpd", "vizqlserver/Logs"} {
+		if err := os.MkdirAll(filepath.Join(logsDir, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settings := viper.New()
+	settings.Set("polling.dirs", []string{"httpd"})
+	app := &application{
+		config:   config{logsDir: logsDir},
+		logger:   zerolog.New(os.Stderr).Level(zerolog.Disabled),
+		settings: settings,
+		poller:   poller.New(),
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	app.watch(w, filepath.Join(logsDir, "httpd"))
+	app.watch(w, filepath.Join(logsDir, "vizqlserver"))
+	if !app.poller.Polls(filepath.Join(logsDir, "httpd")) || app.poller.Polls(filepath.Join(logsDir, "vizqlserver")) {
+		t.Error("expected only the directory selected for polling to be polled")
+	}
+	if got := w.WatchList(); len(got) != 1 || got[0] != filepath.Join(logsDir, "vizqlserver") {
+		t.Errorf("expected the other directory to be watched, got %v", got)
+	}
+
+	// A directory that no longer exists is skipped
+	app.watch(w, filepath.Join(logsDir, "missing"))
+	if app.poller.Polls(filepath.Join(logsDir, "missing")) {
+		t.Error("expected a missing directory not to be polled")
+	}
+	if h := app.watches.Health(); !h.Healthy || h.Polled != 0 || h.Errors != 1 {
+		t.Errorf("expected the error to be recorded without a fallback, got %+v", h)
+	}
+
+	// A directory that can't be watched because the watches are exhausted is polled instead
+	app.watch(exhaustedWatcher{}, filepath.Join(logsDir, "vizqlserver", "Logs"))
+	if !app.poller.Polls(filepath.Join(logsDir, "vizqlserver", "Logs")) {
+		t.Error("expected a directory that can't be watched to be polled")
+	}
+	if h := app.watches.Health(); h.Healthy || h.Polled != 1 || h.Errors != 2 {
+		t.Errorf("expected the fallback to be recorded, got %+v", h)
+	}
+}
+
+// exhaustedWatcher fails to watch any directory as if fs.inotify.max_user_watches were reached.
+type exhaustedWatcher struct{}
+
+func (exhaustedWatcher) Add(string) error {
+	return fmt.Errorf("add watch: %w", syscall.ENOSPC)
+}
+
+func TestWatchErrors(t *testing.T) {
+	logsDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(logsDir, "vizqlserver"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	app := &application{
+		config: config{logsDir: logsDir},
+		logger: zerolog.New(os.Stderr).Level(zerolog.Disabled),
+	}
+	w := &fsnotify.Watcher{Errors: make(chan error, 1)}
+	rescan := make(chan event)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go app.watchErrors(ctx, w, rescan)
+
+	w.Errors <- fsnotify.ErrEventOverflow
+	got := make(map[string]bool)
+	for range 2 {
+		select {
+		case e := <-rescan:
+			if e.Op != fsnotify.Create || e.fileId == 0 {
+				t.Errorf("expected a directory's Create event, got %v", e)
+			}
+			got[e.Name] = true
+		case <-ctx.Done():
+			t.Fatal("expected the logs directory to be rescanned")
+		}
+	}
+	if !got[logsDir] || !got[filepath.Join(logsDir, "vizqlserver")] {
+		t.Errorf("expected every directory to be rescanned, got %v", got)
+	}
+	if h := app.watches.Health(); h.Overflows != 1 {
+		t.Errorf("expected the overflow to be recorded, got %+v", h)
+	}
+}
@@ -4,18 +4,25 @@ go 1.25.0
 
 require (
 	github.com/VictoriaMetrics/metrics v1.44.0
+	github.com/bmatcuk/doublestar/v4 v4.10.2
 	github.com/fsnotify/fsnotify v1.10.1
 	github.com/go-viper/encoding/javaproperties v0.1.0
+	github.com/golang/snappy v1.0.0
+	github.com/magiconair/properties v1.8.10
 	github.com/nxadm/tail v1.4.11
 	github.com/rs/zerolog v1.35.1
 	github.com/spf13/viper v1.21.0
 	github.com/timtadh/lexmachine v0.2.3
-	golang.org/x/sys v0.46.0
+	go.opentelemetry.io/proto/otlp v1.10.0
+	go.yaml.in/yaml/v3 v3.0.4
+	golang.org/x/sys v0.47.0
+	google.golang.org/grpc v1.84.0
+	google.golang.org/protobuf v1.36.12
 )
 
 require (
 	github.com/go-viper/mapstructure/v2 v2.4.0 // indirect
-	github.com/magiconair/properties v1.8.10 // indirect
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.28.0 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/pelletier/go-toml/v2 v2.2.4 // indirect
@@ -27,7 +34,9 @@ require (
 	github.com/timtadh/data-structures v0.6.2 // indirect
 	github.com/valyala/fastrand v1.1.0 // indirect
 	github.com/valyala/histogram v1.2.0 // indirect
-	go.yaml.in/yaml/v3 v3.0.4 // indirect
-	golang.org/x/text v0.32.0 // indirect
+	golang.org/x/net v0.57.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20260706201446-f0a921348800 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260904194346-d0f1323225a4 // indirect
 	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
 )
@@ -0,0 +1,189 @@
+// Package checkpoint persists tail positions so that a restarted ts-olly resumes where it left off.
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// version is the on-disk format version of the checkpoint file.
+const version = 1
+
+// Checkpoint records how far into a file we have read.
+type Checkpoint struct {
+	FileID uint64 `json:"fileid"`
+	Device uint64 `json:"device"`
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Line   int    `json:"line"`
+}
+
+type file struct {
+	Version     int          `json:"version"`
+	Checkpoints []Checkpoint `json:"checkpoints"`
+}
+
+// Store is a set of checkpoints keyed by file ID. A Store with an empty path is kept in memory only.
+type Store struct {
+	path        string
+	mu          sync.Mutex
+	checkpoints map[uint64]Checkpoint
+	dirty       bool
+}
+
+// Open loads the checkpoints stored at path. A missing file yields an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:        path,
+		checkpoints: make(map[uint64]Checkpoint),
+	}
+	if path == "" {
+		return s, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint file %s: %w", path, err)
+	}
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("decode checkpoint file %s: %w", path, err)
+	}
+	if f.Version != version {
+		return nil, fmt.Errorf("unsupported checkpoint file version %d in %s", f.Version, path)
+	}
+	for _, c := range f.Checkpoints {
+		s.checkpoints[c.FileID] = c
+	}
+	return s, nil
+}
+
+// Path returns the location of the checkpoint file.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get returns the checkpoint for the given file ID.
+func (s *Store) Get(fileID uint64) (Checkpoint, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.checkpoints[fileID]
+	return c, ok
+}
+
+// Set stores c, replacing any previous checkpoint for the same file ID.
+func (s *Store) Set(c Checkpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.checkpoints[c.FileID]; ok && old == c {
+		return
+	}
+	s.checkpoints[c.FileID] = c
+	s.dirty = true
+}
+
+// Delete removes the checkpoint for the given file ID.
+func (s *Store) Delete(fileID uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.checkpoints[fileID]; !ok {
+		return
+	}
+	delete(s.checkpoints, fileID)
+	s.dirty = true
+}
+
+// All returns a copy of every checkpoint, ordered by file ID.
+func (s *Store) All() []Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+func (s *Store) snapshot() []Checkpoint {
+	checkpoints := make([]Checkpoint, 0, len(s.checkpoints))
+	for _, c := range s.checkpoints {
+		checkpoints = append(checkpoints, c)
+	}
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].FileID < checkpoints[j].FileID
+	})
+	return checkpoints
+}
+
+// Flush atomically writes the checkpoints to disk if they changed since the last flush.
+// The file is written to a temporary sibling, fsync'd, and renamed over the previous version.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	if s.path == "" || !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	b, err := json.Marshal(file{Version: version, Checkpoints: s.snapshot()})
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode checkpoints: %w", err)
+	}
+	if err := writeFileAtomic(s.path, b); err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run flushes the store every interval until ctx is cancelled, then flushes one final time.
+// Errors are passed to onError, which may be nil.
+func (s *Store) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	flush := func() {
+		if err := s.Flush(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			return
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary checkpoint file in %s: %w", dir, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temporary checkpoint file %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync temporary checkpoint file %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temporary checkpoint file %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename checkpoint file to %s: %w", path, err)
+	}
+	return syncDir(dir)
+}
@@ -0,0 +1,169 @@
+package checkpoint
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	t.Run("missing file yields empty store", func(t *testing.T) {
+		s, err := Open(filepath.Join(t.TempDir(), "checkpoints.json"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(s.All()) != 0 {
+			t.Errorf("expected no checkpoints, got %d", len(s.All()))
+		}
+	})
+
+	t.Run("checkpoints survive a flush and reopen", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoints.json")
+		s, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Checkpoint{FileID: 42, Device: 7, Path: "/logs/vizportal/vizportal_node1-0.log", Offset: 1024, Line: 12}
+		s.Set(want)
+		if err := s.Flush(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		reopened, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := reopened.Get(42)
+		if !ok {
+			t.Fatal("expected checkpoint for file 42")
+		}
+		if got != want {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("flush leaves no temporary files behind", func(t *testing.T) {
+		dir := t.TempDir()
+		s, err := Open(filepath.Join(dir, "checkpoints.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Set(Checkpoint{FileID: 1, Offset: 1})
+		if err := s.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("expected only the checkpoint file, got %d entries", len(entries))
+		}
+	})
+
+	t.Run("deleted checkpoints are not persisted", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoints.json")
+		s, _ := Open(path)
+		s.Set(Checkpoint{FileID: 1, Offset: 1})
+		s.Set(Checkpoint{FileID: 2, Offset: 2})
+		s.Delete(1)
+		if err := s.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		reopened, _ := Open(path)
+		if _, ok := reopened.Get(1); ok {
+			t.Error("expected checkpoint for file 1 to be deleted")
+		}
+		if _, ok := reopened.Get(2); !ok {
+			t.Error("expected checkpoint for file 2 to be kept")
+		}
+	})
+
+	t.Run("in-memory store does not touch disk", func(t *testing.T) {
+		s, err := Open("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Set(Checkpoint{FileID: 1, Offset: 1})
+		if err := s.Flush(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if _, ok := s.Get(1); !ok {
+			t.Error("expected checkpoint to be kept in memory")
+		}
+	})
+
+	t.Run("corrupt file returns error", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoints.json")
+		if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Open(path); err == nil {
+			t.Error("expected error for corrupt checkpoint file")
+		}
+	})
+
+	t.Run("run flushes on cancellation", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoints.json")
+		s, _ := Open(path)
+		s.Set(Checkpoint{FileID: 3, Offset: 30})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			s.Run(ctx, time.Hour, func(err error) { t.Errorf("unexpected flush error: %v", err) })
+			close(done)
+		}()
+		cancel()
+		<-done
+
+		reopened, _ := Open(path)
+		if c, ok := reopened.Get(3); !ok || c.Offset != 30 {
+			t.Errorf("expected checkpoint with offset 30, got %+v", c)
+		}
+	})
+}
+
+func TestTracker(t *testing.T) {
+	t.Run("checkpoint only advances over contiguous acknowledged entries", func(t *testing.T) {
+		s, _ := Open("")
+		tr := NewTracker(s)
+		ack1 := tr.Track(Checkpoint{FileID: 1, Offset: 10, Line: 1})
+		ack2 := tr.Track(Checkpoint{FileID: 1, Offset: 20, Line: 2})
+		ack3 := tr.Track(Checkpoint{FileID: 1, Offset: 30, Line: 3})
+		ack2()
+		if _, ok := s.Get(1); ok {
+			t.Fatal("expected no checkpoint while the first entry is unacknowledged")
+		}
+		ack1()
+		if c, _ := s.Get(1); c.Offset != 20 || c.Line != 2 {
+			t.Errorf("expected checkpoint at offset 20, got %+v", c)
+		}
+		if tr.Pending() != 1 {
+			t.Errorf("expected 1 pending entry, got %d", tr.Pending())
+		}
+		ack3()
+		ack3()
+		if c, _ := s.Get(1); c.Offset != 30 {
+			t.Errorf("expected checkpoint at offset 30, got %+v", c)
+		}
+		if tr.Pending() != 0 {
+			t.Errorf("expected no pending entries, got %d", tr.Pending())
+		}
+	})
+	t.Run("files are tracked independently", func(t *testing.T) {
+		s, _ := Open("")
+		tr := NewTracker(s)
+		tr.Track(Checkpoint{FileID: 1, Offset: 10})
+		ack := tr.Track(Checkpoint{FileID: 2, Offset: 5})
+		ack()
+		if c, ok := s.Get(2); !ok || c.Offset != 5 {
+			t.Errorf("expected file 2 to be checkpointed, got %+v", c)
+		}
+		if _, ok := s.Get(1); ok {
+			t.Error("expected file 1 not to be checkpointed")
+		}
+	})
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package checkpoint
+
+import (
+	"fmt"
+	"os"
+)
+
+// syncDir fsyncs the directory so that a rename within it survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open checkpoint directory %s: %w", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync checkpoint directory %s: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+package checkpoint
+
+// syncDir is a no-op on Windows, where directories cannot be opened for syncing and
+// MoveFileEx already flushes the rename.
+func syncDir(string) error {
+	return nil
+}
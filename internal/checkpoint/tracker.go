@@ -0,0 +1,71 @@
+package checkpoint
+
+import "sync"
+
+// Tracker advances checkpoints as entries are acknowledged. A file's checkpoint only moves past an entry once
+// that entry, and every entry read before it from the same file, has been acknowledged, so a restart never
+// skips an entry that hadn't been delivered.
+type Tracker struct {
+	store   *Store
+	mu      sync.Mutex
+	pending map[uint64][]*entry
+	count   int
+}
+
+type entry struct {
+	checkpoint Checkpoint
+	acked      bool
+}
+
+// NewTracker returns a tracker that stores checkpoints in store.
+func NewTracker(store *Store) *Tracker {
+	return &Tracker{
+		store:   store,
+		pending: make(map[uint64][]*entry),
+	}
+}
+
+// Track registers an entry that ends at c, in the order entries are read from the file, and returns the
+// function to call once the entry has been delivered. Calling it more than once has no further effect.
+func (t *Tracker) Track(c Checkpoint) (ack func()) {
+	e := &entry{checkpoint: c}
+	t.mu.Lock()
+	t.pending[c.FileID] = append(t.pending[c.FileID], e)
+	t.count++
+	t.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() { t.ack(e) })
+	}
+}
+
+func (t *Tracker) ack(e *entry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e.acked = true
+	id := e.checkpoint.FileID
+	entries := t.pending[id]
+	n := 0
+	for n < len(entries) && entries[n].acked {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	t.store.Set(entries[n-1].checkpoint)
+	t.count -= n
+	if n == len(entries) {
+		delete(t.pending, id)
+		return
+	}
+	clear(entries[:n])
+	t.pending[id] = entries[n:]
+}
+
+// Pending returns the number of entries that have been tracked but not yet acknowledged, or that are waiting
+// on an earlier entry from the same file.
+func (t *Tracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count
+}
@@ -0,0 +1,171 @@
+// Package filefilter decides which log files are tailed, by include and exclude rules that select files by their
+// path, process, component, age and size.
+package filefilter
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Action is what a rule does with the files it selects.
+type Action string
+
+const (
+	Include Action = "include"
+	Exclude Action = "exclude"
+)
+
+// Rule includes or excludes the files that match all of its criteria. Empty criteria match any file.
+type Rule struct {
+	Action     Action        `mapstructure:"action"`
+	Glob       string        `mapstructure:"glob"`        // a doublestar glob matched against the file's path in the logs directory
+	Regexp     string        `mapstructure:"regexp"`      // matched against the file's path in the logs directory
+	Process    string        `mapstructure:"process"`     // the process whose directory the file is in
+	Component  string        `mapstructure:"component"`   // the component of the process that writes the file
+	OlderThan  time.Duration `mapstructure:"older_than"`  // how long ago the file was last modified, at least
+	LargerThan int64         `mapstructure:"larger_than"` // the file's size in bytes, at least
+}
+
+// String describes the rule's criteria, e.g. exclude glob "**/*.gz".
+func (r Rule) String() string {
+	criteria := []string{string(r.Action)}
+	if r.Glob != "" {
+		criteria = append(criteria, fmt.Sprintf("glob %q", r.Glob))
+	}
+	if r.Regexp != "" {
+		criteria = append(criteria, fmt.Sprintf("regexp %q", r.Regexp))
+	}
+	if r.Process != "" {
+		criteria = append(criteria, fmt.Sprintf("process %q", r.Process))
+	}
+	if r.Component != "" {
+		criteria = append(criteria, fmt.Sprintf("component %q", r.Component))
+	}
+	if r.OlderThan > 0 {
+		criteria = append(criteria, "older than "+r.OlderThan.String())
+	}
+	if r.LargerThan > 0 {
+		criteria = append(criteria, fmt.Sprintf("larger than %d bytes", r.LargerThan))
+	}
+	return strings.Join(criteria, " ")
+}
+
+// File is a log file to decide on.
+type File struct {
+	Path      string    `json:"path"` // the file's path in the logs directory, with forward slashes
+	Process   string    `json:"process"`
+	Component string    `json:"component"`
+	ModTime   time.Time `json:"mod_time"`
+	Size      int64     `json:"size"`
+}
+
+// Decision says whether a file is tailed, and why.
+type Decision struct {
+	Included bool   `json:"included"`
+	Rule     int    `json:"rule,omitempty"` // the number of the rule that decided, from 1, or 0 if none matched
+	Reason   string `json:"reason"`
+}
+
+// Filter decides on files by the first of its rules that matches them, including files that none match.
+type Filter struct {
+	rules   []Rule
+	regexps []*regexp.Regexp
+	now     func() time.Time
+}
+
+// New returns a Filter of rules, in order.
+func New(rules []Rule) (*Filter, error) {
+	f := &Filter{rules: rules, regexps: make([]*regexp.Regexp, len(rules)), now: time.Now}
+	for i, r := range rules {
+		if r.Action != Include && r.Action != Exclude {
+			return nil, fmt.Errorf("file rule %d: unknown action %q (want include or exclude)", i+1, r.Action)
+		}
+		if r.Glob != "" && !doublestar.ValidatePattern(r.Glob) {
+			return nil, fmt.Errorf("file rule %d: invalid glob %q", i+1, r.Glob)
+		}
+		if r.Regexp != "" {
+			re, err := regexp.Compile(r.Regexp)
+			if err != nil {
+				return nil, fmt.Errorf("file rule %d: compile regexp %q: %w", i+1, r.Regexp, err)
+			}
+			f.regexps[i] = re
+		}
+	}
+	return f, nil
+}
+
+// Decide decides whether a file is tailed.
+func (f *Filter) Decide(file File) Decision {
+	for i, r := range f.rules {
+		if f.matches(i, file) {
+			return Decision{Included: r.Action == Include, Rule: i + 1, Reason: fmt.Sprintf("rule %d: %s", i+1, r)}
+		}
+	}
+	return Decision{Included: true, Reason: "no rule matched"}
+}
+
+// matches says whether a file matches all of the criteria of the rule i.
+func (f *Filter) matches(i int, file File) bool {
+	r := f.rules[i]
+	if r.Glob != "" && !doublestar.MatchUnvalidated(r.Glob, file.Path) {
+		return false
+	}
+	if re := f.regexps[i]; re != nil && !re.MatchString(file.Path) {
+		return false
+	}
+	if r.Process != "" && r.Process != file.Process || r.Component != "" && r.Component != file.Component {
+		return false
+	}
+	if r.OlderThan > 0 && f.now().Sub(file.ModTime) < r.OlderThan {
+		return false
+	}
+	return file.Size >= r.LargerThan
+}
+
+// Record is a file and the latest decision on it.
+type Record struct {
+	File
+	Decision
+	DecidedAt time.Time `json:"decided_at"`
+}
+
+// Records keeps the latest decision on each file. It's safe for concurrent use.
+type Records struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// Add records a decision on a file, replacing any earlier one.
+func (r *Records) Add(file File, decision Decision) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.records == nil {
+		r.records = make(map[string]Record)
+	}
+	r.records[file.Path] = Record{file, decision, time.Now()}
+}
+
+// Delete forgets the decision on the file at path, e.g. once it's removed.
+func (r *Records) Delete(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, path)
+}
+
+// All returns the records, by path.
+func (r *Records) All() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := make([]Record, 0, len(r.records))
+	for _, record := range r.records {
+		all = append(all, record)
+	}
+	slices.SortFunc(all, func(a, b Record) int { return strings.Compare(a.Path, b.Path) })
+	return all
+}
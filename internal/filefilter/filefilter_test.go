@@ -0,0 +1,76 @@
+package filefilter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	now := time.Date(2022, 8, 2, 15, 16, 44, 0, time.UTC)
+	f, err := New([]Rule{
+		{Action: Include, Glob: "vizqlserver/**/*.txt"},
+		{Action: Exclude, Glob: "**/*.{gz,zip}"},
+		{Action: Exclude, Regexp: `^tabadmincontroller/.*\.txt$`},
+		{Action: Exclude, Process: "pgsql", Component: "stdout"},
+		{Action: Exclude, OlderThan: 7 * 24 * time.Hour},
+		{Action: Exclude, LargerThan: 1 << 30},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.now = func() time.Time { return now }
+	tests := []struct {
+		description string
+		file        File
+		included    bool
+		rule        int
+	}{
+		{"unmatched", File{Path: "vizqlserver/vizqlserver_node1-0.log", ModTime: now}, true, 0},
+		{"included before excluded", File{Path: "vizqlserver/Logs/old.txt", ModTime: now.AddDate(-1, 0, 0)}, true, 1},
+		{"glob alternatives", File{Path: "httpd/access.2022-08-01.log.gz", ModTime: now}, false, 2},
+		{"regexp", File{Path: "tabadmincontroller/control.txt", ModTime: now}, false, 3},
+		{"process and component", File{Path: "pgsql/stdout_pgsql_0.log", Process: "pgsql", Component: "stdout", ModTime: now}, false, 4},
+		{"component of another process", File{Path: "vizqlserver/stdout_vizqlserver_0.log", Process: "vizqlserver", Component: "stdout", ModTime: now}, true, 0},
+		{"old", File{Path: "backgrounder/backgrounder_node1-0.log", ModTime: now.AddDate(0, 0, -8)}, false, 5},
+		{"large", File{Path: "backgrounder/backgrounder_node1-0.log", ModTime: now, Size: 2 << 30}, false, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			got := f.Decide(tt.file)
+			if got.Included != tt.included || got.Rule != tt.rule {
+				t.Errorf("expected included %t by rule %d, got %+v", tt.included, tt.rule, got)
+			}
+		})
+	}
+	if got := f.Decide(File{Path: "httpd/error.log.gz"}).Reason; got != `rule 2: exclude glob "**/*.{gz,zip}"` {
+		t.Errorf("unexpected reason %q", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, rule := range []Rule{
+		{Glob: "*.log"},
+		{Action: Exclude, Glob: "[a"},
+		{Action: Exclude, Regexp: "("},
+	} {
+		if _, err := New([]Rule{rule}); err == nil {
+			t.Errorf("expected %+v to be invalid", rule)
+		}
+	}
+}
+
+func TestRecords(t *testing.T) {
+	var r Records
+	r.Add(File{Path: "b.log"}, Decision{Included: true})
+	r.Add(File{Path: "a.log"}, Decision{Included: true})
+	r.Add(File{Path: "b.log"}, Decision{Included: false, Rule: 1})
+	r.Delete("c.log")
+	all := r.All()
+	if len(all) != 2 || all[0].Path != "a.log" || all[1].Path != "b.log" || all[1].Included {
+		t.Errorf("expected the latest decisions by path, got %+v", all)
+	}
+	r.Delete("a.log")
+	if all := r.All(); len(all) != 1 {
+		t.Errorf("expected a deleted record to be forgotten, got %+v", all)
+	}
+}
@@ -3,3 +3,9 @@ package fileid
 func Query(path string) (uint64, error) {
 	return queryFilenameById(path)
 }
+
+// QueryDevice returns the identifier of the device (or volume) holding the file at path.
+// Together with the file ID it uniquely identifies a file on the host.
+func QueryDevice(path string) (uint64, error) {
+	return queryDeviceById(path)
+}
@@ -7,9 +7,26 @@ import (
 )
 
 func queryFilenameById(path string) (uint64, error) {
+	data, err := fileInformation(path)
+	if err != nil {
+		return 0, err
+	}
+	return (uint64(data.FileIndexHigh) << 32) | uint64(data.FileIndexLow), nil
+}
+
+func queryDeviceById(path string) (uint64, error) {
+	data, err := fileInformation(path)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(data.VolumeSerialNumber), nil
+}
+
+func fileInformation(path string) (windows.ByHandleFileInformation, error) {
+	var data windows.ByHandleFileInformation
 	_path, err := windows.UTF16PtrFromString(path)
 	if err != nil {
-		return 0, fmt.Errorf("convert path to UTF16 %s: %w", path, err)
+		return data, fmt.Errorf("convert path to UTF16 %s: %w", path, err)
 	}
 	handle, err := windows.CreateFile(_path,
 		windows.GENERIC_READ,
@@ -20,15 +37,13 @@ func queryFilenameById(path string) (uint64, error) {
 		0)
 
 	if err != nil {
-		return 0, fmt.Errorf("open file %s: %w", path, err)
+		return data, fmt.Errorf("open file %s: %w", path, err)
 	}
 	defer windows.CloseHandle(handle)
 
-	var data windows.ByHandleFileInformation
-
 	if err = windows.GetFileInformationByHandle(handle, &data); err != nil {
-		return 0, fmt.Errorf("get file information for %s: %w", path, err)
+		return data, fmt.Errorf("get file information for %s: %w", path, err)
 	}
 
-	return (uint64(data.FileIndexHigh) << 32) | uint64(data.FileIndexLow), nil
+	return data, nil
 }
@@ -2,6 +2,8 @@ package httpd
 
 import (
 	lex "github.com/timtadh/lexmachine"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -9,6 +11,18 @@ import (
 type Config struct {
 	definitions map[string]string
 	formats     []string
+	nicknames   map[string]string
+	logs        []LogFile
+	errorFormat string
+}
+
+// LogFile is a file httpd writes a log to, according to a CustomLog or ErrorLog directive.
+type LogFile struct {
+	Path     string // the file's path, whose strftime conversions, e.g. %Y, are replaced by the time it was opened
+	Rotated  bool   // the file is rotated by rotatelogs, which appends the time to paths without conversions
+	Format   string // the LogFormat of an access log's entries
+	Error    bool   // the file is the error log
+	nickname string
 }
 
 func (c Config) Definitions() map[string]string {
@@ -19,8 +33,26 @@ func (c Config) Formats() []string {
 	return c.formats
 }
 
+// Nicknames returns the formats defined with a nickname, e.g. LogFormat "%h %l %u %t \"%r\" %>s %b" common, by
+// nickname.
+func (c Config) Nicknames() map[string]string {
+	return c.nicknames
+}
+
+// Logs returns the files httpd writes logs to, in the order of their directives. Logs written to a pipe other
+// than rotatelogs, or to syslog, are left out, as are access logs with an undefined nickname.
+func (c Config) Logs() []LogFile {
+	return c.logs
+}
+
+// ErrorFormat returns the format of the error log's entries set by the ErrorLogFormat directive, or "" if httpd
+// writes them in its default format.
+func (c Config) ErrorFormat() string {
+	return c.errorFormat
+}
+
 func (c Config) Empty() bool {
-	return len(c.definitions) == 0 && len(c.formats) == 0
+	return len(c.definitions) == 0 && len(c.formats) == 0 && len(c.logs) == 0 && c.errorFormat == ""
 }
 
 func From(config []byte) Config {
@@ -45,11 +77,44 @@ func From(config []byte) Config {
 		}
 		tokens = append(tokens, token)
 	}
-	for i := 0; i < len(tokens)-2; i++ {
+	nicknames := make(map[string]string)
+	var logs []LogFile
+	var errorFormat string
+	for i := 0; i < len(tokens)-1; i++ {
+		// The format of connection and request entries, ErrorLogFormat connection|request "...", is ignored.
+		if l.Tokens[tokens[i].Type] == "ErrorLogFormat" && l.Tokens[tokens[i+1].Type] == "VALUE" {
+			if format, ok := tokens[i+1].Value.(string); ok {
+				errorFormat = unquote(format)
+			}
+			i++
+			continue
+		}
+		if l.Tokens[tokens[i].Type] == "ErrorLog" && l.Tokens[tokens[i+1].Type] == "VALUE" {
+			if path, rotated, ok := logPath(tokens[i+1].Value); ok {
+				logs = append(logs, LogFile{Path: path, Rotated: rotated, Error: true})
+			}
+			i++
+			continue
+		}
 		if len(tokens[i:]) < 3 {
 			break
 		}
 		tok := tokens[i : i+3]
+		if l.Tokens[tok[0].Type] == "CustomLog" && l.Tokens[tok[1].Type] == "VALUE" {
+			// The format is either a nickname or a format string.
+			path, rotated, ok := logPath(tok[1].Value)
+			format, isString := tok[2].Value.(string)
+			if ok && isString {
+				switch l.Tokens[tok[2].Type] {
+				case "ID":
+					logs = append(logs, LogFile{Path: path, Rotated: rotated, nickname: format})
+				case "VALUE":
+					logs = append(logs, LogFile{Path: path, Rotated: rotated, Format: unquote(format)})
+				}
+			}
+			i += 2
+			continue
+		}
 		if l.Tokens[tok[0].Type] == "Define" && l.Tokens[tok[1].Type] == "ID" && l.Tokens[tok[2].Type] == "VALUE" {
 			key, ok := tok[1].Value.(string)
 			if !ok {
@@ -72,23 +137,77 @@ func From(config []byte) Config {
 			if len(format) == 0 {
 				continue
 			}
-			if format[0] == '"' {
-				format = format[1:]
-			}
-			if len(format) > 0 && format[len(format)-1] == '"' {
-				format = format[:len(format)-1]
-			}
+			format = unquote(format)
 			formats = append(formats, format)
+			if nickname, ok := tok[2].Value.(string); ok {
+				nicknames[nickname] = format
+			}
 			i += 2
 		}
 	}
 	for i, format := range formats {
 		formats[i] = getValue(format, defs)
 	}
+	for nickname, format := range nicknames {
+		nicknames[nickname] = getValue(format, defs)
+	}
+	resolved := logs[:0]
+	for _, log := range logs {
+		if log.nickname != "" {
+			format, ok := nicknames[log.nickname]
+			if !ok {
+				continue
+			}
+			log.Format = format
+		} else if !log.Error {
+			log.Format = getValue(log.Format, defs)
+		}
+		resolved = append(resolved, log)
+	}
 	return Config{
 		definitions: defs,
 		formats:     formats,
+		nicknames:   nicknames,
+		logs:        resolved,
+		errorFormat: getValue(errorFormat, defs),
+	}
+}
+
+// unquote removes the double quotes around a directive's argument.
+func unquote(value string) string {
+	value = strings.TrimPrefix(value, `"`)
+	return strings.TrimSuffix(value, `"`)
+}
+
+// logPath returns the path of the file that the target of a CustomLog or ErrorLog directive writes to, and
+// whether its files are rotated by rotatelogs. It returns false for syslog, and for pipes to other programs.
+func logPath(value any) (string, bool, bool) {
+	target, ok := value.(string)
+	if !ok {
+		return "", false, false
+	}
+	target = unquote(target)
+	if strings.HasPrefix(target, "syslog") {
+		return "", false, false
+	}
+	if !strings.HasPrefix(target, "|") {
+		return target, false, target != ""
+	}
+	// |[$]rotatelogs [options] logfile rotationtime|filesize [offset]
+	args := strings.Fields(strings.TrimLeft(target, "|$"))
+	if len(args) == 0 || !strings.Contains(path.Base(filepath.ToSlash(args[0])), "rotatelogs") {
+		return "", false, false
+	}
+	for i := 1; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			return args[i], true, true
+		}
+		// Options that take a value
+		if args[i] == "-L" || args[i] == "-p" || args[i] == "-n" {
+			i++
+		}
 	}
+	return "", false, false
 }
 
 func getValue(original string, definitions map[string]string) string {
@@ -2,6 +2,8 @@ package httpd
 
 import (
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -61,3 +63,86 @@ func TestConfig_GetValue(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_Logs(t *testing.T) {
+	t.Run("shipped configuration", func(t *testing.T) {
+		c, err := os.ReadFile("testdata/httpd.conf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := From(c)
+		logs := config.Logs()
+		if len(logs) != 3 {
+			t.Fatalf("expected 3 logs, got %+v", logs)
+		}
+		for i, nickname := range []string{"common", "common_no_query_string"} {
+			if logs[i].Path != "/var/opt/tableau/tableau_server/data/tabsvc/logs/httpd/access.%Y_%m_%d_%H_%M_%S.log" || logs[i].Format != config.Nicknames()[nickname] || logs[i].Error {
+				t.Errorf("expected access log with the %s format, got %+v", nickname, logs[i])
+			}
+		}
+		if logs[2].Path != "/var/opt/tableau/tableau_server/data/tabsvc/logs/httpd/error.log" || !logs[2].Error {
+			t.Errorf("expected error log, got %+v", logs[2])
+		}
+		if strings.Contains(logs[0].Format, "${TAB_ERR_ANNOTATIONS}") {
+			t.Errorf("expected definitions to be expanded in %s", logs[0].Format)
+		}
+	})
+	tests := []struct {
+		description string
+		config      string
+		expected    []LogFile
+	}{
+		{"nickname defined with digits", `LogFormat "%h %t" combined2
+CustomLog "logs/access_log" combined2`, []LogFile{{Path: "logs/access_log", Format: "%h %t"}}},
+		{"format string", `CustomLog "logs/access_log" "%h %t"`, []LogFile{{Path: "logs/access_log", Format: "%h %t"}}},
+		{"rotatelogs", `LogFormat "%h" common
+CustomLog "|bin/rotatelogs -l -L logs/access.log logs/access.%Y-%m-%d.log 86400" common
+CustomLog "||/usr/bin/rotatelogs -n 5 logs/common_log 1M" common`, []LogFile{
+			{Path: "logs/access.%Y-%m-%d.log", Rotated: true, Format: "%h"},
+			{Path: "logs/common_log", Rotated: true, Format: "%h"},
+		}},
+		{"error logs", `ErrorLog "logs/error_log"
+ErrorLog "|$bin/rotatelogs logs/error_log.%Y%m%d 86400"
+ErrorLog "syslog:local7"`, []LogFile{
+			{Path: "logs/error_log", Error: true},
+			{Path: "logs/error_log.%Y%m%d", Rotated: true, Error: true},
+		}},
+		{"undefined nickname and other pipes", `LogFormat "%h" common
+CustomLog "logs/access_log" combined
+CustomLog "|/usr/bin/logger -t httpd" common`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := From([]byte(test.config)).Logs()
+			for i := range got {
+				got[i].nickname = ""
+			}
+			if len(got) != len(test.expected) || (len(got) > 0 && !reflect.DeepEqual(got, test.expected)) {
+				t.Errorf("expected %+v, got %+v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestConfig_ErrorFormat(t *testing.T) {
+	tests := []struct {
+		description string
+		config      string
+		expected    string
+	}{
+		{"default", `ErrorLog "logs/error_log"`, ""},
+		{"error log format", `Define LEVEL "%l"
+ErrorLogFormat "[%{cu}t] [${LEVEL}] %M"
+ErrorLog "logs/error_log"`, "[%{cu}t] [%l] %M"},
+		{"connection and request formats are ignored", `ErrorLogFormat "%M"
+ErrorLogFormat connection "[%{c}L] connection from %a"
+ErrorLogFormat request "[%L] request %{User-Agent}i"`, "%M"},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if got := From([]byte(test.config)).ErrorFormat(); got != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
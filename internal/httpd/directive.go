@@ -0,0 +1,111 @@
+package httpd
+
+import "strings"
+
+// token is an element of a tokenized LogFormat: either a literal or a directive.
+type token interface{}
+
+// literal is text that httpd writes as is.
+type literal string
+
+// directive is a % directive of a LogFormat, e.g. %!200,304{Referer}i.
+type directive struct {
+	Statuses []string // the statuses the directive is written for, e.g. 400,501; "-" is written for others
+	Negated  bool     // the directive is written for any status but Statuses
+	Original bool     // < modifier: the directive describes the original request rather than the final one
+	Final    bool     // > modifier: the directive describes the final request, after internal redirects
+	Param    string   // the text between braces, e.g. Referer
+	Letter   string   // the directive's letter, or ^ti and ^to for trailers
+	Source   string   // the text of the directive in the format
+}
+
+// logFormatEscapes are the escape sequences httpd replaces in a LogFormat.
+var logFormatEscapes = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\t`, "\t", `\"`, `"`)
+
+// tokenize tokenizes a LogFormat, according to mod_log_config's grammar:
+//
+//	format    = { literal | "%%" | directive }
+//	directive = "%" { "!" | digit | "," | "<" | ">" | "{" param "}" } letter
+//
+// A % that isn't followed by a letter is a literal.
+func tokenize(format string) []token {
+	format = logFormatEscapes.Replace(format)
+	var tokens []token
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			tokens = append(tokens, literal(text.String()))
+			text.Reset()
+		}
+	}
+	for i := 0; i < len(format); {
+		if format[i] != '%' {
+			text.WriteByte(format[i])
+			i++
+			continue
+		}
+		if strings.HasPrefix(format[i:], "%%") {
+			text.WriteByte('%')
+			i += 2
+			continue
+		}
+		d, n := parseDirective(format[i:])
+		if n == 0 {
+			text.WriteByte('%')
+			i++
+			continue
+		}
+		flush()
+		tokens = append(tokens, d)
+		i += n
+	}
+	flush()
+	return tokens
+}
+
+// parseDirective parses the directive at the start of s, returning its length, or 0 if s doesn't start with one.
+func parseDirective(s string) (directive, int) {
+	var d directive
+	var status strings.Builder
+	endStatus := func() {
+		if status.Len() > 0 {
+			d.Statuses = append(d.Statuses, status.String())
+			status.Reset()
+		}
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '!':
+			d.Negated = true
+		case '0' <= c && c <= '9':
+			status.WriteByte(c)
+		case c == ',':
+			endStatus()
+		case c == '<':
+			d.Original = true
+		case c == '>':
+			d.Final = true
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return directive{}, 0
+			}
+			d.Param = s[i+1 : i+end]
+			i += end
+		case c == '^' && i+2 < len(s):
+			endStatus()
+			d.Letter = s[i : i+3]
+			d.Source = s[:i+3]
+			return d, i + 3
+		case ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'):
+			endStatus()
+			d.Letter = string(c)
+			d.Source = s[:i+1]
+			return d, i + 1
+		default:
+			return directive{}, 0
+		}
+	}
+	return directive{}, 0
+}
@@ -0,0 +1,53 @@
+package httpd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		description string
+		given       string
+		expected    []token
+	}{
+		{"literals and directives", `%h [%t] \"%r\"`, []token{
+			directive{Letter: "h", Source: "%h"},
+			literal(" ["),
+			directive{Letter: "t", Source: "%t"},
+			literal(`] "`),
+			directive{Letter: "r", Source: "%r"},
+			literal(`"`),
+		}},
+		{"parameters and modifiers", `%{%d/%b/%Y}t %>s %<s %{c}a`, []token{
+			directive{Param: "%d/%b/%Y", Letter: "t", Source: "%{%d/%b/%Y}t"},
+			literal(" "),
+			directive{Final: true, Letter: "s", Source: "%>s"},
+			literal(" "),
+			directive{Original: true, Letter: "s", Source: "%<s"},
+			literal(" "),
+			directive{Param: "c", Letter: "a", Source: "%{c}a"},
+		}},
+		{"status conditions", `%400,501{User-agent}i %!200,304,302{Referer}i`, []token{
+			directive{Statuses: []string{"400", "501"}, Param: "User-agent", Letter: "i", Source: "%400,501{User-agent}i"},
+			literal(" "),
+			directive{Statuses: []string{"200", "304", "302"}, Negated: true, Param: "Referer", Letter: "i", Source: "%!200,304,302{Referer}i"},
+		}},
+		{"trailers", `%{Expires}^to`, []token{
+			directive{Param: "Expires", Letter: "^to", Source: "%{Expires}^to"},
+		}},
+		{"percents and escapes", `100%% %\t%`, []token{
+			literal("100% %\t%"),
+		}},
+		{"missing closing brace", `%{Referer i`, []token{
+			literal("%{Referer i"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			if got := tokenize(tt.given); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("given %q, expected %#v, got %#v", tt.given, tt.expected, got)
+			}
+		})
+	}
+}
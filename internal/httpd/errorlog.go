@@ -0,0 +1,295 @@
+package httpd
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
+)
+
+// DefaultErrorLogFormat is the ErrorLogFormat equivalent to the format httpd writes its error log with when none
+// is configured, e.g.
+// [Tue Aug 02 15:16:44.042345 2022] [core:error] [pid 1234:tid 567] (OS 2)File not found.: [client 10.0.0.1:5012] AH00132: file permissions deny server access, referer: https://tableau/
+//
+// The tid is left out by non-threaded MPMs, and the file and line that wrote the entry, by levels below debug.
+const DefaultErrorLogFormat = `[%{u}t] [%-m:%l] [pid %P% :tid\ %T% ] %7F: %E: [client\ %a] %M% ,\ referer:\ %{Referer}i`
+
+// ErrorFormat is the format of httpd's error log when no ErrorLogFormat is configured.
+var ErrorFormat = ErrorLogFormat(DefaultErrorLogFormat)
+
+// errorDirective is a % directive of an ErrorLogFormat, e.g. %-{Referer}i.
+type errorDirective struct {
+	Hyphen   bool   // - modifier: "-" is written when the directive has no value, rather than omitting its field
+	Required bool   // + modifier: the entry isn't written when the directive has no value
+	MinLevel int    // the level from which the directive is written, e.g. 7, debug, in %7F
+	Param    string // the text between braces, e.g. Referer
+	Letter   string
+}
+
+// errorField is a field of an ErrorLogFormat, which httpd omits when one of its directives has no value: its
+// tokens, and the separator that ends it, which is " " for a space and "" for "% ".
+type errorField struct {
+	tokens []token
+	sep    string
+}
+
+// tokenizeError splits an ErrorLogFormat into fields, according to mod_log's grammar:
+//
+//	format    = { literal | "\" char | "%%" | "% " | " " | directive }
+//	directive = "%" { "-" | "+" | digit } [ "{" param "}" ] letter
+func tokenizeError(format string) []errorField {
+	var fields []errorField
+	var tokens []token
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			tokens = append(tokens, literal(text.String()))
+			text.Reset()
+		}
+	}
+	end := func(sep string) {
+		flush()
+		fields = append(fields, errorField{tokens, sep})
+		tokens = nil
+	}
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		switch {
+		case c == '\\' && i+1 < len(format):
+			i++
+			switch format[i] {
+			case 'n':
+				text.WriteByte('\n')
+			case 't':
+				text.WriteByte('\t')
+			default:
+				text.WriteByte(format[i])
+			}
+		case c == ' ':
+			end(" ")
+		case c == '%' && strings.HasPrefix(format[i:], "%%"):
+			text.WriteByte('%')
+			i++
+		case c == '%' && strings.HasPrefix(format[i:], "% "):
+			end("")
+			i++
+		case c == '%':
+			d, n := parseErrorDirective(format[i:])
+			if n == 0 {
+				text.WriteByte('%')
+				continue
+			}
+			flush()
+			tokens = append(tokens, d)
+			i += n - 1
+		default:
+			text.WriteByte(c)
+		}
+	}
+	end("")
+	return fields
+}
+
+// parseErrorDirective parses the directive at the start of s, returning its length, or 0 if s doesn't start with
+// one.
+func parseErrorDirective(s string) (errorDirective, int) {
+	var d errorDirective
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '-':
+			d.Hyphen = true
+		case c == '+':
+			d.Required = true
+		case '0' <= c && c <= '9':
+			d.MinLevel = d.MinLevel*10 + int(c-'0')
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return errorDirective{}, 0
+			}
+			d.Param = s[i+1 : i+end]
+			i += end
+		case ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'):
+			d.Letter = string(c)
+			return d, i + 1
+		default:
+			return errorDirective{}, 0
+		}
+	}
+	return errorDirective{}, 0
+}
+
+// errorFields are the fields of the ErrorLogFormat directives that take no parameter, by letter.
+var errorFields = map[string]field{
+	"a": {"client", `\S+`, ""},
+	"A": {"local_ip", `\S+`, ""},
+	"E": {"os_error", `\((?:OS )?-?\d+\)[^:]*`, ""},
+	"F": {"source", `[^\s:]+\(\d+\)`, ""},
+	"k": {"keepalive_requests", `\d+`, logformat.Int},
+	"l": {"level", `\w+`, ""},
+	"L": {"log_id", `\S+`, ""},
+	"m": {"module", `[^\s:]+`, ""},
+	"P": {"pid", `\d+`, logformat.Int},
+	"T": {"tid", `\d+`, logformat.Int},
+	"v": {"server_name", `\S+`, ""},
+	"V": {"requested_hostname", `\S+`, ""},
+}
+
+// errorParamFields are the fields of the ErrorLogFormat directives whose parameter selects what they write.
+var errorParamFields = map[string]map[string]field{
+	"a": {"c": {"peer_ip", `\S+`, ""}},
+	"L": {
+		"c": {"connection_log_id", `\S+`, ""},
+		"C": {"connection_log_id", `\S+`, ""},
+	},
+	"T": {"g": {"system_tid", `\d+`, logformat.Int}},
+}
+
+// errorPrefixes are prepended to the names of the fields of directives that name a variable, e.g. %{UNIQUE_ID}e.
+var errorPrefixes = map[string]string{
+	"e": "env_",
+	"n": "note_",
+}
+
+// unset are the letters of the directives that have no value for some entries, e.g. %a for those not written
+// while serving a request.
+var unset = map[string]bool{
+	"a": true, "A": true, "e": true, "E": true, "F": true, "i": true, "k": true,
+	"L": true, "n": true, "T": true, "v": true, "V": true,
+}
+
+// errorTimeOf returns the regexp and layout of an ErrorLogFormat %t directive, whose parameter adds microseconds
+// (u) or writes an ISO 8601 time (c).
+func errorTimeOf(d errorDirective) (string, string) {
+	fraction, layoutFraction := "", ""
+	if strings.Contains(d.Param, "u") {
+		fraction, layoutFraction = `[.,]\d{6}`, ".000000"
+	}
+	if strings.Contains(d.Param, "c") {
+		return `\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}` + fraction, "2006-01-02 15:04:05" + layoutFraction
+	}
+	return `[A-Z][a-z]{2} [A-Z][a-z]{2} \d{2} \d{2}:\d{2}:\d{2}` + fraction + ` \d{4}`, "Mon Jan 02 15:04:05" + layoutFraction + " 2006"
+}
+
+// errorGenerator generates the regexp of a tokenized ErrorLogFormat, and its fields' metadata.
+type errorGenerator struct {
+	re      strings.Builder
+	times   []string
+	layouts []string
+	types   map[string]string
+	names   map[string]int
+}
+
+// name returns a unique name for a capture group.
+func (g *errorGenerator) name(name string) string {
+	if g.names == nil {
+		g.names = make(map[string]int)
+	}
+	g.names[name]++
+	if n := g.names[name]; n > 1 {
+		return name + "_" + strconv.Itoa(n)
+	}
+	return name
+}
+
+func (g *errorGenerator) generate(fields []errorField) {
+	g.re.WriteString("^")
+	trailing := false
+	for i, f := range fields {
+		var re strings.Builder
+		optional := false
+		for j, t := range f.tokens {
+			switch t := t.(type) {
+			case literal:
+				re.WriteString(regexp.QuoteMeta(string(t)))
+			case errorDirective:
+				optional = optional || t.MinLevel > 0 || unset[t.Letter] && !t.Hyphen && !t.Required
+				if t.Letter == "M" {
+					trailing = followed(fields, i, j)
+				}
+				re.WriteString(g.directive(t, trailing && t.Letter == "M"))
+			}
+		}
+		re.WriteString(regexp.QuoteMeta(f.sep))
+		if optional {
+			g.re.WriteString(`(?:` + re.String() + `)?`)
+		} else {
+			g.re.WriteString(re.String())
+		}
+	}
+	// A message that isn't last is matched lazily, up to what follows it at the end of the entry.
+	if trailing {
+		g.re.WriteString(`\n?$`)
+	}
+}
+
+// followed says whether anything is written after the token j of fields[i].
+func followed(fields []errorField, i, j int) bool {
+	if j+1 < len(fields[i].tokens) || fields[i].sep != "" {
+		return true
+	}
+	for _, f := range fields[i+1:] {
+		if len(f.tokens) > 0 || f.sep != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// directive returns the capture group of a directive. lazy says whether the message, %M, is followed by other
+// fields.
+func (g *errorGenerator) directive(d errorDirective, lazy bool) string {
+	switch d.Letter {
+	case "t":
+		re, layout := errorTimeOf(d)
+		name := g.name("timestamp")
+		g.times = append(g.times, name)
+		g.layouts = append(g.layouts, layout)
+		return `(?P<` + name + `>` + re + `)`
+	case "M":
+		// The message starts with the code of the module's message, e.g. AH00354.
+		message := `.*`
+		if lazy {
+			message = `.*?`
+		}
+		return `(?:(?P<` + g.name("ah_code") + `>AH\d{5}): )?(?s)(?P<` + g.name("message") + `>` + message + `)(?-s)`
+	}
+	f, ok := errorParamFields[d.Letter][d.Param]
+	if !ok {
+		f, ok = errorFields[d.Letter]
+	}
+	if !ok {
+		name := d.Param
+		if name == "" {
+			name = d.Letter
+		}
+		f = field{name: errorPrefixes[d.Letter] + strings.Trim(nonWord.ReplaceAllString(strings.ToLower(name), "_"), "_"), re: `\S+`}
+	}
+	re := f.re
+	if d.Hyphen {
+		re = `(?:` + re + `|-)`
+	}
+	name := g.name(f.name)
+	if f.typ != "" {
+		if g.types == nil {
+			g.types = make(map[string]string)
+		}
+		g.types[name] = f.typ
+	}
+	return `(?P<` + name + `>` + re + `)`
+}
+
+// ErrorLogFormat returns the format of the entries of an error log written with the given ErrorLogFormat.
+func ErrorLogFormat(format string) logformat.Format {
+	var g errorGenerator
+	g.generate(tokenizeError(format))
+	return logformat.Format{
+		Regexp: g.re.String(),
+		Time:   g.times,
+		Layout: strings.Join(g.layouts, " "),
+		Types:  g.types,
+		Levels: Levels,
+	}
+}
@@ -0,0 +1,114 @@
+package httpd
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
+)
+
+func TestTokenizeError(t *testing.T) {
+	tests := []struct {
+		description string
+		given       string
+		expected    []errorField
+	}{
+		{"fields", `[%t] %M`, []errorField{
+			{[]token{literal("["), errorDirective{Letter: "t"}, literal("]")}, " "},
+			{[]token{errorDirective{Letter: "M"}}, ""},
+		}},
+		{"modifiers", `%-m %+{Referer}i %7F`, []errorField{
+			{[]token{errorDirective{Hyphen: true, Letter: "m"}}, " "},
+			{[]token{errorDirective{Required: true, Param: "Referer", Letter: "i"}}, " "},
+			{[]token{errorDirective{MinLevel: 7, Letter: "F"}}, ""},
+		}},
+		{"escaped spaces and separators", `[client\ %a] %M% ,\ referer`, []errorField{
+			{[]token{literal("[client "), errorDirective{Letter: "a"}, literal("]")}, " "},
+			{[]token{errorDirective{Letter: "M"}}, ""},
+			{[]token{literal(", referer")}, ""},
+		}},
+		{"percents", `100%% %{x`, []errorField{
+			{[]token{literal("100%")}, " "},
+			{[]token{literal("%{x")}, ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			if got := tokenizeError(tt.given); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestErrorLogFormat(t *testing.T) {
+	t.Run("default format", func(t *testing.T) {
+		re := regexp.MustCompile(ErrorFormat.Regexp)
+		tests := []struct {
+			description string
+			line        string
+			expected    map[string]string
+		}{
+			{"threaded", `[Tue Aug 02 15:16:44.042345 2022] [mpm_winnt:notice] [pid 1234:tid 567] AH00354: Child: Starting 64 worker threads.`,
+				map[string]string{"module": "mpm_winnt", "level": "notice", "pid": "1234", "tid": "567", "ah_code": "AH00354", "message": "Child: Starting 64 worker threads."}},
+			{"non-threaded", `[Tue Aug 02 15:16:44.042345 2022] [core:warn] [pid 1234] AH00098: pid file overwritten`,
+				map[string]string{"module": "core", "level": "warn", "pid": "1234", "tid": "", "message": "pid file overwritten"}},
+			{"source and request", `[Tue Aug 02 15:16:44.042345 2022] [authz_core:debug] [pid 1234:tid 567] mod_authz_core.c(820): [client 10.0.0.1:50312] AH01626: authorization result: granted, referer: https://tableau.example.com/`,
+				map[string]string{"source": "mod_authz_core.c(820)", "client": "10.0.0.1:50312", "ah_code": "AH01626", "message": "authorization result: granted", "referer": "https://tableau.example.com/"}},
+			{"os error", `[Tue Aug 02 15:16:44.042345 2022] [proxy:error] [pid 1234:tid 567] (OS 10061)No connection could be made because the target machine actively refused it.  : AH00957: HTTP: attempt to connect to 127.0.0.1:8000 (localhost) failed`,
+				map[string]string{"os_error": "(OS 10061)No connection could be made because the target machine actively refused it.  ", "ah_code": "AH00957", "message": "HTTP: attempt to connect to 127.0.0.1:8000 (localhost) failed"}},
+			{"unknown module and multi-line message", "[Tue Aug 02 15:16:44.042345 2022] [-:error] [pid 1234:tid 567] first\nsecond\n",
+				map[string]string{"module": "-", "ah_code": "", "message": "first\nsecond"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.description, func(t *testing.T) {
+				m := re.FindStringSubmatch(tt.line)
+				if m == nil {
+					t.Fatalf("expected %s to match %s", ErrorFormat.Regexp, tt.line)
+				}
+				for name, want := range tt.expected {
+					if got := m[re.SubexpIndex(name)]; got != want {
+						t.Errorf("expected %s %q, got %q", name, want, got)
+					}
+				}
+			})
+		}
+		got, ok := ErrorFormat.ParseTime("Tue Aug 02 15:16:44.042345 2022")
+		if !ok || !got.Equal(time.Date(2022, 8, 2, 15, 16, 44, 42345e3, time.Local)) {
+			t.Errorf("unexpected time %v", got)
+		}
+		if ErrorFormat.Types["pid"] != logformat.Int || ErrorFormat.Level("emerg") != "panic" {
+			t.Errorf("expected integer pids and httpd's levels, got %v", ErrorFormat)
+		}
+	})
+	tests := []struct {
+		description string
+		given       string
+		expected    string
+		layout      string
+	}{
+		{"compact time and log ids", `%{cu}t [%l] %{c}L %L %M`,
+			`^(?P<timestamp>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}[.,]\d{6}) \[(?P<level>\w+)\] (?:(?P<connection_log_id>\S+) )?(?:(?P<log_id>\S+) )?(?:(?P<ah_code>AH\d{5}): )?(?s)(?P<message>.*)(?-s)`,
+			"2006-01-02 15:04:05.000000"},
+		{"hyphens and required directives", `%t %-a %+{User-Agent}i %{UNIQUE_ID}e %M`,
+			`^(?P<timestamp>[A-Z][a-z]{2} [A-Z][a-z]{2} \d{2} \d{2}:\d{2}:\d{2} \d{4}) (?P<client>(?:\S+|-)) (?P<user_agent>\S+) (?:(?P<env_unique_id>\S+) )?(?:(?P<ah_code>AH\d{5}): )?(?s)(?P<message>.*)(?-s)`,
+			"Mon Jan 02 15:04:05 2006"},
+		{"system thread id", `%{g}T %T`, `^(?:(?P<system_tid>\d+) )?(?:(?P<tid>\d+))?`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			f := ErrorLogFormat(tt.given)
+			if f.Regexp != tt.expected {
+				t.Errorf("given %q, expected %s, got %s", tt.given, tt.expected, f.Regexp)
+			}
+			if f.Layout != tt.layout {
+				t.Errorf("expected layout %q, got %q", tt.layout, f.Layout)
+			}
+			if _, err := regexp.Compile(f.Regexp); err != nil {
+				t.Errorf("expected a valid regexp, got %v", err)
+			}
+		})
+	}
+}
@@ -3,9 +3,17 @@ package httpd
 import (
 	"fmt"
 	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
 )
 
-func GetFormats(path string) ([]string, error) {
+// GetFormats returns the formats of the logs an httpd configuration writes, by a pattern matching the names of
+// their files. A file written by more than one CustomLog directive, e.g. under different conditions, has the
+// format of the first. The error log has the format of the ErrorLogFormat directive, if any.
+func GetFormats(path string) (map[string]logformat.Format, error) {
 	c, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read httpd config %s: %w", path, err)
@@ -14,9 +22,65 @@ func GetFormats(path string) ([]string, error) {
 	if cfg.Empty() {
 		return nil, fmt.Errorf("invalid configuration in %s", path)
 	}
-	formats := make([]string, 0)
-	for _, format := range cfg.Formats() {
-		formats = append(formats, Regexp(format))
+	errorFormat := ErrorFormat
+	if cfg.ErrorFormat() != "" {
+		errorFormat = ErrorLogFormat(cfg.ErrorFormat())
+	}
+	formats := make(map[string]logformat.Format)
+	for _, log := range cfg.Logs() {
+		name := filePattern(log)
+		if _, ok := formats[name]; ok {
+			continue
+		}
+		if log.Error {
+			formats[name] = errorFormat
+		} else {
+			formats[name] = Format(log.Format)
+		}
 	}
 	return formats, nil
 }
+
+var strftimeConversion = regexp.MustCompile(`%.`)
+
+// filePattern returns a glob matching the names of the files written to a log's path, which may be a Windows path
+// whatever the OS ts-olly runs on.
+func filePattern(log LogFile) string {
+	name := path.Base(strings.ReplaceAll(log.Path, `\`, "/"))
+	pattern := strftimeConversion.ReplaceAllString(name, "*")
+	if log.Rotated && pattern == name {
+		pattern += ".*"
+	}
+	return pattern
+}
+
+// Levels are the levels of httpd's LogLevel directive that aren't shared by other formats.
+var Levels = map[string]string{
+	"emerg":  "panic",
+	"alert":  "fatal",
+	"notice": "info",
+	"trace1": "trace", "trace2": "trace", "trace3": "trace", "trace4": "trace",
+	"trace5": "trace", "trace6": "trace", "trace7": "trace", "trace8": "trace",
+}
+
+// Format returns the format of the entries written with the given LogFormat.
+func Format(format string) logformat.Format {
+	var g generator
+	g.generate(tokenize(format))
+	f := logformat.Format{Regexp: g.re.String(), Types: g.types}
+	var layouts []string
+	for _, t := range g.times {
+		if t.layout == "" {
+			continue
+		}
+		if t.layout == logformat.UnixSeconds || t.layout == logformat.UnixMillis {
+			// A Unix time is the whole time.
+			f.Time, layouts = []string{t.name}, []string{t.layout}
+			break
+		}
+		f.Time = append(f.Time, t.name)
+		layouts = append(layouts, t.layout)
+	}
+	f.Layout = strings.Join(layouts, " ")
+	return f
+}
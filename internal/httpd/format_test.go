@@ -1,6 +1,13 @@
 package httpd
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
+)
 
 func TestGetFormats(t *testing.T) {
 	t.Run("valid httpd.conf file returns valid instance", func(t *testing.T) {
@@ -11,6 +18,27 @@ func TestGetFormats(t *testing.T) {
 		if len(formats) != 2 {
 			t.Errorf("expected 2 formats, got %d", len(formats))
 		}
+		if f := formats["access.*_*_*_*_*_*.log"]; f.Regexp != Regexp(testFormat) {
+			t.Errorf("expected the access logs to have the common format, got %s", f.Regexp)
+		}
+		if f := formats["error.log"]; f.Regexp != ErrorFormat.Regexp {
+			t.Errorf("expected the error log to have the error format, got %s", f.Regexp)
+		}
+	})
+	t.Run("error log format", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "httpd.conf")
+		config := `ErrorLogFormat "[%{cu}t] [%l] %M"
+ErrorLog "logs/error_log"`
+		if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		formats, err := GetFormats(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if f := formats["error_log"]; f.Regexp != ErrorLogFormat("[%{cu}t] [%l] %M").Regexp {
+			t.Errorf("expected the error log to have the ErrorLogFormat, got %s", f.Regexp)
+		}
 	})
 	t.Run("invalid httpd.conf file returns error", func(t *testing.T) {
 		_, err := GetFormats("testdata/bad-httpd.conf")
@@ -20,3 +48,55 @@ func TestGetFormats(t *testing.T) {
 		}
 	})
 }
+
+func TestFormat(t *testing.T) {
+	f := Format(testFormat)
+	if len(f.Time) != 2 || f.Time[0] != "timestamp" || f.Time[1] != "timezone" {
+		t.Fatalf("expected time from the timestamp and timezone groups, got %v", f.Time)
+	}
+	got, ok := f.ParseTime("2022-08-02T15:16:44.042", "+0000")
+	if !ok || !got.Equal(time.Date(2022, 8, 2, 15, 16, 44, 42e6, time.UTC)) {
+		t.Errorf("unexpected time %v", got)
+	}
+	if f := Format(`%h %r`); len(f.Time) != 0 {
+		t.Errorf("expected no time, got %v", f.Time)
+	}
+	if f.Types["status"] != logformat.Int || f.Types["bytes"] != logformat.Int || f.Types["request"] != "" {
+		t.Errorf("expected status and bytes to be integers, got %v", f.Types)
+	}
+	t.Run("default time", func(t *testing.T) {
+		f := Format(`%h %t`)
+		got, ok := f.ParseTime("10/Oct/2022:13:55:36 -0700")
+		if !ok || !got.Equal(time.Date(2022, 10, 10, 20, 55, 36, 0, time.UTC)) {
+			t.Errorf("unexpected time %v", got)
+		}
+	})
+	t.Run("unix time", func(t *testing.T) {
+		f := Format(`%{msec}t %{%z}t %h`)
+		if len(f.Time) != 1 || f.Time[0] != "timestamp" || f.Layout != logformat.UnixMillis {
+			t.Errorf("expected only the unix time, got %v and %q", f.Time, f.Layout)
+		}
+	})
+	t.Run("unparseable time", func(t *testing.T) {
+		if f := Format(`%{%s}t %h`); len(f.Time) != 0 {
+			t.Errorf("expected no time, got %v", f.Time)
+		}
+	})
+}
+
+func TestFilePattern(t *testing.T) {
+	tests := []struct {
+		log  LogFile
+		want string
+	}{
+		{LogFile{Path: "/var/log/httpd/access.%Y_%m_%d.log"}, "access.*_*_*.log"},
+		{LogFile{Path: `C:\Tableau\logs\httpd\error.log`}, "error.log"},
+		{LogFile{Path: "logs/access_log", Rotated: true}, "access_log.*"},
+		{LogFile{Path: "logs/access.%Y-%m-%d", Rotated: true}, "access.*-*-*"},
+	}
+	for _, tt := range tests {
+		if got := filePattern(tt.log); got != tt.want {
+			t.Errorf("expected %q for %s, got %q", tt.want, tt.log.Path, got)
+		}
+	}
+}
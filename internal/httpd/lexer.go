@@ -20,7 +20,7 @@ func newLexer() (*lexer, error) {
 	}
 	l.Add([]byte(`#([^#][^\n]*)`), l.token("COMMENT"))
 	l.Add([]byte("( |\t|\n|\r)+"), skip)
-	l.Add([]byte(`([a-z]|[A-Z])([a-z]|[A-Z]|_)*`), l.token("ID"))
+	l.Add([]byte(`([a-z]|[A-Z])([a-z]|[A-Z]|[0-9]|_)*`), l.token("ID"))
 	l.Add([]byte(`"`),
 		func(scan *lex.Scanner, match *machines.Match) (interface{}, error) {
 			str := make([]byte, 0, 10)
@@ -87,6 +87,7 @@ func (l *lexer) initTokens() {
 		"LogFormat",
 		"CustomLog",
 		"ErrorLog",
+		"ErrorLogFormat",
 	}
 	l.Tokens = []string{
 		"ID",
@@ -1,38 +1,223 @@
 package httpd
 
-import "strings"
-
-// patterns: "%V %h %u %{%Y-%m-%dT%X}t.%{msec_frac}t \"%{%z}t\" %p \"%r\" \"%{X-Forwarded-For}i\" %>s %b \"%{Content-Length}i\" %D %{UNIQUE_ID}e ${TAB_ERR_ANNOTATIONS} \"%{X-Tableau-Trace-Id}i\""
-// httpdPatterns is a map of functions that will replace a logs pattern with
-// a Go regexp pattern.
-var httpdPatterns = map[string]string{
-	`%V`:                            `(?P<requested_hostname>\S+)`,
-	`%h`:                            `(?P<remote_hostname>\S+)`,
-	`%u`:                            `(?P<remote_user>\S+)`,
-	`%{%Y-%m-%dT%X}t.%{msec_frac}t`: `(?P<timestamp>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3})`,
-	`%{%z}t`:                        `(?P<timezone>[\+\-]\d{4})`,
-	`%p`:                            `(?P<request_port>\d+)`,
-	`%r`:                            `(?P<request>[^\"]+)`,
-	`%{X-Forwarded-For}i`:           `(?P<xff>\S*)`,
-	`%>s`:                           `(?P<status>\d{3})`,
-	`%b`:                            `(?P<bytes>\d+|-)`,
-	`%{Content-Length}i`:            `(?P<content_length>\d+|-)`,
-	`%D`:                            `(?P<ms>\d+)`,
-	`%{UNIQUE_ID}e`:                 `(?P<unique_id>\S+)`,
-	`%{tableau_error_source}o`:      `(?P<tableau_error_source>\S+)`,
-	`%{tableau_status_code}o`:       `(?P<tableau_status_code>\S+)`,
-	`%{tableau_error_code}o`:        `(?P<tableau_error_code>\S+)`,
-	`%{tableau_service_name}o`:      `(?P<tableau_service_name>\S+)`,
-	`%{X-Tableau-Trace-Id}i`:        `(?P<tableau_trace_id>\S+)`,
-}
-
-func Regexp(pattern string) string {
-	return replacePatterns(pattern)
-}
-
-func replacePatterns(message string) string {
-	for k, v := range httpdPatterns {
-		message = strings.Replace(message, k, v, -1)
-	}
-	return message
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
+)
+
+// field is what a directive writes: the name of its capture group, a regexp matching it, and its type, which is
+// empty for strings.
+type field struct {
+	name string
+	re   string
+	typ  string
+}
+
+// fields are the fields of the directives that take no parameter, by letter.
+var fields = map[string]field{
+	"a": {"client_ip", `\S+`, ""},
+	"A": {"local_ip", `\S+`, ""},
+	"B": {"bytes", `\d+`, logformat.Int},
+	"b": {"bytes", `\d+|-`, logformat.Int},
+	"D": {"ms", `\d+`, logformat.Int}, // the time taken to serve the request, in microseconds despite its name
+	"f": {"filename", `\S+`, ""},
+	"h": {"remote_hostname", `\S+`, ""},
+	"H": {"protocol", `\S+`, ""},
+	"I": {"bytes_received", `\d+`, logformat.Int},
+	"k": {"keepalive_requests", `\d+`, logformat.Int},
+	"l": {"remote_logname", `\S+`, ""},
+	"L": {"log_id", `\S+`, ""},
+	"m": {"method", `\S+`, ""},
+	"O": {"bytes_sent", `\d+`, logformat.Int},
+	"p": {"request_port", `\d+`, logformat.Int},
+	"P": {"pid", `\d+`, logformat.Int},
+	"q": {"query_string", `\S*`, ""},
+	"r": {"request", `[^\"]+`, ""},
+	"R": {"handler", `\S+`, ""},
+	"s": {"status", `\d{3}`, logformat.Int},
+	"S": {"bytes_transferred", `\d+`, logformat.Int},
+	"T": {"request_time", `\d+`, logformat.Int},
+	"u": {"remote_user", `\S+`, ""},
+	"U": {"url_path", `\S+`, ""},
+	"v": {"server_name", `\S+`, ""},
+	"V": {"requested_hostname", `\S+`, ""},
+	"X": {"connection_status", `[X+-]`, ""},
+}
+
+// paramFields are the fields of directives whose parameter selects what they write, by letter and parameter.
+var paramFields = map[string]map[string]field{
+	"a": {"c": {"peer_ip", `\S+`, ""}},
+	"p": {
+		"canonical": {"request_port", `\d+`, logformat.Int},
+		"local":     {"local_port", `\d+`, logformat.Int},
+		"remote":    {"remote_port", `\d+`, logformat.Int},
+	},
+	"P": {
+		"pid":    {"pid", `\d+`, logformat.Int},
+		"tid":    {"tid", `\d+`, logformat.Int},
+		"hextid": {"tid", `[0-9a-fA-F]+`, ""},
+	},
+	"T": {
+		"s":  {"request_time", `\d+`, logformat.Int},
+		"ms": {"request_time_ms", `\d+`, logformat.Int},
+		"us": {"request_time_us", `\d+`, logformat.Int},
+	},
+	"i": {
+		"X-Forwarded-For":    {"xff", `\S*`, ""},
+		"Content-Length":     {"content_length", `\d+|-`, logformat.Int},
+		"X-Tableau-Trace-Id": {"tableau_trace_id", `\S+`, ""},
+	},
+}
+
+// prefixes are prepended to the names of the fields of directives that name a variable, e.g. %{JSESSIONID}C.
+var prefixes = map[string]string{
+	"C":   "cookie_",
+	"n":   "note_",
+	"^ti": "trailer_in_",
+	"^to": "trailer_out_",
+}
+
+var nonWord = regexp.MustCompile(`\W+`)
+
+// fieldOf returns the field a directive, other than %t, writes. quoted says whether the directive is between
+// double quotes, in which case a variable's value may contain spaces.
+func fieldOf(d directive, quoted bool) field {
+	if f, ok := paramFields[d.Letter][d.Param]; ok {
+		return f
+	}
+	if f, ok := fields[d.Letter]; ok {
+		return f
+	}
+	name := d.Param
+	if name == "" {
+		name = d.Letter
+	}
+	f := field{name: prefixes[d.Letter] + strings.Trim(nonWord.ReplaceAllString(strings.ToLower(name), "_"), "_"), re: `\S+`}
+	if quoted {
+		f.re = `[^"]*`
+	}
+	return f
+}
+
+// timeField is a capture group that holds a time, written by consecutive %t directives, e.g.
+// %{%Y-%m-%dT%X}t.%{msec_frac}t.
+type timeField struct {
+	name   string
+	layout string // empty if Go can't parse the time
+}
+
+// joinable matches the literals that may separate the %t directives of a single time.
+var joinable = regexp.MustCompile(`^[.,:/T-]*$`)
+
+// timeOf returns the regexp and layout of a %t directive, whose regexp includes the brackets of the default
+// format.
+func timeOf(d directive) (string, string) {
+	if d.Param == "" {
+		return `\[(?P<timestamp>\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\]`, "02/Jan/2006:15:04:05 -0700"
+	}
+	param := strings.TrimPrefix(strings.TrimPrefix(d.Param, "begin:"), "end:")
+	return strftime(param)
+}
+
+// generator generates the regexp of a tokenized LogFormat, and its fields' metadata.
+type generator struct {
+	re    strings.Builder
+	times []timeField
+	types map[string]string
+}
+
+func (g *generator) generate(tokens []token) {
+	for i := 0; i < len(tokens); i++ {
+		switch t := tokens[i].(type) {
+		case literal:
+			g.re.WriteString(regexp.QuoteMeta(string(t)))
+		case directive:
+			if t.Letter == "t" {
+				i = g.time(tokens, i)
+				continue
+			}
+			quoted := i > 0 && i+1 < len(tokens) &&
+				strings.HasSuffix(literalAt(tokens, i-1), `"`) && strings.HasPrefix(literalAt(tokens, i+1), `"`)
+			f := fieldOf(t, quoted)
+			re := f.re
+			// Conditional directives write - for the other statuses.
+			if len(t.Statuses) > 0 && !strings.HasSuffix(re, "|-") {
+				re += "|-"
+			}
+			g.re.WriteString(`(?P<` + f.name + `>` + re + `)`)
+			if f.typ != "" {
+				if g.types == nil {
+					g.types = make(map[string]string)
+				}
+				g.types[f.name] = f.typ
+			}
+		}
+	}
+}
+
+// time writes the group of the time written by the %t directive at tokens[i] and those that continue it,
+// returning the index of the last.
+func (g *generator) time(tokens []token, i int) int {
+	d := tokens[i].(directive)
+	if d.Param == "" {
+		re, layout := timeOf(d)
+		g.re.WriteString(re)
+		g.times = append(g.times, timeField{"timestamp", layout})
+		return i
+	}
+	var re, layout strings.Builder
+	parts, parseable, unix := 0, true, false
+	add := func(d directive) {
+		r, l := timeOf(d)
+		re.WriteString(r)
+		layout.WriteString(l)
+		parts++
+		parseable = parseable && l != ""
+		unix = unix || l == logformat.UnixSeconds || l == logformat.UnixMillis
+	}
+	add(d)
+	for i+2 < len(tokens) {
+		sep, ok := tokens[i+1].(literal)
+		next, isDirective := tokens[i+2].(directive)
+		if !ok || !isDirective || next.Letter != "t" || next.Param == "" || !joinable.MatchString(string(sep)) {
+			break
+		}
+		re.WriteString(regexp.QuoteMeta(string(sep)))
+		layout.WriteString(string(sep))
+		add(next)
+		i += 2
+	}
+	f := timeField{name: "timestamp", layout: layout.String()}
+	// Unix times can't be combined with anything else.
+	if !parseable || unix && parts > 1 {
+		f.layout = ""
+	}
+	if f.layout == "-0700" {
+		f.name = "timezone"
+	}
+	for _, t := range g.times {
+		if t.name == f.name {
+			f.name += "_" + strconv.Itoa(len(g.times)+1)
+			break
+		}
+	}
+	g.re.WriteString(`(?P<` + f.name + `>` + re.String() + `)`)
+	g.times = append(g.times, f)
+	return i
+}
+
+// literalAt returns the token at i if it's a literal, or "".
+func literalAt(tokens []token, i int) string {
+	s, _ := tokens[i].(literal)
+	return string(s)
+}
+
+// Regexp returns a regexp matching the entries written with a LogFormat, capturing each directive's field.
+func Regexp(format string) string {
+	var g generator
+	g.generate(tokenize(format))
+	return g.re.String()
 }
@@ -31,3 +31,60 @@ func TestMatch(t *testing.T) {
 		t.Errorf("Regexp failed to match: %s", line)
 	}
 }
+
+func TestRegexpDirectives(t *testing.T) {
+	tests := []struct {
+		description string
+		given       string
+		expected    string
+	}{
+		{"client addresses", `%a %{c}a %A`, `(?P<client_ip>\S+) (?P<peer_ip>\S+) (?P<local_ip>\S+)`},
+		{"default time", `%t`, `\[(?P<timestamp>\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\]`},
+		{"times joined by punctuation", `%{%Y-%m-%dT%X}t.%{msec_frac}t %{%z}t`, `(?P<timestamp>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}) (?P<timezone>[+-]\d{4})`},
+		{"begin and end times", `%{begin:sec}t %{end:msec}t`, `(?P<timestamp>\d+) (?P<timestamp_2>\d+)`},
+		{"durations", `%T %{ms}T %{us}T %D`, `(?P<request_time>\d+) (?P<request_time_ms>\d+) (?P<request_time_us>\d+) (?P<ms>\d+)`},
+		{"mod_logio byte counts", `%I %O %S`, `(?P<bytes_received>\d+) (?P<bytes_sent>\d+) (?P<bytes_transferred>\d+)`},
+		{"status modifiers", `%s %>s %<s`, `(?P<status>\d{3}) (?P<status>\d{3}) (?P<status>\d{3})`},
+		{"connection details", `%X %k %L %{tid}P`, `(?P<connection_status>[X+-]) (?P<keepalive_requests>\d+) (?P<log_id>\S+) (?P<tid>\d+)`},
+		{"quoted headers", `\"%{Referer}i\" \"%{User-Agent}i\"`, `"(?P<referer>[^"]*)" "(?P<user_agent>[^"]*)"`},
+		{"unquoted variables", `%{SSL_PROTOCOL}x %{JSESSIONID}C %{UNIQUE_ID}e`, `(?P<ssl_protocol>\S+) (?P<cookie_jsessionid>\S+) (?P<unique_id>\S+)`},
+		{"conditional directives", `%!200,304{Referer}i %400b`, `(?P<referer>\S+|-) (?P<bytes>\d+|-)`},
+		{"literals are escaped", `[%h] (%u)? 100%%`, `\[(?P<remote_hostname>\S+)\] \((?P<remote_user>\S+)\)\? 100%`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			got := Regexp(tt.given)
+			if got != tt.expected {
+				t.Errorf("given %q, expected %s, got %s", tt.given, tt.expected, got)
+			}
+			if _, err := regexp.Compile(got); err != nil {
+				t.Errorf("expected %s to compile: %v", got, err)
+			}
+		})
+	}
+}
+
+func TestRegexpCombined(t *testing.T) {
+	combined := `%h %l %u %t \"%r\" %>s %b \"%{Referer}i\" \"%{User-Agent}i\" %I %O %{ms}T`
+	line := `192.168.1.5 - frank [10/Oct/2022:13:55:36 -0700] "GET /views/Sales HTTP/1.1" 200 2326 "https://tableau.example.com/" "Mozilla/5.0 (X11; Linux x86_64)" 512 2800 42`
+	re := regexp.MustCompile(Regexp(combined))
+	m := re.FindStringSubmatch(line)
+	if m == nil {
+		t.Fatalf("expected %s to match %s", re, line)
+	}
+	for name, want := range map[string]string{
+		"remote_hostname": "192.168.1.5",
+		"remote_user":     "frank",
+		"timestamp":       "10/Oct/2022:13:55:36 -0700",
+		"request":         "GET /views/Sales HTTP/1.1",
+		"status":          "200",
+		"referer":         "https://tableau.example.com/",
+		"user_agent":      "Mozilla/5.0 (X11; Linux x86_64)",
+		"bytes_sent":      "2800",
+		"request_time_ms": "42",
+	} {
+		if got := m[re.SubexpIndex(name)]; got != want {
+			t.Errorf("expected %s to be %q, got %q", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package httpd
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
+)
+
+// strftimeConversions are the regexps and Go time layouts of the strftime conversions httpd writes times
+// with. An empty layout means Go can't parse the conversion.
+var strftimeConversions = map[byte]struct{ re, layout string }{
+	'a': {`[A-Z][a-z]{2}`, "Mon"},
+	'A': {`[A-Z][a-z]+`, "Monday"},
+	'b': {`[A-Z][a-z]{2}`, "Jan"},
+	'B': {`[A-Z][a-z]+`, "January"},
+	'C': {`\d{2}`, ""},
+	'd': {`\d{2}`, "02"},
+	'D': {`\d{2}/\d{2}/\d{2}`, "01/02/06"},
+	'e': {`[ \d]\d`, "_2"},
+	'F': {`\d{4}-\d{2}-\d{2}`, "2006-01-02"},
+	'h': {`[A-Z][a-z]{2}`, "Jan"},
+	'H': {`\d{2}`, "15"},
+	'I': {`\d{2}`, "03"},
+	'j': {`\d{3}`, "002"},
+	'k': {`[ \d]\d`, ""},
+	'l': {`[ \d]\d`, ""},
+	'm': {`\d{2}`, "01"},
+	'M': {`\d{2}`, "04"},
+	'n': {`\n`, "\n"},
+	'p': {`[AP]M`, "PM"},
+	'r': {`\d{2}:\d{2}:\d{2} [AP]M`, "03:04:05 PM"},
+	'R': {`\d{2}:\d{2}`, "15:04"},
+	's': {`\d+`, ""},
+	'S': {`\d{2}`, "05"},
+	't': {`\t`, "\t"},
+	'T': {`\d{2}:\d{2}:\d{2}`, "15:04:05"},
+	'u': {`\d`, ""},
+	'w': {`\d`, ""},
+	'X': {`\d{2}:\d{2}:\d{2}`, "15:04:05"},
+	'y': {`\d{2}`, "06"},
+	'Y': {`\d{4}`, "2006"},
+	'z': {`[+-]\d{4}`, "-0700"},
+	'Z': {`[A-Za-z]+`, "MST"},
+	'%': {`%`, "%"},
+}
+
+// strftime translates the format of a %{format}t directive, without its begin: or end: prefix, into a regexp and
+// a Go time layout, which is empty if Go can't parse the times.
+func strftime(format string) (string, string) {
+	switch format {
+	case "sec":
+		return `\d+`, logformat.UnixSeconds
+	case "msec":
+		return `\d+`, logformat.UnixMillis
+	case "usec":
+		return `\d+`, ""
+	case "msec_frac":
+		return `\d{3}`, "000"
+	case "usec_frac":
+		return `\d{6}`, "000000"
+	}
+	var re, layout strings.Builder
+	parseable := true
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 == len(format) {
+			// Go would take a digit in the layout for part of the time.
+			if '0' <= c && c <= '9' {
+				parseable = false
+			}
+			re.WriteString(regexp.QuoteMeta(string(c)))
+			layout.WriteByte(c)
+			continue
+		}
+		i++
+		conv, ok := strftimeConversions[format[i]]
+		if !ok {
+			conv.re = `\S+`
+		}
+		if conv.layout == "" {
+			parseable = false
+		}
+		re.WriteString(conv.re)
+		layout.WriteString(conv.layout)
+	}
+	if !parseable {
+		return re.String(), ""
+	}
+	return re.String(), layout.String()
+}
@@ -0,0 +1,27 @@
+package httpd
+
+import "testing"
+
+func TestStrftime(t *testing.T) {
+	tests := []struct {
+		format string
+		re     string
+		layout string
+	}{
+		{"%Y-%m-%dT%X", `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}`, "2006-01-02T15:04:05"},
+		{"%d/%b/%Y:%H:%M:%S %z", `\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`, "02/Jan/2006:15:04:05 -0700"},
+		{"%a %e %T.%Z", `[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}\.[A-Za-z]+`, "Mon _2 15:04:05.MST"},
+		{"sec", `\d+`, "UNIX"},
+		{"msec", `\d+`, "UNIX_MILLIS"},
+		{"usec_frac", `\d{6}`, "000000"},
+		{"%s", `\d+`, ""},
+		{"day %j of 20%y", `day \d{3} of 20\d{2}`, ""},
+		{"%Q", `\S+`, ""},
+	}
+	for _, tt := range tests {
+		re, layout := strftime(tt.format)
+		if re != tt.re || layout != tt.layout {
+			t.Errorf("given %q, expected %q and %q, got %q and %q", tt.format, tt.re, tt.layout, re, layout)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Package javadate translates the date patterns of Java's SimpleDateFormat and DateTimeFormatter, as used by
+// log4j's and log4j2's %d conversion, into regular expressions and Go time layouts.
+package javadate
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
+)
+
+// Format is a translated date pattern.
+type Format struct {
+	Regexp string // matches the dates written with the pattern
+	Layout string // Go time layout of those dates, logformat.UnixSeconds or logformat.UnixMillis; empty if Go can't parse them
+}
+
+// Default is the pattern of log4j's and log4j2's %d conversion when it has none.
+const Default = "yyyy-MM-dd HH:mm:ss,SSS"
+
+// named are log4j2's predefined date formats, e.g. %d{ISO8601}.
+var named = map[string]string{
+	"ABSOLUTE":                       "HH:mm:ss,SSS",
+	"ABSOLUTE_MICROS":                "HH:mm:ss,nnnnnn",
+	"ABSOLUTE_NANOS":                 "HH:mm:ss,nnnnnnnnn",
+	"ABSOLUTE_PERIOD":                "HH:mm:ss.SSS",
+	"COMPACT":                        "yyyyMMddHHmmssSSS",
+	"DATE":                           "dd MMM yyyy HH:mm:ss,SSS",
+	"DATE_PERIOD":                    "dd MMM yyyy HH:mm:ss.SSS",
+	"DEFAULT":                        "yyyy-MM-dd HH:mm:ss,SSS",
+	"DEFAULT_MICROS":                 "yyyy-MM-dd HH:mm:ss,nnnnnn",
+	"DEFAULT_NANOS":                  "yyyy-MM-dd HH:mm:ss,nnnnnnnnn",
+	"DEFAULT_PERIOD":                 "yyyy-MM-dd HH:mm:ss.SSS",
+	"ISO8601_BASIC":                  "yyyyMMdd'T'HHmmss,SSS",
+	"ISO8601_BASIC_PERIOD":           "yyyyMMdd'T'HHmmss.SSS",
+	"ISO8601":                        "yyyy-MM-dd'T'HH:mm:ss,SSS",
+	"ISO8601_OFFSET_DATE_TIME_HH":    "yyyy-MM-dd'T'HH:mm:ss,SSSX",
+	"ISO8601_OFFSET_DATE_TIME_HHMM":  "yyyy-MM-dd'T'HH:mm:ss,SSSXX",
+	"ISO8601_OFFSET_DATE_TIME_HHCMM": "yyyy-MM-dd'T'HH:mm:ss,SSSXXX",
+	"ISO8601_PERIOD":                 "yyyy-MM-dd'T'HH:mm:ss.SSS",
+	"ISO8601_PERIOD_MICROS":          "yyyy-MM-dd'T'HH:mm:ss.nnnnnn",
+	"US_MONTH_DAY_YEAR2_TIME":        "dd/MM/yy HH:mm:ss.SSS",
+	"US_MONTH_DAY_YEAR4_TIME":        "dd/MM/yyyy HH:mm:ss.SSS",
+}
+
+// log4jNamed are log4j's predefined date formats. Unlike log4j2's, its ISO8601 separates the date and time
+// with a space.
+var log4jNamed = map[string]string{
+	"ABSOLUTE": "HH:mm:ss,SSS",
+	"DATE":     "dd MMM yyyy HH:mm:ss,SSS",
+	"ISO8601":  "yyyy-MM-dd HH:mm:ss,SSS",
+}
+
+// Translate translates a date pattern, or the name of one of log4j2's predefined formats.
+func Translate(pattern string) Format {
+	switch pattern {
+	case "UNIX":
+		return Format{Regexp: `\d{1,19}`, Layout: logformat.UnixSeconds}
+	case "UNIX_MILLIS":
+		return Format{Regexp: `\d{1,19}`, Layout: logformat.UnixMillis}
+	}
+	if p, ok := named[pattern]; ok {
+		pattern = p
+	}
+	return translate(pattern)
+}
+
+// TranslateLog4j translates a date pattern, or the name of one of log4j's predefined formats.
+func TranslateLog4j(pattern string) Format {
+	if p, ok := log4jNamed[pattern]; ok {
+		pattern = p
+	}
+	return translate(pattern)
+}
+
+// translate translates a SimpleDateFormat or DateTimeFormatter pattern.
+func translate(pattern string) Format {
+	var re, layout strings.Builder
+	parseable := true
+	literal := func(s string) {
+		re.WriteString(regexp.QuoteMeta(s))
+		layout.WriteString(s)
+	}
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		switch {
+		case c == '\'':
+			// Quoted text, in which '' is a quote. '' outside quoted text is a quote too.
+			var text strings.Builder
+			j := i + 1
+			for ; j < len(pattern); j++ {
+				if pattern[j] != '\'' {
+					text.WriteByte(pattern[j])
+					continue
+				}
+				if j+1 < len(pattern) && pattern[j+1] == '\'' {
+					text.WriteByte('\'')
+					j++
+					continue
+				}
+				break
+			}
+			if j == i+1 {
+				text.WriteByte('\'')
+			}
+			literal(text.String())
+			i = j + 1
+		case isLetter(c):
+			n := 1
+			for i+n < len(pattern) && pattern[i+n] == c {
+				n++
+			}
+			f, ok := field(c, n, layout.String())
+			if !ok {
+				literal(pattern[i : i+n])
+			} else {
+				re.WriteString(f.Regexp)
+				layout.WriteString(f.Layout)
+				parseable = parseable && f.Layout != ""
+			}
+			i += n
+		default:
+			literal(pattern[i : i+1])
+			i++
+		}
+	}
+	f := Format{Regexp: re.String()}
+	if parseable && roundTrips(f.Regexp, layout.String()) {
+		f.Layout = layout.String()
+	}
+	return f
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// field translates a run of n of the pattern letter c, following the layout translated so far. Fields that Go
+// can't parse have an empty layout.
+func field(c byte, n int, preceding string) (Format, bool) {
+	digits := func(short, long string) Format {
+		if n == 1 {
+			return Format{`\d{1,2}`, short}
+		}
+		return Format{`\d{2}`, long}
+	}
+	switch c {
+	case 'G':
+		return Format{`(?:AD|BC)`, ""}, true
+	case 'y':
+		if n == 2 {
+			return Format{`\d{2}`, "06"}, true
+		}
+		return Format{`\d{4}`, "2006"}, true
+	case 'Y':
+		if n == 2 {
+			return Format{`\d{2}`, ""}, true
+		}
+		return Format{`\d{4}`, ""}, true
+	case 'M', 'L':
+		switch n {
+		case 1, 2:
+			return digits("1", "01"), true
+		case 3:
+			return Format{`[A-Z][a-z]{2}`, "Jan"}, true
+		}
+		return Format{`[A-Z][a-z]+`, "January"}, true
+	case 'd':
+		return digits("2", "02"), true
+	case 'D':
+		if n >= 3 {
+			return Format{`\d{3}`, "002"}, true
+		}
+		return Format{`\d{1,3}`, ""}, true
+	case 'E':
+		if n <= 3 {
+			return Format{`[A-Z][a-z]{2}`, "Mon"}, true
+		}
+		return Format{`[A-Z][a-z]+`, "Monday"}, true
+	case 'u':
+		return Format{`[1-7]`, ""}, true
+	case 'a':
+		return Format{`[AP]M`, "PM"}, true
+	case 'H':
+		return digits("15", "15"), true
+	case 'h':
+		return digits("3", "03"), true
+	case 'k', 'K', 'F', 'w', 'W':
+		return Format{`\d{1,2}`, ""}, true
+	case 'm':
+		return digits("4", "04"), true
+	case 's':
+		return digits("5", "05"), true
+	case 'S', 'n':
+		// Go only parses fractions of a second that follow a period or comma
+		f := Format{`\d{` + strconv.Itoa(n) + `}`, ""}
+		if n <= 9 && (strings.HasSuffix(preceding, ".") || strings.HasSuffix(preceding, ",")) {
+			f.Layout = strings.Repeat("0", n)
+		}
+		return f, true
+	case 'z':
+		if n < 4 {
+			return Format{`[A-Z]{3,5}`, "MST"}, true
+		}
+		return Format{`[A-Z][A-Za-z ]*[a-z]`, ""}, true
+	case 'Z':
+		switch n {
+		case 2:
+			return Format{`[+-]\d{2}:\d{2}`, "-07:00"}, true
+		case 5:
+			return Format{`(?:Z|[+-]\d{2}:\d{2})`, "Z07:00"}, true
+		}
+		return Format{`[+-]\d{4}`, "-0700"}, true
+	case 'X':
+		switch n {
+		case 1:
+			return Format{`(?:Z|[+-]\d{2})`, "Z07"}, true
+		case 2:
+			return Format{`(?:Z|[+-]\d{4})`, "Z0700"}, true
+		}
+		return Format{`(?:Z|[+-]\d{2}:\d{2})`, "Z07:00"}, true
+	case 'x':
+		switch n {
+		case 1:
+			return Format{`[+-]\d{2}`, "-07"}, true
+		case 2:
+			return Format{`[+-]\d{4}`, "-0700"}, true
+		}
+		return Format{`[+-]\d{2}:\d{2}`, "-07:00"}, true
+	case 'V':
+		return Format{`[\w/+-]+`, ""}, true
+	}
+	return Format{}, false
+}
+
+// reference is formatted with a translated layout to check that the translated regexp matches what it writes.
+var reference = time.Date(2022, time.November, 28, 13, 41, 28, 862123456, time.UTC)
+
+// roundTrips reports whether dates written with layout match re and parse back. It fails when a literal in
+// the pattern happens to be a Go layout element, e.g. a digit.
+func roundTrips(re, layout string) bool {
+	s := reference.Format(layout)
+	if !regexp.MustCompile(`^(?:` + re + `)$`).MatchString(s) {
+		return false
+	}
+	_, err := time.Parse(layout, s)
+	return err == nil
+}
@@ -0,0 +1,149 @@
+package javadate
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		description string
+		pattern     string
+		regexp      string
+		layout      string
+		sample      string
+		want        time.Time
+	}{
+		{"default", Default, `\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3}`, "2006-01-02 15:04:05,000",
+			"2022-07-28 13:41:28,862", time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.UTC)},
+		{"named iso8601", "ISO8601", `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2},\d{3}`, "2006-01-02T15:04:05,000",
+			"2022-07-28T13:41:28,862", time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.UTC)},
+		{"names of days and months and zone", "EEE MMM dd HH:mm:ss zzz yyyy", `[A-Z][a-z]{2} [A-Z][a-z]{2} \d{2} \d{2}:\d{2}:\d{2} [A-Z]{3,5} \d{4}`, "Mon Jan 02 15:04:05 MST 2006",
+			"Thu Jul 28 13:41:28 UTC 2022", time.Date(2022, 7, 28, 13, 41, 28, 0, time.UTC)},
+		{"full names and unpadded numbers", "EEEE, MMMM d, yyyy h:mm a", `[A-Z][a-z]+, [A-Z][a-z]+ \d{1,2}, \d{4} \d{1,2}:\d{2} [AP]M`, "Monday, January 2, 2006 3:04 PM",
+			"Thursday, July 28, 2022 1:41 PM", time.Date(2022, 7, 28, 13, 41, 0, 0, time.UTC)},
+		{"12-hour clock", "dd/MMM/yyyy:hh:mm:ss a", `\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [AP]M`, "02/Jan/2006:03:04:05 PM",
+			"28/Jul/2022:01:41:28 PM", time.Date(2022, 7, 28, 13, 41, 28, 0, time.UTC)},
+		{"quoted literal and iso offset", "yyyy-MM-dd'T'HH:mm:ss.SSSXXX", `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}(?:Z|[+-]\d{2}:\d{2})`, "2006-01-02T15:04:05.000Z07:00",
+			"2022-07-28T13:41:28.862Z", time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.UTC)},
+		{"escaped quotes", "''yyyy''", `'\d{4}'`, "'2006'",
+			"'2022'", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"microseconds", "yyyy-MM-dd HH:mm:ss.SSSSSS", `\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{6}`, "2006-01-02 15:04:05.000000",
+			"2022-07-28 13:41:28.862123", time.Date(2022, 7, 28, 13, 41, 28, 862123e3, time.UTC)},
+		{"tenths of a second", "yyyy-MM-dd HH:mm:ss.S", `\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{1}`, "2006-01-02 15:04:05.0",
+			"2022-07-28 13:41:28.8", time.Date(2022, 7, 28, 13, 41, 28, 8e8, time.UTC)},
+
+		{"named default micros", "DEFAULT_MICROS", `\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{6}`, "2006-01-02 15:04:05,000000",
+			"2022-07-28 13:41:28,862123", time.Date(2022, 7, 28, 13, 41, 28, 862123e3, time.UTC)},
+		{"named unix millis", "UNIX_MILLIS", `\d{1,19}`, logformat.UnixMillis,
+			"1659015688862", time.UnixMilli(1659015688862)},
+		{"named compact can't be parsed", "COMPACT", `\d{4}\d{2}\d{2}\d{2}\d{2}\d{2}\d{3}`, "",
+			"20220728134128862", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			f := Translate(tt.pattern)
+			if f.Regexp != tt.regexp || f.Layout != tt.layout {
+				t.Fatalf("expected %q, %q, got %q, %q", tt.regexp, tt.layout, f.Regexp, f.Layout)
+			}
+			if !regexp.MustCompile(`^` + f.Regexp + `$`).MatchString(tt.sample) {
+				t.Fatalf("expected %q to match %q", f.Regexp, tt.sample)
+			}
+			got, ok := logformat.Format{Layout: f.Layout, Location: time.UTC}.ParseTime(tt.sample)
+			if ok != !tt.want.IsZero() || !got.Equal(tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTranslateLog4j(t *testing.T) {
+	// log4j's predefined formats differ from log4j2's of the same name.
+	for pattern, want := range map[string]string{
+		"ISO8601":                   "2006-01-02 15:04:05,000",
+		"DATE":                      "02 Jan 2006 15:04:05,000",
+		"ABSOLUTE":                  "15:04:05,000",
+		Default:                     "2006-01-02 15:04:05,000",
+		"yyyy-MM-dd HH:mm:ss.SSS Z": "2006-01-02 15:04:05.000 -0700",
+	} {
+		if got := TranslateLog4j(pattern).Layout; got != want {
+			t.Errorf("%s: expected %q, got %q", pattern, want, got)
+		}
+	}
+}
+
+// TestTranslateShipped translates the date patterns of the log4j and log4j2 configurations Tableau ships,
+// including the default of the %d conversions that have none, and checks that the dates written with each
+// match its regexp and parse back.
+func TestTranslateShipped(t *testing.T) {
+	const corpus = "../../cmd/ts-olly/process/testdata/valid"
+	conversion := regexp.MustCompile(`%d(?:ate)?(?:\{([^}]*)\})?`)
+	written := time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.UTC)
+	patterns := make(map[string]bool)
+	err := filepath.WalkDir(corpus, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.Contains(d.Name(), "log4j") {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		translate, library := TranslateLog4j, "log4j"
+		if strings.Contains(d.Name(), "log4j2") {
+			translate, library = Translate, "log4j2"
+		}
+		for _, m := range conversion.FindAllStringSubmatch(string(b), -1) {
+			pattern := m[1]
+			if pattern == "" {
+				pattern = Default
+			}
+			if patterns[library+" "+pattern] {
+				continue
+			}
+			patterns[library+" "+pattern] = true
+			f := translate(pattern)
+			if f.Layout == "" {
+				t.Errorf("%s: expected %s to be parseable", path, m[0])
+				continue
+			}
+			sample := written.Format(f.Layout)
+			if !regexp.MustCompile(`^` + f.Regexp + `$`).MatchString(sample) {
+				t.Errorf("%s: expected %q of %s to match %q", path, sample, m[0], f.Regexp)
+			}
+			got, ok := logformat.Format{Layout: f.Layout, Location: time.UTC}.ParseTime(sample)
+			if !ok || got.Format(f.Layout) != sample {
+				t.Errorf("%s: expected %q of %s to parse back, got %v", path, sample, m[0], got)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"log4j " + Default, "log4j2 ISO8601", "log4j2 yyyy-MM-dd HH:mm:ss.SSS Z"} {
+		if !patterns[want] {
+			t.Errorf("expected the shipped configurations to have the %s pattern, got %v", want, patterns)
+		}
+	}
+}
+
+func TestTranslateWithoutDate(t *testing.T) {
+	// log4j2's ABSOLUTE has no date, so it's taken to be today.
+	f := Translate("ABSOLUTE")
+	if f.Regexp != `\d{2}:\d{2}:\d{2},\d{3}` || f.Layout != "15:04:05,000" {
+		t.Fatalf("unexpected %q, %q", f.Regexp, f.Layout)
+	}
+	// A time after midnight is never far enough ahead to be taken to be from yesterday.
+	got, ok := logformat.Format{Layout: f.Layout, Location: time.UTC}.ParseTime("00:41:28,862")
+	now := time.Now().UTC()
+	if !ok || got.YearDay() != now.YearDay() || got.Hour() != 0 || got.Minute() != 41 || got.Nanosecond() != 862e6 {
+		t.Errorf("expected 00:41:28.862 today, got %v", got)
+	}
+}
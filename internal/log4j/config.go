@@ -43,8 +43,8 @@ func FromProperties(properties []byte) Config {
 	appenders := make(map[string]Appender)
 	for k := range v.GetStringMap("log4j.appender") {
 		name := k
-		file := v.GetString(fmt.Sprintf("log4j.appender.%s.file", name))
-		file = filepath.Base(file)
+		path := v.GetString(fmt.Sprintf("log4j.appender.%s.file", name))
+		file := filepath.Base(path)
 		if file == "." {
 			file = "stdout"
 		}
@@ -52,7 +52,7 @@ func FromProperties(properties []byte) Config {
 		layoutPattern := v.GetString(fmt.Sprintf("log4j.appender.%s.layout.conversionpattern", name))
 		layoutClass := v.GetString(fmt.Sprintf("log4j.appender.%s.layout", name))
 		layout := NewLayout(layoutClass, file, layoutPattern)
-		appenders[name] = NewAppender(name, appenderClass, layout, nil)
+		appenders[name] = NewAppender(name, appenderClass, layout, map[string]string{"File": path})
 	}
 	return Config{
 		appenders: appenders,
@@ -3,10 +3,17 @@ package log4j
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
 )
 
-func GetFormats(path string) ([]string, error) {
+// GetFormats returns the formats of the files log4j's appenders write to, by a pattern matching their names.
+// Console appenders write to stdout. Appenders whose file is named by a lookup alone, e.g. ${logfile}, are left
+// out, as nothing tells which file they write to.
+func GetFormats(path string) (map[string]logformat.Format, error) {
 	configFile, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read log4j config %s: %w", path, err)
@@ -20,23 +27,50 @@ func GetFormats(path string) ([]string, error) {
 	if cfg.Empty() {
 		return nil, fmt.Errorf("invalid configuration in %s", path)
 	}
-	formats := make([]string, 0)
+	formats := make(map[string]logformat.Format)
 	for _, appender := range cfg.Appenders() {
-		if pattern := appender.Layout().Pattern(); pattern != "" {
-			pattern = Regexp(pattern, make(map[string]string))
-			if !in(pattern, formats) {
-				formats = append(formats, pattern)
-			}
+		pattern := appender.Layout().Pattern()
+		if pattern == "" {
+			continue
+		}
+		formatName := filePattern(appender.Params()["File"])
+		// The layouts of properties configurations are named after their appender's file, stdout if it has none
+		if strings.HasSuffix(appender.Class(), "ConsoleAppender") || appender.Layout().Name() == "stdout" {
+			formatName = "stdout"
 		}
+		if formatName == "" {
+			continue
+		}
+		formats[formatName] = Format(pattern)
 	}
 	return formats, nil
 }
 
-func in(pattern string, patterns []string) bool {
-	for _, p := range patterns {
-		if pattern == p {
-			return true
+var lookup = regexp.MustCompile(`\$\{[^}]*\}`)
+
+// filePattern returns a glob matching the name of the file an appender writes to, whose lookups, e.g.
+// ${catalina.base}, match any text. It's empty if the name is only lookups.
+func filePattern(filename string) string {
+	if filename == "" {
+		return ""
+	}
+	pattern := lookup.ReplaceAllString(filepath.Base(filename), "*")
+	if strings.Trim(pattern, "*") == "" {
+		return ""
+	}
+	return pattern
+}
+
+// Format returns the format of the entries written with the given layout pattern. Their time is taken from
+// the pattern's date conversion.
+func Format(pattern string) logformat.Format {
+	f := logformat.Format{Regexp: Regexp(pattern, make(map[string]string))}
+	for _, p := range extractPatterns(pattern) {
+		if c, ok := parseConversion(p); ok && c.Pattern == "date" {
+			f.Time = []string{"date"}
+			f.Layout, f.Location = dateLayout(c)
+			break
 		}
 	}
-	return false
+	return f
 }
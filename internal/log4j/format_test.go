@@ -1,17 +1,42 @@
 package log4j
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
 )
 
 func TestGetFormats(t *testing.T) {
-	t.Run("valid xml configuration returns valid instance", func(t *testing.T) {
+	t.Run("valid xml configuration returns the formats of its appenders' files", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log4j.xml")
+		config, err := os.ReadFile("testdata/log4j.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		config = bytes.Replace(config, []byte("${logfile}"), []byte("/var/opt/tableau/tableau_server/data/tabsvc/logs/vizportal/vizportal-0.log"), 1)
+		if err := os.WriteFile(path, config, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		formats, err := GetFormats(path)
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if _, ok := formats["vizportal-0.log"]; len(formats) != 1 || !ok {
+			t.Errorf("expected the format of vizportal-0.log, got %v", formats)
+		}
+	})
+	t.Run("appenders whose file is only a lookup are left out", func(t *testing.T) {
 		formats, err := GetFormats("testdata/log4j.xml")
 		if err != nil {
 			t.Errorf("expected no error, got %v", err)
 		}
-		if len(formats) != 1 {
-			t.Errorf("expected 1 format, got %d", len(formats))
+		if len(formats) != 0 {
+			t.Errorf("expected no formats, got %v", formats)
 		}
 	})
 	t.Run("invalid xml configuration returns error", func(t *testing.T) {
@@ -21,13 +46,30 @@ func TestGetFormats(t *testing.T) {
 			t.Errorf("expected %q, got %q", want, err.Error())
 		}
 	})
-	t.Run("valid properties configuration returns valid instance", func(t *testing.T) {
+	t.Run("valid properties configuration returns the formats of its appenders' files", func(t *testing.T) {
 		formats, err := GetFormats("testdata/log4j.properties")
 		if err != nil {
 			t.Errorf("expected no error, got %v", err)
 		}
-		if len(formats) != 3 {
-			t.Errorf("expected 3 format, got %d", len(formats))
+		for _, name := range []string{"stdout", "activemq.log", "audit.log"} {
+			if _, ok := formats[name]; !ok {
+				t.Errorf("expected the format of %s, got %v", name, formats)
+			}
+		}
+		// activemq's own log
+		line := "2022-07-28 13:41:28,862 | INFO  | Apache ActiveMQ 5.16.4 (localhost, ID:node1-37913-1659015688601-0:1) started | org.apache.activemq.broker.BrokerService | main"
+		f := formats["activemq.log"]
+		re := regexp.MustCompile(f.Regexp)
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("expected %q to match %q", f.Regexp, line)
+		}
+		if level, logger := m[re.SubexpIndex("level")], m[re.SubexpIndex("logger")]; level != "INFO" || logger != "org.apache.activemq.broker.BrokerService" {
+			t.Errorf("unexpected level %q and logger %q", level, logger)
+		}
+		got, ok := logformat.Format{Layout: f.Layout, Location: time.UTC}.ParseTime(m[re.SubexpIndex("date")])
+		if !ok || !got.Equal(time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.UTC)) {
+			t.Errorf("unexpected time %v", got)
 		}
 	})
 	t.Run("invalid properties configuration returns error", func(t *testing.T) {
@@ -38,3 +80,34 @@ func TestGetFormats(t *testing.T) {
 		}
 	})
 }
+
+func TestFormat(t *testing.T) {
+	t.Run("the date conversion gives the time layout and zone", func(t *testing.T) {
+		f := Format("%d{yyyy-MM-dd HH:mm:ss.SSS}{UTC} %t: %-5p %c - %m%n")
+		if len(f.Time) != 1 || f.Time[0] != "date" {
+			t.Fatalf("expected time from the date group, got %v", f.Time)
+		}
+		if f.Layout != "2006-01-02 15:04:05.000" || f.Location != time.UTC {
+			t.Errorf("unexpected layout %q in %v", f.Layout, f.Location)
+		}
+		re := regexp.MustCompile(f.Regexp)
+		m := re.FindStringSubmatch("2022-07-28 13:41:28.862 main: INFO  com.tableau.Main - started\n")
+		if m == nil {
+			t.Fatal("expected the format to match")
+		}
+		got, ok := f.ParseTime(m[re.SubexpIndex("date")])
+		if !ok || !got.Equal(time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.UTC)) {
+			t.Errorf("unexpected time %v", got)
+		}
+	})
+	t.Run("the default date format", func(t *testing.T) {
+		if f := Format("%d %m"); f.Layout != "2006-01-02 15:04:05,000" || f.Location != nil {
+			t.Errorf("unexpected layout %q in %v", f.Layout, f.Location)
+		}
+	})
+	t.Run("patterns without a date have no time", func(t *testing.T) {
+		if f := Format("%m%n"); len(f.Time) != 0 || f.Layout != "" {
+			t.Errorf("expected no time, got %v %q", f.Time, f.Layout)
+		}
+	})
+}
@@ -5,32 +5,20 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/javadate"
 )
 
 // log4jPatterns is a map of functions that will replace a logs pattern with
 // a Go regexp pattern.
 var log4jPatterns = map[string]func(conversion) conversionToRegex{
 	"date": func(conversion conversion) conversionToRegex {
-		// If there's no modifier, use the default date format as per
-		// https://logging.apache.org/log4j/log4j-2.1/manual/layouts.html
-		pattern := `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3}`
-
-		// If there's a modifier, use it to format the date
-		if conversion.Modifier != "" {
-			// We don't care about a timezone modifier (the second parameter), because it just changes the numbers, not their format.
-			// Extract the first match of `\{[^}]*\}` from the modifier and use it as the format input.
-			re := regexp.MustCompile(`\{([^}]*)}`)
-			matches := re.FindStringSubmatch(conversion.Modifier)
-			if len(matches) > 1 {
-				format := matches[1]
-				pattern = convertDateFormat(format)
-			}
-
-		}
-
+		// Without a modifier, the date has the default format, as per log4j's PatternLayout. We don't care about
+		// a timezone modifier (the second option), because it just changes the numbers, not their format.
 		return conversionToRegex{
 			Name:  `date`,
-			Match: fmt.Sprintf(`(?P<date>%s)`, pattern),
+			Match: fmt.Sprintf(`(?P<date>%s)`, javadate.TranslateLog4j(datePattern(conversion)).Regexp),
 		}
 	},
 	"number": func(conversion conversion) conversionToRegex {
@@ -74,9 +62,10 @@ var log4jPatterns = map[string]func(conversion) conversionToRegex{
 		}
 	},
 	"n": func(conversion conversion) conversionToRegex {
+		// Tail strips newlines, so we can't match them.
 		return conversionToRegex{
 			Name:  `newline`,
-			Match: `[$\n]`,
+			Match: ``,
 		}
 	},
 	"thread": func(conversion conversion) conversionToRegex {
@@ -142,25 +131,28 @@ var groupChars = map[string]string{
 	`)`: `(`,
 }
 
-var dateFormats = map[string]string{
-	`yy`:  `\d{2}`,
-	`MM`:  `\d{2}`,
-	`dd`:  `\d{2}`,
-	`HH`:  `\d{2}`,
-	`mm`:  `\d{2}`,
-	`ss`:  `\d{2}`,
-	`SSS`: `\d{3}`,
-	`Z`:   `[+-]\d{4}`,
+var dateOptionRe = regexp.MustCompile(`\{([^}]*)}`)
+
+// datePattern returns the date pattern of a date conversion, its first option or the default.
+func datePattern(conversion conversion) string {
+	if options := dateOptionRe.FindStringSubmatch(conversion.Modifier); options != nil && options[1] != "" {
+		return options[1]
+	}
+	return javadate.Default
 }
 
-func convertDateFormat(format string) string {
-	// Escape all the characters that are special to regular expressions.
-	format = regexp.QuoteMeta(format)
-	// Replace all the date formats with their regex equivalent.
-	for k, v := range dateFormats {
-		format = strings.Replace(format, k, v, -1)
+// dateLayout returns the Go time layout matching the regexp of a date conversion, empty if Go can't parse its
+// dates, and the time zone named by its second option, e.g. the UTC of %d{yyyy-MM-dd HH:mm:ss.SSS}{UTC}.
+func dateLayout(conversion conversion) (string, *time.Location) {
+	layout := javadate.TranslateLog4j(datePattern(conversion)).Layout
+	options := dateOptionRe.FindAllStringSubmatch(conversion.Modifier, 2)
+	var loc *time.Location
+	if len(options) > 1 {
+		if l, err := time.LoadLocation(options[1][1]); err == nil {
+			loc = l
+		}
 	}
-	return format
+	return layout, loc
 }
 
 func Regexp(pattern string, customMatchers map[string]string) string {
@@ -169,39 +161,13 @@ func Regexp(pattern string, customMatchers map[string]string) string {
 
 func replacePatterns(message string, customMatchers map[string]string) string {
 	patterns := extractPatterns(message)
-	re := regexp.MustCompile(`%(?P<lj>-?)(?P<min>\d*)\.?(?P<max>\d*)(?P<pattern>\w+)(?P<modifier>[\[\{].*)?`)
-	leftJustifiedIndex := re.SubexpIndex("lj")
-	minCharsIndex := re.SubexpIndex("min")
-	maxCharsIndex := re.SubexpIndex("max")
-	patternIndex := re.SubexpIndex("pattern")
-	modifierIndex := re.SubexpIndex("modifier")
 	replacements := make(map[string]string)
 	for _, p := range patterns {
-		matches := re.FindStringSubmatch(p)
-		if matches == nil {
+		conversion, ok := parseConversion(p)
+		if !ok {
 			continue
 		}
-		leftJustified := matches[leftJustifiedIndex] == "-"
-		minChars, err := strconv.ParseUint(matches[minCharsIndex], 10, 8)
-		if err != nil {
-			minChars = uint64(0)
-		}
-		maxChars, err := strconv.ParseUint(matches[maxCharsIndex], 10, 64)
-		if err != nil {
-			maxChars = uint64(0)
-		}
-		pattern := aliases[matches[patternIndex]]
-		if pattern == "" {
-			continue
-		}
-		modifier := matches[modifierIndex]
-		conversion := conversion{
-			LeftJustified: leftJustified,
-			Min:           uint8(minChars),
-			Max:           maxChars,
-			Pattern:       pattern,
-			Modifier:      modifier,
-		}
+		pattern, modifier := conversion.Pattern, conversion.Modifier
 
 		// Skip X patterns with empty names - they should be escaped as literals
 		if pattern == "X" {
@@ -232,6 +198,36 @@ func replacePatterns(message string, customMatchers map[string]string) string {
 	return message
 }
 
+var conversionRe = regexp.MustCompile(`%(?P<lj>-?)(?P<min>\d*)\.?(?P<max>\d*)(?P<pattern>\w+)(?P<modifier>[\[\{].*)?`)
+
+// parseConversion parses a conversion extracted from a layout pattern, e.g. %-5p. It returns false if the
+// conversion is malformed or unknown.
+func parseConversion(p string) (conversion, bool) {
+	matches := conversionRe.FindStringSubmatch(p)
+	if matches == nil {
+		return conversion{}, false
+	}
+	minChars, err := strconv.ParseUint(matches[conversionRe.SubexpIndex("min")], 10, 8)
+	if err != nil {
+		minChars = uint64(0)
+	}
+	maxChars, err := strconv.ParseUint(matches[conversionRe.SubexpIndex("max")], 10, 64)
+	if err != nil {
+		maxChars = uint64(0)
+	}
+	pattern := aliases[matches[conversionRe.SubexpIndex("pattern")]]
+	if pattern == "" {
+		return conversion{}, false
+	}
+	return conversion{
+		LeftJustified: matches[conversionRe.SubexpIndex("lj")] == "-",
+		Min:           uint8(minChars),
+		Max:           maxChars,
+		Pattern:       pattern,
+		Modifier:      matches[conversionRe.SubexpIndex("modifier")],
+	}, true
+}
+
 func extractPatterns(pattern string) []string {
 	given := []rune(pattern)
 	var patterns []string
@@ -27,13 +27,13 @@ func TestRegex(t *testing.T) {
 		{`message (short pattern name)`, `%m`, `(?s)(?P<message>.*)(?-s)`},
 		{`message (medium pattern name)`, `%msg`, `(?s)(?P<message>.*)(?-s)`},
 		{`message (long pattern name)`, `%message`, `(?s)(?P<message>.*)(?-s)`},
-		{`date (short pattern name, default format)`, `%d`, `(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})`},
-		{`date (long pattern name, default format)`, `%date`, `(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})`},
-		{`date (custom format with decimal microseconds)`, `%d{yyyy-MM-dd HH:mm:ss.SSS Z}{UTC}`, `(?P<date>\d{2}\d{2}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3} [+-]\d{4})`},
-		{`date (custom format with comma microseconds)`, `%d{yyyy-MM-dd HH:mm:ss,SSS Z}{UTC}`, `(?P<date>\d{2}\d{2}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3} [+-]\d{4})`},
-		{`date (malformed opening brace only)`, `%d{`, `(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})`},
-		{`date (malformed incomplete format)`, `%d{incomplete`, `(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})`},
-		{`date (malformed square brackets)`, `%d[test]`, `(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})`},
+		{`date (short pattern name, default format)`, `%d`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3})`},
+		{`date (long pattern name, default format)`, `%date`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3})`},
+		{`date (custom format with decimal microseconds)`, `%d{yyyy-MM-dd HH:mm:ss.SSS Z}{UTC}`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3} [+-]\d{4})`},
+		{`date (custom format with comma microseconds)`, `%d{yyyy-MM-dd HH:mm:ss,SSS Z}{UTC}`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3} [+-]\d{4})`},
+		{`date (malformed opening brace only)`, `%d{`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3})`},
+		{`date (malformed incomplete format)`, `%d{incomplete`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3})`},
+		{`date (malformed square brackets)`, `%d[test]`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3})`},
 		{`X/MDC (malformed opening brace only)`, `%X{`, `%X\{`},
 		{`X/MDC (malformed empty braces)`, `%X{}`, `%X\{\}`},
 		{`X/MDC (single character key)`, `%X{a}`, `(?P<a>.*?)`},
@@ -41,6 +41,7 @@ func TestRegex(t *testing.T) {
 		{`invalid pattern (non-word char)`, `%!`, `%!`},
 		{`invalid pattern (unknown alias)`, `%999`, `%999`},
 		{`text with trailing percent`, `[%p] text%`, `\[(?P<level>\w+)\] text%`},
+		{`newline is dropped`, `%m%n`, `(?s)(?P<message>.*)(?-s)`},
 		{`empty string`, ``, ``},
 		{`no pattern markers`, `just text`, `just text`},
 	}
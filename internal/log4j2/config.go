@@ -53,19 +53,45 @@ func extractAppenders(parsedXml xmlNode, config *Config) {
 	child := parsedXml.Child("Appenders")
 	appenderNodes := child.Children()
 	for _, appenderNode := range appenderNodes {
-		var (
-			appenderType   string         = appenderNode.XMLName.Local
-			name           string         = getValue(appenderNode.Attribute("name"), config.Properties())
-			filename       string         = getValue(appenderNode.Attribute("fileName"), config.Properties())
-			filePattern    string         = getValue(appenderNode.Attribute("filePattern"), config.Properties())
-			patternLayout  *PatternLayout = extractPatternLayout(appenderNode, config.Properties())
-			immediateFlush bool           = appenderNode.Attribute("immediateFlush") == "true"
-		)
-
-		config.appenders[name] = NewAppender(name, appenderType, filename, filePattern, patternLayout, immediateFlush)
+		*config = withAppender(*config, appenderAttributes{
+			appenderType:   appenderNode.XMLName.Local,
+			name:           appenderNode.Attribute("name"),
+			filename:       appenderNode.Attribute("fileName"),
+			filePattern:    appenderNode.Attribute("filePattern"),
+			pattern:        extractPattern(appenderNode),
+			immediateFlush: appenderNode.Attribute("immediateFlush") == "true",
+		})
 	}
 }
 
+// appenderAttributes are the attributes of an appender that matter to its format, whatever the format of the
+// configuration it's read from. Their lookups, e.g. ${dir}, aren't resolved yet.
+type appenderAttributes struct {
+	appenderType   string
+	name           string
+	filename       string
+	filePattern    string
+	pattern        string // the pattern of the appender's PatternLayout, if any
+	immediateFlush bool
+}
+
+// withAppender adds an appender to a configuration, resolving its attributes' lookups with the configuration's
+// properties.
+func withAppender(config Config, a appenderAttributes) Config {
+	var (
+		name        string = getValue(a.name, config.Properties())
+		filename    string = getValue(a.filename, config.Properties())
+		filePattern string = getValue(a.filePattern, config.Properties())
+		pattern     string = a.pattern
+	)
+	if pattern == "" {
+		pattern = "%m%n" // Log4j2 default pattern
+	}
+	patternLayout := NewPatternLayout(getValue(pattern, config.Properties()))
+	config.appenders[name] = NewAppender(name, a.appenderType, filename, filePattern, patternLayout, a.immediateFlush)
+	return config
+}
+
 func getValue(key string, properties map[string]string) string {
 	re := regexp.MustCompile(`(\$\{[\w\.]+\})`)
 	for _, match := range re.FindAllString(key, -1) {
@@ -76,19 +102,12 @@ func getValue(key string, properties map[string]string) string {
 	return key
 }
 
-func extractPatternLayout(appenderNode xmlNode, properties map[string]string) *PatternLayout {
+func extractPattern(appenderNode xmlNode) string {
 	patternLayoutNode := appenderNode.Child("PatternLayout")
-	var pattern string
 	if patternLayoutNode.Attribute("pattern") != "" {
-		pattern = patternLayoutNode.Attribute("pattern")
-	} else if string(patternLayoutNode.Child("Pattern").Content) != "" {
-		pattern = string(patternLayoutNode.Child("Pattern").Content)
-	} else {
-		pattern = "%m%n" // Log4j2 default pattern
+		return patternLayoutNode.Attribute("pattern")
 	}
-	pattern = getValue(pattern, properties)
-	patternLayout := NewPatternLayout(pattern)
-	return patternLayout
+	return string(patternLayoutNode.Child("Pattern").Content)
 }
 
 type xmlNode struct {
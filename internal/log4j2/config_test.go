@@ -75,3 +75,44 @@ func TestXmlParser(t *testing.T) {
 
 	})
 }
+
+func TestFromProperties(t *testing.T) {
+	config := FromProperties([]byte(`property.dir = /var/log/app
+appender.rolling.type = RollingFile
+appender.rolling.fileName = ${dir}/app.log
+appender.rolling.layout.type = PatternLayout
+appender.rolling.layout.pattern = %d %p %c - %m%n
+appender.json.type = File
+appender.json.name = jsonFile
+appender.json.fileName = ${sys:app.home}/app.json
+appender.json.layout.type = JsonTemplateLayout
+`))
+	rolling, ok := config.Appenders()["rolling"]
+	if !ok || rolling.Type() != "RollingFile" || rolling.Filename() != "/var/log/app/app.log" || rolling.PatternLayout().Pattern() != "%d %p %c - %m%n" {
+		t.Errorf("expected the rolling appender, named after its identifier, got %+v", rolling)
+	}
+	json, ok := config.Appenders()["jsonFile"]
+	if !ok || json.Filename() != "${sys:app.home}/app.json" || json.PatternLayout().Pattern() != "%m%n" {
+		t.Errorf("expected the json appender, with its lookups and the default pattern, got %+v", json)
+	}
+}
+
+func TestFromTree(t *testing.T) {
+	config := FromYAML([]byte(`configuration:
+  appenders:
+    appender:
+      - type: File
+        name: first
+        fileName: first.log
+        patternLayout:
+          pattern: "%m%n"
+      - type: Console
+        name: second
+`))
+	if len(config.Appenders()) != 2 || config.Appenders()["first"].Filename() != "first.log" || config.Appenders()["second"].Type() != "Console" {
+		t.Errorf("expected appenders listed with their types, got %+v", config.Appenders())
+	}
+	if config := FromJSON([]byte(`{"configuration": `)); !config.Empty() {
+		t.Errorf("expected an empty configuration from invalid json, got %+v", config)
+	}
+}
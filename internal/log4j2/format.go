@@ -4,26 +4,70 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/highperformance-tech/ts-olly/internal/logformat"
 )
 
-func GetFormats(path string) (map[string]string, error) {
-	configXml, err := os.ReadFile(path)
+// GetFormats returns the formats of the files log4j2's appenders write to, by a pattern matching their names.
+// Console appenders write to stdout. The configuration may be XML, properties, YAML or JSON, according to its
+// extension.
+func GetFormats(path string) (map[string]logformat.Format, error) {
+	configFile, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read log4j2 config %s: %w", path, err)
 	}
-	cfg := NewConfig(configXml)
+	var cfg Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".properties":
+		cfg = FromProperties(configFile)
+	case ".yaml", ".yml":
+		cfg = FromYAML(configFile)
+	case ".json":
+		cfg = FromJSON(configFile)
+	default:
+		cfg = NewConfig(configFile)
+	}
 	if cfg.Empty() {
 		return nil, fmt.Errorf("invalid configuration in %s", path)
 	}
-	formats := make(map[string]string)
+	formats := make(map[string]logformat.Format)
 	for _, appender := range cfg.Appenders() {
-		if appender.PatternLayout() != nil {
-			formatName := filepath.Base(appender.Filename())
-			if appender.Name() == "standardOut" {
-				formatName = "stdout"
-			}
-			formats[formatName] = Regexp(appender.PatternLayout().Pattern(), make(map[string]string))
+		if appender.PatternLayout() == nil {
+			continue
+		}
+		formatName := filePattern(appender.Filename())
+		if appender.Type() == "Console" || appender.Name() == "standardOut" {
+			formatName = "stdout"
 		}
+		if formatName == "" {
+			continue
+		}
+		formats[formatName] = Format(appender.PatternLayout().Pattern())
 	}
 	return formats, nil
 }
+
+var lookup = regexp.MustCompile(`\$\{[^}]*\}`)
+
+// filePattern returns a glob matching the name of the file an appender writes to, whose lookups that the
+// configuration's properties don't resolve, e.g. ${sys:app.name}, match any text.
+func filePattern(filename string) string {
+	if filename == "" {
+		return ""
+	}
+	filename = strings.ReplaceAll(filename, "${sys:file.separator}", "/")
+	return lookup.ReplaceAllString(filepath.Base(filename), "*")
+}
+
+// Format returns the format of the entries written with the given layout pattern. Their time is taken from
+// the pattern's date conversion.
+func Format(pattern string) logformat.Format {
+	f := logformat.Format{Regexp: Regexp(pattern, make(map[string]string))}
+	if c, ok := find(parsePattern(pattern), "date"); ok {
+		f.Time = []string{"date"}
+		f.Layout, f.Location = dateLayout(c)
+	}
+	return f
+}
@@ -1,6 +1,9 @@
 package log4j2
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestGetFormats(t *testing.T) {
 	t.Run("valid log4j2.xml configuration returns valid instance", func(t *testing.T) {
@@ -11,8 +14,8 @@ func TestGetFormats(t *testing.T) {
 		if len(formats) != 2 {
 			t.Errorf("expected 2 formats, got %d", len(formats))
 		}
-		if formats["activationservice-metrics_node1-0.log"] != "(?s)(?P<message>.*)(?-s)" {
-			t.Errorf("expected format %q, got %q", "(?s)(?P<message>.*)(?-s)", formats["activationservice-metrics_node1-0.log"])
+		if formats["activationservice-metrics_node1-0.log"].Regexp != "(?s)(?P<message>.*)(?-s)" {
+			t.Errorf("expected format %q, got %q", "(?s)(?P<message>.*)(?-s)", formats["activationservice-metrics_node1-0.log"].Regexp)
 		}
 	})
 	t.Run("valid controlapp.log4j2.xml configuration returns valid instance", func(t *testing.T) {
@@ -23,8 +26,26 @@ func TestGetFormats(t *testing.T) {
 		if len(formats) != 2 {
 			t.Errorf("expected 2 formats, got %d", len(formats))
 		}
-		if formats["activationservice-metrics_node1-0.log"] != "(?s)(?P<message>.*)(?-s)" {
-			t.Errorf("expected format %q, got %q", "(?s)(?P<message>.*)(?-s)", formats["activationservice-metrics_node1-0.log"])
+		if formats["activationservice-metrics_node1-0.log"].Regexp != "(?s)(?P<message>.*)(?-s)" {
+			t.Errorf("expected format %q, got %q", "(?s)(?P<message>.*)(?-s)", formats["activationservice-metrics_node1-0.log"].Regexp)
+		}
+	})
+	t.Run("every configuration format returns the same formats", func(t *testing.T) {
+		want, err := GetFormats("testdata/controlapp.log4j2.xml")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, ok := want["control_activationservice_node1-0.log"]; !ok || len(want) != 2 {
+			t.Fatalf("expected the formats of the file and stdout, got %v", want)
+		}
+		for _, path := range []string{"testdata/controlapp.log4j2.properties", "testdata/controlapp.log4j2.yaml", "testdata/controlapp.log4j2.json"} {
+			got, err := GetFormats(path)
+			if err != nil {
+				t.Errorf("%s: expected no error, got %v", path, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: expected %v, got %v", path, want, got)
+			}
 		}
 	})
 	t.Run("invalid configuration returns error", func(t *testing.T) {
@@ -35,3 +56,20 @@ func TestGetFormats(t *testing.T) {
 		}
 	})
 }
+
+func TestFilePattern(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"/var/log/app/app.log", "app.log"},
+		{"${sys:opensearch.logs.base_path}${sys:file.separator}${sys:opensearch.logs.cluster_name}_deprecation.log", "*_deprecation.log"},
+		{"${env:LOG_DIR}/${hostName}.log", "*.log"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := filePattern(tt.filename); got != tt.want {
+			t.Errorf("expected %q for %q, got %q", tt.want, tt.filename, got)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package log4j2
+
+import "strings"
+
+// node is an element of a parsed layout pattern: either a literal or a conversion.
+type node interface{}
+
+// literal is text that a layout writes as is.
+type literal string
+
+// conversion is a conversion specifier, e.g. %-5.10c{1.}.
+type conversion struct {
+	LeftJustified bool     // pad on the right rather than the left
+	Min           int      // minimum field width, padded with spaces
+	Max           int      // maximum field width; 0 means unlimited
+	TruncateEnd   bool     // truncate to Max by dropping the end of the field rather than its start
+	Pattern       string   // canonical name of the converter
+	Options       []string // the contents of the braces that follow the converter's name
+	Children      []node   // the parsed first option of converters that wrap a pattern, e.g. %highlight{%p}
+	Source        string   // the text of the conversion in the pattern
+}
+
+// wrappers are the converters whose first option is itself a pattern.
+var wrappers = map[string]bool{
+	"enc":       true,
+	"equals":    true,
+	"highlight": true,
+	"maxLen":    true,
+	"notEmpty":  true,
+	"replace":   true,
+	"style":     true,
+}
+
+// specialChars are the escape sequences PatternLayout replaces in its pattern before parsing it.
+var specialChars = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r", `\t`, "\t", `\f`, "\f", `\b`, "\b", `\"`, `"`, `\'`, `'`)
+
+// parsePattern parses a PatternLayout pattern.
+func parsePattern(pattern string) []node {
+	p := parser{s: specialChars.Replace(pattern)}
+	return p.pattern()
+}
+
+// parser is a recursive-descent parser of the PatternLayout grammar:
+//
+//	pattern    = { literal | "%%" | conversion }
+//	conversion = "%" [ "-" ] [ digits ] [ "." [ "-" ] digits ] name { "{" option "}" }
+//
+// in which an option may contain nested braces. A % that doesn't start a conversion is a literal, and an
+// option whose closing brace is missing is empty.
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) pattern() []node {
+	var nodes []node
+	var text strings.Builder
+	for p.pos < len(p.s) {
+		if p.s[p.pos] != '%' {
+			text.WriteByte(p.s[p.pos])
+			p.pos++
+			continue
+		}
+		if strings.HasPrefix(p.s[p.pos:], "%%") {
+			text.WriteByte('%')
+			p.pos += 2
+			continue
+		}
+		start := p.pos
+		c, ok := p.conversion()
+		if !ok {
+			text.WriteString(p.s[start:p.pos])
+			continue
+		}
+		if text.Len() > 0 {
+			nodes = append(nodes, literal(text.String()))
+			text.Reset()
+		}
+		nodes = append(nodes, c)
+	}
+	if text.Len() > 0 {
+		nodes = append(nodes, literal(text.String()))
+	}
+	return nodes
+}
+
+// conversion parses the conversion at the current position. If there's no converter name after the format
+// modifier, it returns false, having consumed the % and the modifier.
+func (p *parser) conversion() (conversion, bool) {
+	start := p.pos
+	p.pos++
+	var c conversion
+	if p.accept('-') {
+		c.LeftJustified = true
+	}
+	c.Min = p.number()
+	if p.accept('.') {
+		c.TruncateEnd = p.accept('-')
+		c.Max = p.number()
+	}
+	name := p.name()
+	if name == "" {
+		return conversion{}, false
+	}
+	c.Pattern = name
+	if alias, ok := aliases[name]; ok {
+		c.Pattern = alias
+	}
+	for p.pos < len(p.s) && p.s[p.pos] == '{' {
+		option, closed := p.option()
+		c.Options = append(c.Options, option)
+		if !closed {
+			break
+		}
+	}
+	c.Source = p.s[start:p.pos]
+	if wrappers[c.Pattern] && len(c.Options) > 0 {
+		children := parser{s: c.Options[0]}
+		c.Children = children.pattern()
+	}
+	return c, true
+}
+
+func (p *parser) accept(b byte) bool {
+	if p.pos < len(p.s) && p.s[p.pos] == b {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) number() int {
+	n := 0
+	for p.pos < len(p.s) && '0' <= p.s[p.pos] && p.s[p.pos] <= '9' {
+		n = n*10 + int(p.s[p.pos]-'0')
+		p.pos++
+	}
+	return n
+}
+
+// name reads a converter name: letters, digits and underscores, the first of which isn't a digit.
+func (p *parser) name() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		b := p.s[p.pos]
+		if !(b == '_' || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || (p.pos > start && '0' <= b && b <= '9')) {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// option reads a brace-enclosed option, returning false, and an empty option, if its closing brace is missing.
+func (p *parser) option() (string, bool) {
+	start := p.pos + 1
+	depth := 0
+	for ; p.pos < len(p.s); p.pos++ {
+		switch p.s[p.pos] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos++
+				return p.s[start : p.pos-1], true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,56 @@
+package log4j2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		description string
+		given       string
+		expected    []node
+	}{
+		{"literals and conversions", "%d [%t] %m", []node{
+			conversion{Pattern: "date", Source: "%d"},
+			literal(" ["),
+			conversion{Pattern: "thread", Source: "%t"},
+			literal("] "),
+			conversion{Pattern: "message", Source: "%m"},
+		}},
+		{"format modifiers", "%-5.10p%.-20c", []node{
+			conversion{LeftJustified: true, Min: 5, Max: 10, Pattern: "level", Source: "%-5.10p"},
+			conversion{Max: 20, TruncateEnd: true, Pattern: "logger", Source: "%.-20c"},
+		}},
+		{"options", "%d{yyyy-MM-dd}{UTC}", []node{
+			conversion{Pattern: "date", Options: []string{"yyyy-MM-dd", "UTC"}, Source: "%d{yyyy-MM-dd}{UTC}"},
+		}},
+		{"wrapped pattern with nested braces", "%highlight{%d{HH:mm} %p}{STYLE=Logback}", []node{
+			conversion{Pattern: "highlight", Options: []string{"%d{HH:mm} %p", "STYLE=Logback"}, Source: "%highlight{%d{HH:mm} %p}{STYLE=Logback}", Children: []node{
+				conversion{Pattern: "date", Options: []string{"HH:mm"}, Source: "%d{HH:mm}"},
+				literal(" "),
+				conversion{Pattern: "level", Source: "%p"},
+			}},
+		}},
+		{"escaped percent and special characters", `%%\t%n`, []node{
+			literal("%\t"),
+			conversion{Pattern: "n", Source: "%n"},
+		}},
+		{"missing closing brace", "%d{HH:mm %m", []node{
+			conversion{Pattern: "date", Options: []string{""}, Source: "%d{HH:mm %m"},
+		}},
+		{"percent without a converter name", "%-5 %", []node{
+			literal("%-5 %"),
+		}},
+		{"unknown converter", "%node_name", []node{
+			conversion{Pattern: "node_name", Source: "%node_name"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			if got := parsePattern(tt.given); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("given %q, expected %#v, got %#v", tt.given, tt.expected, got)
+			}
+		})
+	}
+}
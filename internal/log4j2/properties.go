@@ -0,0 +1,69 @@
+package log4j2
+
+import (
+	"strings"
+
+	"github.com/magiconair/properties"
+)
+
+// FromProperties returns the configuration of a log4j2.properties file, e.g.
+//
+//	property.dir = /var/log/app
+//	appender.rolling.type = RollingFile
+//	appender.rolling.fileName = ${dir}/app.log
+//	appender.rolling.layout.type = PatternLayout
+//	appender.rolling.layout.pattern = %d %p %c - %m%n
+func FromProperties(configProperties []byte) Config {
+	config := Config{
+		appenders:  map[string]Appender{},
+		properties: map[string]string{},
+	}
+	// Lookups are resolved by getValue, as in other configurations, rather than from the environment.
+	loader := properties.Loader{Encoding: properties.UTF8, DisableExpansion: true}
+	p, err := loader.LoadBytes(configProperties)
+	if err != nil {
+		return config
+	}
+	// The attributes of each appender, by its identifier and the attribute's lower-case name, e.g. layout.pattern.
+	attributes := make(map[string]map[string]string)
+	var ids []string
+	for _, key := range p.Keys() {
+		value := p.GetString(key, "")
+		if name, ok := strings.CutPrefix(key, "property."); ok {
+			config.properties[name] = value
+			continue
+		}
+		rest, ok := strings.CutPrefix(key, "appender.")
+		if !ok {
+			continue
+		}
+		id, attribute, ok := strings.Cut(rest, ".")
+		if !ok {
+			continue
+		}
+		if _, ok := attributes[id]; !ok {
+			attributes[id] = make(map[string]string)
+			ids = append(ids, id)
+		}
+		attributes[id][strings.ToLower(attribute)] = value
+	}
+	for _, id := range ids {
+		a := attributes[id]
+		if a["type"] == "" {
+			continue
+		}
+		name := a["name"]
+		if name == "" {
+			name = id
+		}
+		config = withAppender(config, appenderAttributes{
+			appenderType:   a["type"],
+			name:           name,
+			filename:       a["filename"],
+			filePattern:    a["filepattern"],
+			pattern:        a["layout.pattern"],
+			immediateFlush: a["immediateflush"] == "true",
+		})
+	}
+	return config
+}
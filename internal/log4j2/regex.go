@@ -3,286 +3,339 @@ package log4j2
 import (
 	"fmt"
 	"regexp"
-	"strconv"
 	"strings"
-)
-
-// log4jPatterns is a map of functions that will replace a logs pattern with
-// a Go regexp pattern.
-var log4jPatterns = map[string]func(conversion) conversionToRegex{
-	"date": func(conversion conversion) conversionToRegex {
-		// If there's no modifier, use the default date format as per
-		// https://logging.apache.org/log4j/log4j-2.1/manual/layouts.html
-		pattern := `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3}`
-
-		// If there's a modifier, use it to format the date
-		if conversion.Modifier != "" {
-			// We don't care about a timezone modifier (the second parameter), because it just changes the numbers, not their format.
-			// Extract the first match of `\{[^}]*\}` from the modifier and use it as the format input.
-			re := regexp.MustCompile(`\{([^}]*)}`)
-			matches := re.FindStringSubmatch(conversion.Modifier)
-			if len(matches) > 1 {
-				format := matches[1]
-				pattern = convertDateFormat(format)
-			}
+	"time"
 
-		}
+	"github.com/highperformance-tech/ts-olly/internal/javadate"
+)
 
-		return conversionToRegex{
-			Name:  `date`,
-			Match: fmt.Sprintf(`(?P<date>%s)`, pattern),
+// log4jPatterns is a map of functions that return the Go regexp matching what a converter writes, keyed by the
+// converter's canonical name.
+var log4jPatterns = map[string]func(g generator, c conversion) string{
+	"class": named(`class`, `\S+`),
+	"date": func(g generator, c conversion) string {
+		// Without an option, the date has the default format, as per
+		// https://logging.apache.org/log4j/2.x/manual/pattern-layout.html. We don't care about a timezone option
+		// (the second one), because it just changes the numbers, not their format.
+		return fmt.Sprintf(`(?P<date>%s)`, javadate.Translate(datePattern(c)).Regexp)
+	},
+	"enc": func(g generator, c conversion) string {
+		return g.regexp(c.Children)
+	},
+	"endOfBatch": func(g generator, c conversion) string {
+		return `(?:true|false)`
+	},
+	"equals": func(g generator, c conversion) string {
+		// %equals{pattern}{test}{substitution} writes the substitution instead of the test string.
+		if len(c.Options) < 3 {
+			return g.regexp(c.Children)
 		}
+		return `(?:` + g.regexp(c.Children) + `|` + regexp.QuoteMeta(c.Options[2]) + `)`
+	},
+	"exception": func(g generator, c conversion) string {
+		return `(?s)(?P<throwable>.*)(?-s)`
 	},
-	"number": func(conversion conversion) conversionToRegex {
+	"file":      named(`file`, `\S+`),
+	"fqcn":      named(`fqcn`, `\S+`),
+	"highlight": ansi,
+	"level": func(g generator, c conversion) string {
+		return `(?P<level>\w+)`
+	},
+	"line":     named(`line`, `\d+`),
+	"location": named(`location`, `\S+?\([^)]*\)`),
+	"logger": func(g generator, c conversion) string {
 		// Regardless of the precision, we'll match anything that's not a space.
-		return conversionToRegex{
-			Name:  `number`,
-			Match: `(?P<number>\d+)`,
-		}
+		return `(?P<logger>\S+)`
 	},
-	"level": func(conversion conversion) conversionToRegex {
-		// If we're given a minimum width, we need to allow for zero or more spaces
-		padding := ``
-		if conversion.Min != 0 {
-			padding = `\s*`
-		}
-		// If we're left-justified, we pad on the right. Otherwise, we pad on the left.
-		leftPadding := ``
-		rightPadding := ``
-		if conversion.LeftJustified {
-			rightPadding = padding
-		} else {
-			leftPadding = padding
-		}
-		// Return the conversion.
-		return conversionToRegex{
-			Name:  `level`,
-			Match: fmt.Sprintf(`%s(?P<level>\w+)%s`, leftPadding, rightPadding),
-		}
+	"map":    named(`map`, `\{.*?\}`),
+	"marker": named(`marker`, `\S*`),
+	"maxLen": func(g generator, c conversion) string {
+		// Fields longer than 20 characters are truncated with an ellipsis.
+		return g.regexp(c.Children) + `(?:\.\.\.)?`
 	},
-	"logger": func(conversion conversion) conversionToRegex {
+	"message": func(g generator, c conversion) string {
+		return `(?s)(?P<message>.*)(?-s)`
+	},
+	"method": named(`method`, `\S+`),
+	"n": func(g generator, c conversion) string {
+		// Tail strips newlines, so we can't match them.
+		return ``
+	},
+	"nano": named(`nano`, `-?\d+`),
+	"ndc":  named(`ndc`, `.*?`),
+	"notEmpty": func(g generator, c conversion) string {
+		return `(?:` + g.regexp(c.Children) + `)?`
+	},
+	"number": func(g generator, c conversion) string {
 		// Regardless of the precision, we'll match anything that's not a space.
-		return conversionToRegex{
-			Name:  `logger`,
-			Match: `(?P<logger>\S+)`,
-		}
+		return `(?P<number>\d+)`
 	},
-	"message": func(conversion conversion) conversionToRegex {
-		return conversionToRegex{
-			Name:  `message`,
-			Match: `(?s)(?P<message>.*)(?-s)`,
+	"pid":      named(`pid`, `\d+`),
+	"priority": named(`priority`, `\d+`),
+	"relative": named(`relative`, `\d+`),
+	"replace": func(g generator, c conversion) string {
+		// The replacement can turn the field into anything, so it's taken to run up to what follows it: the
+		// next literal's first character, a space before another field, or the end of the entry.
+		re := `(?s:.*)`
+		if len(g.rest) > 0 {
+			re = `\S*`
+			if l, ok := g.rest[0].(literal); ok {
+				re = `[^` + regexp.QuoteMeta(string(l[0])) + `]*`
+			}
 		}
-	},
-	"n": func(conversion conversion) conversionToRegex {
-		return conversionToRegex{
-			Name: `newline`,
-			//Match: `[$\n]`, // Tail strips newlines, so we can't match them.
+		// The field of a single converter keeps its capture group, e.g. the message of %replace{%m}{\n}{ }.
+		if len(c.Children) == 1 {
+			if m := groupRe.FindStringSubmatch(g.regexp(c.Children)); m != nil {
+				return `(?P<` + m[1] + `>` + re + `)`
+			}
 		}
+		return re
 	},
-	"thread": func(conversion conversion) conversionToRegex {
-		return conversionToRegex{
-			Name:  `thread`,
-			Match: `(?P<thread>\S*)`,
-		}
+	"sequence": named(`sequence`, `\d+`),
+	"style":    ansi,
+	"thread": func(g generator, c conversion) string {
+		return `(?P<thread>\S*)`
 	},
-	"X": func(conversion conversion) conversionToRegex {
-		// This capture group will be named based on the text in the modifier.
-		name := ""
-		if len(conversion.Modifier) >= 2 {
-			name = strings.ToLower(conversion.Modifier[1 : len(conversion.Modifier)-1])
+	"tid":  named(`tid`, `\d+`),
+	"uuid": named(`uuid`, `[0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}`),
+	"X": func(g generator, c conversion) string {
+		// Without a key, the whole MDC is written as a map.
+		if len(c.Options) == 0 {
+			return `(?P<mdc>\{.*?\})`
 		}
-		return conversionToRegex{
-			Name:  name,
-			Match: `(?P<` + name + `>.*?)`,
+		// Otherwise this capture group will be named based on the key.
+		name := groupName(c.Options[0])
+		if name == "" {
+			return regexp.QuoteMeta(c.Source)
 		}
+		return `(?P<` + name + `>.*?)`
 	},
 }
 
-// aliases is a map of aliases for logs patterns.
-var aliases = map[string]string{
-	"c":       "logger",
-	"d":       "date",
-	"date":    "date",
-	"i":       "number",
-	"level":   "level",
-	"logger":  "logger",
-	"m":       "message",
-	"mdc":     "message",
-	"MDC":     "message",
-	"message": "message",
-	"msg":     "message",
-	"n":       "n",
-	"p":       "level",
-	"t":       "thread",
-	"thread":  "thread",
-	"X":       "X",
+// named returns a converter function that captures a field matching re in a group with the given name.
+func named(name, re string) func(generator, conversion) string {
+	return func(generator, conversion) string {
+		return `(?P<` + name + `>` + re + `)`
+	}
 }
 
-type conversion struct {
-	LeftJustified bool
-	Min           uint8
-	Max           uint64
-	Pattern       string
-	Modifier      string
+// ansi is the converter function of %highlight and %style, which wrap a pattern in ANSI escape codes unless
+// they're disabled.
+func ansi(g generator, c conversion) string {
+	const escape = `(?:\x1b\[[\d;]*m)?`
+	return escape + g.regexp(c.Children) + escape
 }
 
-type conversionToRegex struct {
-	Name  string
-	Match string
+// aliases maps the names of converters to their canonical names.
+var aliases = map[string]string{
+	"black":             "style",
+	"blue":              "style",
+	"C":                 "class",
+	"c":                 "logger",
+	"class":             "class",
+	"cyan":              "style",
+	"d":                 "date",
+	"date":              "date",
+	"enc":               "enc",
+	"encode":            "enc",
+	"endOfBatch":        "endOfBatch",
+	"equals":            "equals",
+	"equalsIgnoreCase":  "equals",
+	"ex":                "exception",
+	"exception":         "exception",
+	"F":                 "file",
+	"file":              "file",
+	"fqcn":              "fqcn",
+	"green":             "style",
+	"highlight":         "highlight",
+	"i":                 "number",
+	"K":                 "map",
+	"L":                 "line",
+	"l":                 "location",
+	"level":             "level",
+	"line":              "line",
+	"location":          "location",
+	"logger":            "logger",
+	"M":                 "method",
+	"m":                 "message",
+	"magenta":           "style",
+	"MAP":               "map",
+	"map":               "map",
+	"marker":            "marker",
+	"markerSimpleName":  "marker",
+	"maxLen":            "maxLen",
+	"maxLength":         "maxLen",
+	"MDC":               "X",
+	"mdc":               "X",
+	"message":           "message",
+	"method":            "method",
+	"msg":               "message",
+	"N":                 "nano",
+	"n":                 "n",
+	"nano":              "nano",
+	"NDC":               "ndc",
+	"notEmpty":          "notEmpty",
+	"p":                 "level",
+	"pid":               "pid",
+	"processId":         "pid",
+	"r":                 "relative",
+	"red":               "style",
+	"relative":          "relative",
+	"replace":           "replace",
+	"rEx":               "exception",
+	"rException":        "exception",
+	"rThrowable":        "exception",
+	"sequenceNumber":    "sequence",
+	"sn":                "sequence",
+	"style":             "style",
+	"T":                 "tid",
+	"t":                 "thread",
+	"thread":            "thread",
+	"threadId":          "tid",
+	"threadName":        "thread",
+	"threadPriority":    "priority",
+	"throwable":         "exception",
+	"tid":               "tid",
+	"tn":                "thread",
+	"tp":                "priority",
+	"u":                 "uuid",
+	"uuid":              "uuid",
+	"variablesNotEmpty": "notEmpty",
+	"varsNotEmpty":      "notEmpty",
+	"white":             "style",
+	"X":                 "X",
+	"x":                 "ndc",
+	"xEx":               "exception",
+	"xException":        "exception",
+	"xThrowable":        "exception",
+	"yellow":            "style",
 }
 
-var groupChars = map[string]string{
-	`(`: `)`,
-	`{`: `}`,
-	`[`: `]`,
-	`>`: `<`,
-	`<`: `>`,
-	`]`: `[`,
-	`}`: `{`,
-	`)`: `(`,
+var groupNameRe = regexp.MustCompile(`\W+`)
+
+// groupName turns an MDC key into a capture group name.
+func groupName(key string) string {
+	return groupNameRe.ReplaceAllString(strings.ToLower(key), "_")
 }
 
-var dateFormats = map[string]string{
-	`yy`:  `\d{2}`,
-	`MM`:  `\d{2}`,
-	`dd`:  `\d{2}`,
-	`HH`:  `\d{2}`,
-	`mm`:  `\d{2}`,
-	`ss`:  `\d{2}`,
-	`SSS`: `\d{3}`,
-	`Z`:   `[+-]\d{4}`,
+// datePattern returns the date pattern of a date conversion, its first option or the default.
+func datePattern(c conversion) string {
+	if len(c.Options) > 0 && c.Options[0] != "" {
+		return c.Options[0]
+	}
+	return javadate.Default
 }
 
-func convertDateFormat(format string) string {
-	// Escape all the characters that are special to regular expressions.
-	format = regexp.QuoteMeta(format)
-	// Replace all the date formats with their regex equivalent.
-	for k, v := range dateFormats {
-		format = strings.Replace(format, k, v, -1)
+// dateLayout returns the Go time layout matching the regexp of a date conversion, empty if Go can't parse its
+// dates, and the time zone named by its second option, e.g. the UTC of %d{yyyy-MM-dd HH:mm:ss.SSS}{UTC}.
+func dateLayout(c conversion) (string, *time.Location) {
+	layout := javadate.Translate(datePattern(c)).Layout
+	var loc *time.Location
+	if len(c.Options) > 1 {
+		if l, err := time.LoadLocation(c.Options[1]); err == nil {
+			loc = l
+		}
 	}
-	return format
+	return layout, loc
 }
 
+// Regexp returns a Go regexp matching the entries written with a PatternLayout pattern. customMatchers
+// replace the regexps of the conversions they're keyed by, e.g. %X{lorem}.
 func Regexp(pattern string, customMatchers map[string]string) string {
-	return replacePatterns(pattern, customMatchers)
+	return generator{converters: log4jPatterns, customMatchers: customMatchers}.regexp(parsePattern(pattern))
 }
 
-func replacePatterns(message string, customMatchers map[string]string) string {
-	patterns := extractPatterns(message)
-	re := regexp.MustCompile(`%(?P<lj>-?)(?P<min>\d*)\.?(?P<max>\d*)(?P<pattern>\w+)(?P<modifier>[\[\{].*)?`)
-	leftJustifiedIndex := re.SubexpIndex("lj")
-	minCharsIndex := re.SubexpIndex("min")
-	maxCharsIndex := re.SubexpIndex("max")
-	patternIndex := re.SubexpIndex("pattern")
-	modifierIndex := re.SubexpIndex("modifier")
-	replacements := make(map[string]string)
-	for _, p := range patterns {
-		matches := re.FindStringSubmatch(p)
-		if matches == nil {
-			continue
-		}
-		leftJustified := matches[leftJustifiedIndex] == "-"
-		minChars, err := strconv.ParseUint(matches[minCharsIndex], 10, 8)
-		if err != nil {
-			minChars = uint64(0)
-		}
-		maxChars, err := strconv.ParseUint(matches[maxCharsIndex], 10, 64)
-		if err != nil {
-			maxChars = uint64(0)
-		}
-		pattern := aliases[matches[patternIndex]]
-		if pattern == "" {
-			continue
-		}
-		modifier := matches[modifierIndex]
-		conversion := conversion{
-			LeftJustified: leftJustified,
-			Min:           uint8(minChars),
-			Max:           maxChars,
-			Pattern:       pattern,
-			Modifier:      modifier,
-		}
+// generator walks a parsed pattern to build its regexp.
+type generator struct {
+	converters     map[string]func(g generator, c conversion) string
+	customMatchers map[string]string
+	rest           []node // the nodes that follow the one being converted, including those after its wrapper
+}
 
-		// Skip X patterns with empty names - they should be escaped as literals
-		if pattern == "X" {
-			name := ""
-			if len(modifier) >= 2 {
-				name = strings.ToLower(modifier[1 : len(modifier)-1])
-			}
-			if name == "" {
-				// Skip this pattern, it will be escaped as a literal
-				continue
-			}
+func (g generator) regexp(nodes []node) string {
+	var re strings.Builder
+	rest := g.rest
+	for i, n := range nodes {
+		g.rest = rest
+		if i+1 < len(nodes) {
+			g.rest = nodes[i+1:]
 		}
-
-		replacementString := "\u0000" + log4jPatterns[pattern](conversion).Name + "\u0000" // this is a hack to make sure the replacement string is unique (e.g. loremipsum's "ipsum" isn't replaced with ipsum's regex
-		if customMatchers[p] != "" {
-			replacements[replacementString] = customMatchers[p]
-		} else {
-			replacements[replacementString] = log4jPatterns[pattern](conversion).Match
+		switch n := n.(type) {
+		case literal:
+			re.WriteString(regexp.QuoteMeta(string(n)))
+		case conversion:
+			re.WriteString(g.conversion(n))
 		}
-		message = strings.Replace(message, p, replacementString, -1)
 	}
-	// Now we'll escape the message.
-	message = regexp.QuoteMeta(message)
-	// Now we'll replace the replacements.
-	for k, v := range replacements {
-		message = strings.Replace(message, k, v, -1)
+	return re.String()
+}
+
+// conversion returns the regexp of a conversion. Converters we don't know, e.g. plugins, are taken to write
+// a single word. Fields with a minimum width may be padded with spaces, on the right if they're
+// left-justified and on the left otherwise, and those with a maximum width are truncated to it.
+func (g generator) conversion(c conversion) string {
+	if re := g.customMatchers[c.Source]; re != "" {
+		return re
+	}
+	var re string
+	if convert, ok := g.converters[c.Pattern]; ok {
+		re = convert(g, c)
+	} else {
+		re = `(?P<` + groupName(c.Pattern) + `>\S*)`
+	}
+	re = truncate(re, c.Max)
+	if c.Min == 0 || re == "" {
+		return re
+	}
+	if c.LeftJustified {
+		return re + `\s*`
 	}
-	return message
+	return `\s*` + re
 }
 
-func extractPatterns(pattern string) []string {
-	given := []rune(pattern)
-	var patterns []string
-	var currentPattern string
-	inPattern := false
-	groupLevel := uint8(0)
-	groups := make(map[uint8]string)
-	for pos, char := range given {
-		if pos == len(given)-1 {
-			currentPattern += string(char)
-			patterns = append(patterns, currentPattern)
-			break
-		}
-		if !inPattern {
-			if char == '%' {
-				inPattern = true
-				currentPattern = string(char)
-			}
-			continue
-		}
+var (
+	// groupRe matches the first capture group of a regexp.
+	groupRe = regexp.MustCompile(`\(\?P<(\w+)>`)
+	// repeatRe matches a converter's regexp that captures repeated characters, e.g. (?P<logger>\S+).
+	repeatRe = regexp.MustCompile(`^((?:\(\?s\))?\(\?P<\w+>)(\\[SDdWw]|\.|\[[^\]]*\])([*+])(\??)(\)(?:\(\?-s\))?)$`)
+)
 
-		if char == '%' {
-			patterns = append(patterns, currentPattern)
-			currentPattern = string(char)
-			continue
-		}
-		if char == '{' || char == '[' || char == '(' || char == '<' {
-			groupLevel++
-			currentPattern += string(char)
-			groups[groupLevel] = string(char)
-			continue
+// truncate bounds the regexp of a field to max characters. A field truncated from either end is still made of
+// its converter's characters, so that a repeat keeps its character class; other fields, e.g. dates, lose their
+// shape and match any characters. Go's regexps can't repeat more than 1000 times, so longer fields are left
+// unbounded.
+func truncate(re string, max int) string {
+	if max == 0 || max > 1000 || re == "" {
+		return re
+	}
+	if m := repeatRe.FindStringSubmatch(re); m != nil {
+		min := 0
+		if m[3] == "+" {
+			min = 1
 		}
-		if (char == '}' || char == ']' || char == ')' || char == '>') && groupLevel > 0 && groups[groupLevel] == groupChars[string(char)] {
-			delete(groups, groupLevel)
-			groupLevel--
-			currentPattern += string(char)
+		return fmt.Sprintf(`%s%s{%d,%d}%s%s`, m[1], m[2], min, max, m[4], m[5])
+	}
+	bounded := fmt.Sprintf(`.{0,%d}`, max)
+	if m := groupRe.FindStringSubmatch(re); m != nil && strings.Count(re, "(?P<") == 1 {
+		return `(?P<` + m[1] + `>` + bounded + `)`
+	}
+	return bounded
+}
+
+// find returns the first conversion with the given canonical name, looking inside the patterns that converters
+// wrap.
+func find(nodes []node, pattern string) (conversion, bool) {
+	for _, n := range nodes {
+		c, ok := n.(conversion)
+		if !ok {
 			continue
 		}
-		if groupLevel != 0 {
-			currentPattern += string(char)
-			continue
+		if c.Pattern == pattern {
+			return c, true
 		}
-		if groupLevel == 0 {
-			if regexp.MustCompile(`[\w\d_\.-]`).MatchString(string(char)) {
-				currentPattern += string(char)
-				continue
-			}
-			patterns = append(patterns, currentPattern)
-			inPattern = false
-			currentPattern = ""
+		if c, ok := find(c.Children, pattern); ok {
+			return c, true
 		}
 	}
-	return patterns
+	return conversion{}, false
 }
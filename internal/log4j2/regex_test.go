@@ -27,13 +27,13 @@ func TestRegex(t *testing.T) {
 		{`message (short pattern name)`, `%m`, `(?s)(?P<message>.*)(?-s)`},
 		{`message (medium pattern name)`, `%msg`, `(?s)(?P<message>.*)(?-s)`},
 		{`message (long pattern name)`, `%message`, `(?s)(?P<message>.*)(?-s)`},
-		{`date (short pattern name, default format)`, `%d`, `(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})`},
-		{`date (long pattern name, default format)`, `%date`, `(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})`},
-		{`date (custom format with decimal microseconds)`, `%d{yyyy-MM-dd HH:mm:ss.SSS Z}{UTC}`, `(?P<date>\d{2}\d{2}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3} [+-]\d{4})`},
-		{`date (custom format with comma microseconds)`, `%d{yyyy-MM-dd HH:mm:ss,SSS Z}{UTC}`, `(?P<date>\d{2}\d{2}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3} [+-]\d{4})`},
-		{`date (malformed opening brace only)`, `%d{`, `(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})`},
-		{`date (malformed incomplete format)`, `%d{incomplete`, `(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})`},
-		{`date (malformed square brackets)`, `%d[test]`, `(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})`},
+		{`date (short pattern name, default format)`, `%d`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3})`},
+		{`date (long pattern name, default format)`, `%date`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3})`},
+		{`date (custom format with decimal microseconds)`, `%d{yyyy-MM-dd HH:mm:ss.SSS Z}{UTC}`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3} [+-]\d{4})`},
+		{`date (custom format with comma microseconds)`, `%d{yyyy-MM-dd HH:mm:ss,SSS Z}{UTC}`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3} [+-]\d{4})`},
+		{`date (malformed opening brace only)`, `%d{`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3})`},
+		{`date (malformed incomplete format)`, `%d{incomplete`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3})`},
+		{`date (square brackets are literal)`, `%d[test]`, `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3})\[test\]`},
 		{`X/MDC (malformed opening brace only)`, `%X{`, `%X\{`},
 		{`X/MDC (malformed empty braces)`, `%X{}`, `%X\{\}`},
 		{`X/MDC (single character key)`, `%X{a}`, `(?P<a>.*?)`},
@@ -41,6 +41,33 @@ func TestRegex(t *testing.T) {
 		{`invalid pattern (non-word char)`, `%!`, `%!`},
 		{`invalid pattern (unknown alias)`, `%999`, `%999`},
 		{`text with trailing percent`, `[%p] text%`, `\[(?P<level>\w+)\] text%`},
+		{`escaped percent`, `100%% %p`, `100% (?P<level>\w+)`},
+		{`escaped tab`, `\t%-5level %c`, "\t" + `(?P<level>\w+)\s* (?P<logger>\S+)`},
+		{`class`, `%C.%M(%F:%L)`, `(?P<class>\S+)\.(?P<method>\S+)\((?P<file>\S+):(?P<line>\d+)\)`},
+		{`location`, `%l`, `(?P<location>\S+?\([^)]*\))`},
+		{`relative time, process and thread ids`, `%r %pid %tid %T`, `(?P<relative>\d+) (?P<pid>\d+) (?P<tid>\d+) (?P<tid>\d+)`},
+		{`ndc`, `[%x] [%NDC]`, `\[(?P<ndc>.*?)\] \[(?P<ndc>.*?)\]`},
+		{`exception`, `%m%n%ex{full}`, `(?s)(?P<message>.*)(?-s)(?s)(?P<throwable>.*)(?-s)`},
+		{`exception (long names)`, `%throwable %xEx`, `(?s)(?P<throwable>.*)(?-s) (?s)(?P<throwable>.*)(?-s)`},
+		{`sequence number and uuid`, `%sn %u{RANDOM}`, `(?P<sequence>\d+) (?P<uuid>[0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12})`},
+		{`marker`, `%marker`, `(?P<marker>\S*)`},
+		{`whole mdc`, `%X`, `(?P<mdc>\{.*?\})`},
+		{`mdc key that isn't a valid group name`, `%X{request-id}`, `(?P<request_id>.*?)`},
+		{`highlight wraps a pattern`, `%highlight{%-5p}{FATAL=red}`, `(?:\x1b\[[\d;]*m)?(?P<level>\w+)\s*(?:\x1b\[[\d;]*m)?`},
+		{`style with nested braces`, `%style{%d{HH:mm:ss}}{bright,green}`, `(?:\x1b\[[\d;]*m)?(?P<date>\d{2}:\d{2}:\d{2})(?:\x1b\[[\d;]*m)?`},
+		{`enc`, `%enc{%m}{CRLF}`, `(?s)(?P<message>.*)(?-s)`},
+		{`replace keeps the group of the converter it wraps`, `%replace{%m}{\s+}{ }`, `(?P<message>(?s:.*))`},
+		{`replace runs up to the next literal`, `[%replace{%t}{\s}{_}] %p`, `\[(?P<thread>[^\]]*)\] (?P<level>\w+)`},
+		{`replace runs up to the next field`, `%replace{%c %t}{\s}{_}%p`, `\S*(?P<level>\w+)`},
+		{`replace runs up to the literal after its wrapper`, `%highlight{%replace{%c}{^com\.}{}}: %m`, `(?:\x1b\[[\d;]*m)?(?P<logger>[^:]*)(?:\x1b\[[\d;]*m)?: (?s)(?P<message>.*)(?-s)`},
+		{`notEmpty`, `%notEmpty{[%marker]}`, `(?:\[(?P<marker>\S*)\])?`},
+		{`maxLen`, `%maxLen{%c}{40}`, `(?P<logger>\S+)(?:\.\.\.)?`},
+		{`equals`, `%equals{[%X{user}]}{[]}{-}`, `(?:\[(?P<user>.*?)\]|-)`},
+		{`truncation from the front and the end`, `%.10c %.-10000m`, `(?P<logger>\S{1,10}) (?s)(?P<message>.*)(?-s)`},
+		{`truncation of a padded field`, `%-5.-10t|%.20c`, `(?P<thread>\S{0,10})\s*\|(?P<logger>\S{1,20})`},
+		{`truncation of a lazy field`, `%.8X{user}`, `(?P<user>.{0,8}?)`},
+		{`truncation of a field with a shape`, `%.5d{HH:mm:ss}`, `(?P<date>.{0,5})`},
+		{`unknown converter`, `[%node_name]`, `\[(?P<node_name>\S*)\]`},
 		{`empty string`, ``, ``},
 		{`no pattern markers`, `just text`, `just text`},
 	}
@@ -70,3 +97,39 @@ func TestRegex(t *testing.T) {
 		}
 	})
 }
+
+func TestRegexMatches(t *testing.T) {
+	tests := []struct {
+		description string
+		pattern     string
+		line        string
+		want        map[string]string
+	}{
+		{
+			`a truncated thread doesn't swallow the next field`,
+			`%-5.-10t%.20c %m`,
+			`scheduler-1com.tableau.Main started`,
+			map[string]string{"thread": "scheduler-", "logger": "1com.tableau.Main", "message": "started"},
+		},
+		{
+			`a replaced field ends at the next literal`,
+			`%replace{%t}{\s}{_} [%p] %c - %m`,
+			`pool_1 [INFO] com.tableau.Main - a message [with] brackets`,
+			map[string]string{"thread": "pool_1", "level": "INFO", "logger": "com.tableau.Main", "message": "a message [with] brackets"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			re := regexp.MustCompile(`^` + log4j2.Regexp(test.pattern, make(map[string]string)) + `$`)
+			m := re.FindStringSubmatch(test.line)
+			if m == nil {
+				t.Fatalf("expected %q to match %q", test.line, re)
+			}
+			for name, want := range test.want {
+				if got := m[re.SubexpIndex(name)]; got != want {
+					t.Errorf("expected %s %q, got %q", name, want, got)
+				}
+			}
+		})
+	}
+}
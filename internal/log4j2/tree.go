@@ -0,0 +1,115 @@
+package log4j2
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// FromYAML returns the configuration of a log4j2.yaml file, e.g.
+//
+//	Configuration:
+//	  Properties:
+//	    Property:
+//	      - name: dir
+//	        value: /var/log/app
+//	  Appenders:
+//	    RollingFile:
+//	      name: rolling
+//	      fileName: ${dir}/app.log
+//	      PatternLayout:
+//	        pattern: "%d %p %c - %m%n"
+func FromYAML(configYaml []byte) Config {
+	var tree map[string]any
+	if err := yaml.Unmarshal(configYaml, &tree); err != nil {
+		return Config{appenders: map[string]Appender{}, properties: map[string]string{}}
+	}
+	return fromTree(tree)
+}
+
+// FromJSON returns the configuration of a log4j2.json file, whose structure is that of a log4j2.yaml file.
+func FromJSON(configJson []byte) Config {
+	var tree map[string]any
+	if err := json.Unmarshal(configJson, &tree); err != nil {
+		return Config{appenders: map[string]Appender{}, properties: map[string]string{}}
+	}
+	return fromTree(tree)
+}
+
+// fromTree returns the configuration of a decoded YAML or JSON configuration, whose keys log4j2 matches
+// regardless of their case.
+func fromTree(tree map[string]any) Config {
+	config := Config{
+		appenders:  map[string]Appender{},
+		properties: map[string]string{},
+	}
+	configuration, _ := child(tree, "Configuration").(map[string]any)
+	properties, _ := child(configuration, "Properties").(map[string]any)
+	for _, property := range list(child(properties, "Property")) {
+		config.properties[text(property, "name")] = text(property, "value")
+	}
+	appenders, _ := child(configuration, "Appenders").(map[string]any)
+	for appenderType, value := range appenders {
+		for _, appender := range list(value) {
+			// Appenders may also be listed under "appender", with their type as an attribute.
+			t := appenderType
+			if strings.EqualFold(t, "appender") {
+				t = text(appender, "type")
+			}
+			layout, _ := child(appender, "PatternLayout").(map[string]any)
+			config = withAppender(config, appenderAttributes{
+				appenderType:   t,
+				name:           text(appender, "name"),
+				filename:       text(appender, "fileName"),
+				filePattern:    text(appender, "filePattern"),
+				pattern:        text(layout, "pattern"),
+				immediateFlush: text(appender, "immediateFlush") == "true",
+			})
+		}
+	}
+	return config
+}
+
+// child returns the value of a key of a node, regardless of its case.
+func child(node map[string]any, key string) any {
+	if value, ok := node[key]; ok {
+		return value
+	}
+	for k, value := range node {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return nil
+}
+
+// list returns the nodes of a value that's either a node or a list of nodes.
+func list(value any) []map[string]any {
+	switch v := value.(type) {
+	case map[string]any:
+		return []map[string]any{v}
+	case []any:
+		var nodes []map[string]any
+		for _, e := range v {
+			if node, ok := e.(map[string]any); ok {
+				nodes = append(nodes, node)
+			}
+		}
+		return nodes
+	}
+	return nil
+}
+
+// text returns the value of a node's scalar attribute as a string, or "".
+func text(node map[string]any, key string) string {
+	switch v := child(node, key).(type) {
+	case nil, map[string]any, []any:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
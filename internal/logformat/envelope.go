@@ -0,0 +1,70 @@
+package logformat
+
+import "encoding/json"
+
+// Envelope is the JSON object in which Tableau's native processes, e.g. vizqlserver, hyper and dataserver,
+// write each entry: {"ts":..,"pid":..,"tid":..,"sev":..,"req":..,"sess":..,"site":..,"user":..,"k":..,"v":..}.
+// Fields the process wrote as "-" are empty.
+type Envelope struct {
+	PID     string          // process ID
+	Thread  string          // tid
+	Level   string          // sev, normalized to a zerolog level
+	Request string          // req
+	Session string          // sess
+	Site    string          // site
+	User    string          // user
+	Key     string          // k: the kind of event, e.g. msg or end-query
+	Value   json.RawMessage // v: the event's payload, whose type depends on Key
+}
+
+// ParseEnvelope decodes an entry written in an Envelope. Entries are recognized as envelopes by their "k" field.
+func ParseEnvelope(entry string) (Envelope, bool) {
+	var fields struct {
+		PID  json.RawMessage `json:"pid"`
+		TID  json.RawMessage `json:"tid"`
+		Sev  json.RawMessage `json:"sev"`
+		Req  json.RawMessage `json:"req"`
+		Sess json.RawMessage `json:"sess"`
+		Site json.RawMessage `json:"site"`
+		User json.RawMessage `json:"user"`
+		K    json.RawMessage `json:"k"`
+		V    json.RawMessage `json:"v"`
+	}
+	if err := json.Unmarshal([]byte(entry), &fields); err != nil {
+		return Envelope{}, false
+	}
+	key := scalar(fields.K)
+	if key == "" {
+		return Envelope{}, false
+	}
+	return Envelope{
+		PID:     scalar(fields.PID),
+		Thread:  scalar(fields.TID),
+		Level:   Format{}.Level(scalar(fields.Sev)),
+		Request: scalar(fields.Req),
+		Session: scalar(fields.Sess),
+		Site:    scalar(fields.Site),
+		User:    scalar(fields.User),
+		Key:     key,
+		Value:   fields.V,
+	}, true
+}
+
+// scalar returns a JSON string or number as a string, or "" if it's missing, "-", or of any other type.
+func scalar(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if raw[0] == '"' {
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return ""
+		}
+	} else if raw[0] == '-' || ('0' <= raw[0] && raw[0] <= '9') {
+		s = string(raw)
+	}
+	if s == "-" {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,36 @@
+package logformat
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseEnvelope(t *testing.T) {
+	tests := []struct {
+		description string
+		entry       string
+		want        Envelope
+		ok          bool
+	}{
+		{"vizqlserver query", `{"ts":"2022-07-28T13:41:28.862","pid":1234,"tid":"7f3a","sev":"info","req":"YuKyGH","sess":"A1B2-0:0","site":"Default","user":"admin","k":"end-query","v":{"elapsed":0.25,"rows":10}}`, Envelope{
+			PID: "1234", Thread: "7f3a", Level: "info", Request: "YuKyGH", Session: "A1B2-0:0", Site: "Default", User: "admin",
+			Key: "end-query", Value: json.RawMessage(`{"elapsed":0.25,"rows":10}`),
+		}, true},
+		{"hyper message without a request", `{"ts":"2022-07-28T13:41:28.862","pid":99,"tid":7,"sev":"warning","req":"-","sess":"-","site":"-","user":"-","k":"msg","v":"low memory"}`, Envelope{
+			PID: "99", Thread: "7", Level: "warn", Key: "msg", Value: json.RawMessage(`"low memory"`),
+		}, true},
+		{"upper case severity", `{"sev":"ERROR","k":"msg"}`, Envelope{Level: "error", Key: "msg"}, true},
+		{"unknown severity is kept", `{"sev":"not-a-level","k":"msg"}`, Envelope{Level: "not-a-level", Key: "msg"}, true},
+		{"no event key", `{"ts":"2022-07-28T13:41:28.862","sev":"info"}`, Envelope{}, false},
+		{"not json", `2022-07-28T13:41:28.862 info`, Envelope{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			got, ok := ParseEnvelope(tt.entry)
+			if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, %v, got %+v, %v", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
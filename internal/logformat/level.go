@@ -0,0 +1,32 @@
+package logformat
+
+import "strings"
+
+// Levels maps the level names shared by the processes ts-olly reads to zerolog levels. Keys are lower case.
+var Levels = map[string]string{
+	"trace":    "trace",
+	"debug":    "debug",
+	"info":     "info",
+	"warn":     "warn",
+	"warning":  "warn",
+	"err":      "error",
+	"error":    "error",
+	"severe":   "error",
+	"crit":     "fatal",
+	"critical": "fatal",
+	"fatal":    "fatal",
+	"panic":    "panic",
+}
+
+// Level returns the zerolog level of a value of the format's level group: the value's entry in the format's
+// own Levels, or failing that in the shared Levels, ignoring case. Values in neither are returned in lower case.
+func (f Format) Level(value string) string {
+	value = strings.ToLower(value)
+	if level, ok := f.Levels[value]; ok {
+		return level
+	}
+	if level, ok := Levels[value]; ok {
+		return level
+	}
+	return value
+}
@@ -0,0 +1,28 @@
+package logformat
+
+import "testing"
+
+func TestLevel(t *testing.T) {
+	f := Format{Levels: map[string]string{"notice": "info", "log": "info", "error": "fatal"}}
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"INFO", "info"},
+		{"Warning", "warn"},
+		{"SEVERE", "error"},
+		{"notice", "info"},
+		{"LOG", "info"},
+		{"error", "fatal"},
+		{"verbose", "verbose"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := f.Level(tt.value); got != tt.want {
+			t.Errorf("expected level %q for %q, got %q", tt.want, tt.value, got)
+		}
+	}
+	if got := (Format{}).Level("notice"); got != "notice" {
+		t.Errorf("expected notice to be unknown without the format's table, got %q", got)
+	}
+}
@@ -0,0 +1,170 @@
+// Package logformat describes the formats of the log files ts-olly reads: how to recognize and split an entry
+// into fields, and where to find the time it was written.
+package logformat
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSON is the Regexp of files whose entries are JSON objects.
+const JSON = "json"
+
+// Int is the type of groups whose values are integers.
+const Int = "int"
+
+// Layouts for times written as a number of seconds or milliseconds since the Unix epoch.
+const (
+	UnixSeconds = "UNIX"
+	UnixMillis  = "UNIX_MILLIS"
+)
+
+// Format is the format of a log file's entries.
+type Format struct {
+	Regexp   string         // matches an entry, naming its fields with capture groups
+	Time     []string       // the capture groups that together hold the time the entry was written
+	Layout   string         // Go time layout of the Time groups, joined by a space, or UnixSeconds or UnixMillis
+	Location *time.Location // time zone of times whose layout has none; nil means local time
+	// Levels maps the lower-case values of the level group that aren't in the shared Levels, or that mean
+	// something else in this format, to zerolog levels.
+	Levels map[string]string
+	// Types are the types, e.g. Int, of the groups whose values aren't strings.
+	Types map[string]string
+	// Multiline are the rules that group the format's lines into entries.
+	Multiline Multiline
+}
+
+// Multiline are the rules, as regexps, that group the lines of a format into entries. Empty rules take their
+// defaults: an entry starts with a line that matches the format's Regexp, is continued by any line that doesn't,
+// and ends where the next starts.
+type Multiline struct {
+	Start    string // matches a line that starts an entry
+	Continue string // matches a line that continues an entry; a line that matches neither starts its own
+	End      string // matches a line that ends its entry
+	Negate   bool   // lines that don't match Start start entries, instead of those that do
+	MaxLines int    // the lines kept of an entry, if not the configured limit
+}
+
+// Empty says whether no rule is set, so that a format's lines are grouped by default.
+func (m Multiline) Empty() bool {
+	return m.Start == "" && m.Continue == "" && m.End == "" && !m.Negate
+}
+
+// JSONMultiline are the rules of the JSON format: an entry is an object, on a line of its own or spread over
+// lines from an opening brace to a closing one, each at the start of a line.
+var JSONMultiline = Multiline{
+	Start: `^\{`,
+	End:   `^\{.*\}\s*$|^\}\s*$`,
+}
+
+// TextMultiline are the rules of files of unknown formats: lines that are indented, or that start the cause of
+// a Java exception, continue the entry before them, e.g. a stack trace written to stdout.
+var TextMultiline = Multiline{
+	Start:  `^(?:\s|Caused by: )`,
+	Negate: true,
+}
+
+// Value returns the value of a group, converted to the group's type if it has one and the value is of that type.
+func (f Format) Value(group, value string) any {
+	if f.Types[group] == Int {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// futureSkew is how far in the future a time whose year or date was inferred can be before it's taken to be from
+// the year or day before, e.g. an entry of Dec 31 read on Jan 1.
+const futureSkew = time.Hour
+
+// now returns the current time. Tests replace it.
+var now = time.Now
+
+// ParseTime parses the values of the format's Time groups, in order. Times whose layout has no year are taken
+// to be from this year, and those with no date at all from today, unless that puts them well in the future, in
+// which case they're from the year or day before.
+func (f Format) ParseTime(values ...string) (time.Time, bool) {
+	if f.Layout == "" || len(values) == 0 {
+		return time.Time{}, false
+	}
+	value := strings.Join(values, " ")
+	switch f.Layout {
+	case UnixSeconds, UnixMillis:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if f.Layout == UnixSeconds {
+			return time.Unix(n, 0), true
+		}
+		return time.UnixMilli(n), true
+	}
+	loc := f.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	t, err := time.ParseInLocation(f.Layout, value, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if t.Year() == 0 {
+		now := now().In(t.Location())
+		if hasDate(f.Layout) {
+			t = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+			if t.Sub(now) > futureSkew {
+				t = t.AddDate(-1, 0, 0)
+			}
+		} else {
+			t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+			if t.Sub(now) > futureSkew {
+				t = t.AddDate(0, 0, -1)
+			}
+		}
+	}
+	return t, true
+}
+
+// hasDate says whether a layout has a month or day, by formatting with it two Saturdays of different months.
+func hasDate(layout string) bool {
+	return time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Format(layout) != time.Date(2000, 2, 5, 0, 0, 0, 0, time.UTC).Format(layout)
+}
+
+// jsonTimeLayouts are the layouts of the string times found in JSON entries. Tableau's native processes write
+// their local time without a zone.
+var jsonTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05"}
+
+// JSONTime returns the time of a JSON entry, taken from its "ts" or "timestamp" field, which hold either a
+// string or milliseconds since the Unix epoch.
+func JSONTime(entry string) (time.Time, bool) {
+	var fields struct {
+		TS        json.RawMessage `json:"ts"`
+		Timestamp json.RawMessage `json:"timestamp"`
+	}
+	if err := json.Unmarshal([]byte(entry), &fields); err != nil {
+		return time.Time{}, false
+	}
+	for _, raw := range []json.RawMessage{fields.TS, fields.Timestamp} {
+		if len(raw) == 0 {
+			continue
+		}
+		if raw[0] != '"' {
+			if ms, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+				return time.UnixMilli(ms), true
+			}
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			continue
+		}
+		for _, layout := range jsonTimeLayouts {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
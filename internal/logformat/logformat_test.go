@@ -0,0 +1,113 @@
+package logformat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	utc := Format{Layout: "2006-01-02 15:04:05.000", Location: time.UTC}
+	t.Run("times without a zone are in the format's location", func(t *testing.T) {
+		got, ok := utc.ParseTime("2022-07-28 13:41:28,862")
+		if !ok || !got.Equal(time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.UTC)) {
+			t.Errorf("unexpected time %v", got)
+		}
+	})
+	t.Run("values are joined by a space", func(t *testing.T) {
+		f := Format{Layout: "2006-01-02T15:04:05.000 -0700"}
+		got, ok := f.ParseTime("2022-08-02T15:16:44.042", "+0200")
+		if !ok || !got.Equal(time.Date(2022, 8, 2, 13, 16, 44, 42e6, time.UTC)) {
+			t.Errorf("unexpected time %v", got)
+		}
+	})
+	t.Run("unix layouts", func(t *testing.T) {
+		got, ok := Format{Layout: UnixMillis}.ParseTime("1659535984400")
+		if !ok || !got.Equal(time.UnixMilli(1659535984400)) {
+			t.Errorf("unexpected time %v", got)
+		}
+		got, ok = Format{Layout: UnixSeconds}.ParseTime("1659535984")
+		if !ok || !got.Equal(time.Unix(1659535984, 0)) {
+			t.Errorf("unexpected time %v", got)
+		}
+	})
+	t.Run("times without a year or date are from this year or today", func(t *testing.T) {
+		defer func(f func() time.Time) { now = f }(now)
+		now = func() time.Time { return time.Date(2022, 8, 2, 15, 16, 44, 0, time.UTC) }
+		got, ok := Format{Layout: "15:04:05.000", Location: time.UTC}.ParseTime("13:41:28,862")
+		if !ok || !got.Equal(time.Date(2022, 8, 2, 13, 41, 28, 862e6, time.UTC)) {
+			t.Errorf("expected a time today, got %v", got)
+		}
+		got, ok = Format{Layout: "Jan 2 15:04:05", Location: time.UTC}.ParseTime("Jul 28 13:41:28")
+		if !ok || !got.Equal(time.Date(2022, 7, 28, 13, 41, 28, 0, time.UTC)) {
+			t.Errorf("expected a time this year, got %v", got)
+		}
+	})
+	t.Run("a date of Jan 1 is kept", func(t *testing.T) {
+		defer func(f func() time.Time) { now = f }(now)
+		now = func() time.Time { return time.Date(2022, 8, 2, 15, 16, 44, 0, time.UTC) }
+		got, ok := Format{Layout: "Jan 2 15:04:05", Location: time.UTC}.ParseTime("Jan 1 13:41:28")
+		if !ok || !got.Equal(time.Date(2022, 1, 1, 13, 41, 28, 0, time.UTC)) {
+			t.Errorf("expected Jan 1, got %v", got)
+		}
+	})
+	t.Run("times that would be in the future are from the year or day before", func(t *testing.T) {
+		defer func(f func() time.Time) { now = f }(now)
+		now = func() time.Time { return time.Date(2023, 1, 1, 0, 0, 30, 0, time.UTC) }
+		got, ok := Format{Layout: "Jan 2 15:04:05", Location: time.UTC}.ParseTime("Dec 31 23:59:58")
+		if !ok || !got.Equal(time.Date(2022, 12, 31, 23, 59, 58, 0, time.UTC)) {
+			t.Errorf("expected a time of last year, got %v", got)
+		}
+		got, ok = Format{Layout: "15:04:05", Location: time.UTC}.ParseTime("23:59:58")
+		if !ok || !got.Equal(time.Date(2022, 12, 31, 23, 59, 58, 0, time.UTC)) {
+			t.Errorf("expected a time of yesterday, got %v", got)
+		}
+		got, ok = Format{Layout: "Jan 2 15:04:05", Location: time.UTC}.ParseTime("Jan 1 00:00:40")
+		if !ok || !got.Equal(time.Date(2023, 1, 1, 0, 0, 40, 0, time.UTC)) {
+			t.Errorf("expected a time slightly ahead to be kept, got %v", got)
+		}
+	})
+	t.Run("unparseable times and formats without a layout fail", func(t *testing.T) {
+		if _, ok := utc.ParseTime("yesterday"); ok {
+			t.Error("expected unparseable time to fail")
+		}
+		if _, ok := (Format{}).ParseTime("2022-07-28 13:41:28.862"); ok {
+			t.Error("expected format without a layout to fail")
+		}
+	})
+}
+
+func TestJSONTime(t *testing.T) {
+	tests := []struct {
+		description string
+		entry       string
+		want        time.Time
+		ok          bool
+	}{
+		{"epoch millis timestamp", `{"eventType":"serviceRegisters","timestamp":1659535984400}`, time.UnixMilli(1659535984400), true},
+		{"native ts", `{"ts":"2022-07-28T13:41:28.862","sev":"info"}`, time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.Local), true},
+		{"ts with a zone", `{"ts":"2022-07-28T13:41:28.862Z"}`, time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.UTC), true},
+		{"no time", `{"sev":"info"}`, time.Time{}, false},
+		{"not json", `2022-07-28T13:41:28.862`, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			got, ok := JSONTime(tt.entry)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("expected %v, %v, got %v, %v", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestValue(t *testing.T) {
+	f := Format{Types: map[string]string{"status": Int, "bytes": Int}}
+	if got := f.Value("status", "200"); got != int64(200) {
+		t.Errorf("expected integer 200, got %#v", got)
+	}
+	if got := f.Value("bytes", "-"); got != "-" {
+		t.Errorf("expected - to stay a string, got %#v", got)
+	}
+	if got := f.Value("request", "200"); got != "200" {
+		t.Errorf("expected untyped group to stay a string, got %#v", got)
+	}
+}
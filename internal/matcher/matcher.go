@@ -0,0 +1,540 @@
+// Package matcher matches log entries against the regexps of their formats. The regexps log4j, log4j2 and httpd
+// layouts translate to are sequences of literals and repeated character classes, which are compiled into a
+// small program that scans an entry in one pass and extracts its fields without allocating. Anything else is
+// left to package regexp, as are entries that would make the program backtrack for more than a multiple of
+// their length. Either way, a Matcher finds the same matches and submatches as regexp would, in linear time.
+package matcher
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Matcher is a compiled log format regexp. It is safe for concurrent use.
+type Matcher struct {
+	expr   string
+	re     *regexp.Regexp // used when prog is nil
+	names  []string
+	prog   []inst
+	prefix string // literal every match starts with, if any
+	begin  bool   // matches can only start at the beginning of the text
+	undo   bool   // failed alternatives must restore the submatches they saved
+}
+
+type opcode uint8
+
+const (
+	opMatch   opcode = iota
+	opLiteral        // lit
+	opRun            // between min and max (or unbounded if max < 0) characters of class
+	opSave           // save the position in submatch slot n
+	opSplit          // try x, then y
+	opJmp            // continue at x
+	opBegin          // beginning of text
+	opEnd            // end of text
+)
+
+type inst struct {
+	op       opcode
+	lit      string
+	class    class
+	min, max int
+	greedy   bool
+	forced   bool // a greedy run that can't give characters back to what follows it
+	n        int
+	x, y     int
+}
+
+// Compile compiles a log format regexp.
+func Compile(expr string) (*Matcher, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	m := &Matcher{expr: expr, re: re, names: re.SubexpNames()}
+	tree, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return m, nil
+	}
+	c := compiler{prog: []inst{{op: opSave, n: 0}}}
+	if !c.compile(tree) {
+		return m, nil
+	}
+	c.emit(inst{op: opSave, n: 1})
+	c.emit(inst{op: opMatch})
+	m.prog = c.prog
+	m.undo = c.splits
+	m.analyze()
+	return m, nil
+}
+
+var cache sync.Map // expr → cached
+
+type cached struct {
+	m   *Matcher
+	err error
+}
+
+// Cached is like Compile, but compiles each regexp only once. Files of the same process share their formats,
+// and there are few of those, so the cache isn't bounded.
+func Cached(expr string) (*Matcher, error) {
+	if c, ok := cache.Load(expr); ok {
+		return c.(cached).m, c.(cached).err
+	}
+	m, err := Compile(expr)
+	cache.Store(expr, cached{m, err})
+	return m, err
+}
+
+// String returns the regexp the matcher was compiled from.
+func (m *Matcher) String() string { return m.expr }
+
+// SubexpNames returns the names of the regexp's capture groups, as regexp.Regexp.SubexpNames does.
+func (m *Matcher) SubexpNames() []string { return m.names }
+
+// SubexpIndex returns the index of the first capture group with the given name, or -1 if there's none.
+func (m *Matcher) SubexpIndex(name string) int { return m.re.SubexpIndex(name) }
+
+// MatchString reports whether s contains a match.
+func (m *Matcher) MatchString(s string) bool {
+	if m.prog == nil {
+		return m.re.MatchString(s)
+	}
+	matched, ok := m.search(s, nil)
+	if !ok {
+		return m.re.MatchString(s)
+	}
+	return matched
+}
+
+// SubmatchIndex appends the index pairs of the leftmost match in s and its submatches to dst[:0], as
+// regexp.Regexp.FindStringSubmatchIndex does, and reports whether there was a match. Passing the previous
+// result as dst avoids allocating.
+func (m *Matcher) SubmatchIndex(s string, dst []int) ([]int, bool) {
+	dst = dst[:0]
+	if m.prog != nil {
+		for range m.names {
+			dst = append(dst, -1, -1)
+		}
+		matched, ok := m.search(s, dst)
+		if ok && !matched {
+			return dst[:0], false
+		}
+		if ok {
+			return dst, true
+		}
+		dst = dst[:0]
+	}
+	loc := m.re.FindStringSubmatchIndex(s)
+	return append(dst, loc...), loc != nil
+}
+
+// budgetFactor bounds the work of a search, in characters scanned and positions backtracked to, to this many
+// times the length of the program and text, beyond which patterns such as (.*) (.*) (.*)x backtrack
+// exponentially and the search is left to regexp.
+const budgetFactor = 4
+
+// search looks for the leftmost match in s. ok is false if the search ran out of budget before deciding.
+func (m *Matcher) search(s string, caps []int) (matched, ok bool) {
+	budget := budgetFactor * len(m.prog) * (len(s) + 1)
+	for pos := 0; pos <= len(s); {
+		if m.prefix != "" {
+			i := strings.Index(s[pos:], m.prefix)
+			if i < 0 {
+				return false, true
+			}
+			pos += i
+		}
+		if m.run(s, pos, 0, caps, &budget) {
+			return true, true
+		}
+		if budget < 0 {
+			return false, false
+		}
+		if m.begin || pos == len(s) {
+			return false, true
+		}
+		_, w := utf8.DecodeRuneInString(s[pos:])
+		pos += w
+	}
+	return false, true
+}
+
+// run runs the program from pc at pos, backtracking like regexp's leftmost-first semantics require, until it
+// matches or the budget runs out.
+func (m *Matcher) run(s string, pos, pc int, caps []int, budget *int) bool {
+	for {
+		if *budget--; *budget < 0 {
+			return false
+		}
+		in := &m.prog[pc]
+		switch in.op {
+		case opMatch:
+			return true
+		case opLiteral:
+			if !strings.HasPrefix(s[pos:], in.lit) {
+				return false
+			}
+			pos += len(in.lit)
+			pc++
+		case opSave:
+			if caps == nil {
+				pc++
+				continue
+			}
+			if !m.undo {
+				caps[in.n] = pos
+				pc++
+				continue
+			}
+			old := caps[in.n]
+			caps[in.n] = pos
+			if m.run(s, pos, pc+1, caps, budget) {
+				return true
+			}
+			caps[in.n] = old
+			return false
+		case opSplit:
+			if m.run(s, pos, in.x, caps, budget) {
+				return true
+			}
+			pc = in.y
+		case opJmp:
+			pc = in.x
+		case opBegin:
+			if pos != 0 {
+				return false
+			}
+			pc++
+		case opEnd:
+			if pos != len(s) {
+				return false
+			}
+			pc++
+		case opRun:
+			if !in.greedy {
+				return m.lazy(s, pos, pc, caps, budget)
+			}
+			end, n := in.scan(s, pos)
+			if *budget -= end - pos; *budget < 0 || n < in.min {
+				return false
+			}
+			if in.forced {
+				pos = end
+				pc++
+				continue
+			}
+			for {
+				if m.run(s, end, pc+1, caps, budget) {
+					return true
+				}
+				if n == in.min || *budget < 0 {
+					return false
+				}
+				_, w := utf8.DecodeLastRuneInString(s[:end])
+				end -= w
+				n--
+			}
+		}
+	}
+}
+
+// lazy runs the program from the non-greedy run at pc, trying the shortest run first.
+func (m *Matcher) lazy(s string, pos, pc int, caps []int, budget *int) bool {
+	in := &m.prog[pc]
+	n := 0
+	for ; n < in.min; n++ {
+		r, w := utf8.DecodeRuneInString(s[pos:])
+		if w == 0 || !in.class.contains(r) {
+			return false
+		}
+		pos += w
+	}
+	for {
+		if m.run(s, pos, pc+1, caps, budget) {
+			return true
+		}
+		if n == in.max || *budget < 0 {
+			return false
+		}
+		r, w := utf8.DecodeRuneInString(s[pos:])
+		if w == 0 || !in.class.contains(r) {
+			return false
+		}
+		pos += w
+		n++
+	}
+}
+
+// scan returns the end of the longest run of the instruction's class from pos, up to its maximum length, and
+// the number of characters in it.
+func (in *inst) scan(s string, pos int) (int, int) {
+	if in.forced && in.class.kind != set && in.max < 0 && in.min <= 1 {
+		// Only the length of the run matters, not the number of characters in it.
+		end := len(s) - pos
+		if in.class.kind == anyNotNL {
+			if i := strings.IndexByte(s[pos:], '\n'); i >= 0 {
+				end = i
+			}
+		}
+		return pos + end, min(end, 1)
+	}
+	n := 0
+	for pos < len(s) && (in.max < 0 || n < in.max) {
+		r, w := rune(s[pos]), 1
+		if r >= utf8.RuneSelf {
+			r, w = utf8.DecodeRuneInString(s[pos:])
+		}
+		if !in.class.contains(r) {
+			break
+		}
+		pos += w
+		n++
+	}
+	return pos, n
+}
+
+// analyze marks the greedy runs that never need to give characters back, and finds what matches start with.
+func (m *Matcher) analyze() {
+	for pc := range m.prog {
+		in := &m.prog[pc]
+		if in.op != opRun || !in.greedy {
+			continue
+		}
+		// A shorter run would leave one of the class's characters next, which nothing after it can consume.
+		in.forced = in.min == in.max || !m.consumes(&in.class, pc+1, make([]bool, len(m.prog)))
+	}
+	pc := 1
+	for m.prog[pc].op == opSave {
+		pc++
+	}
+	switch m.prog[pc].op {
+	case opBegin:
+		m.begin = true
+	case opLiteral:
+		m.prefix = m.prog[pc].lit
+	}
+}
+
+// consumes reports whether the program may consume a character of c first when run from pc.
+func (m *Matcher) consumes(c *class, pc int, seen []bool) bool {
+	for !seen[pc] {
+		seen[pc] = true
+		in := &m.prog[pc]
+		switch in.op {
+		case opSave:
+			pc++
+		case opJmp:
+			pc = in.x
+		case opSplit:
+			if m.consumes(c, in.x, seen) {
+				return true
+			}
+			pc = in.y
+		case opLiteral:
+			r, _ := utf8.DecodeRuneInString(in.lit)
+			return c.contains(r)
+		case opRun:
+			if c.overlaps(&in.class) {
+				return true
+			}
+			if in.min > 0 {
+				return false
+			}
+			pc++
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// compiler translates the parts of a regexp syntax tree that the matcher supports into a program.
+type compiler struct {
+	prog   []inst
+	splits bool
+	joined int // where alternatives last joined; a literal before it can't be extended
+}
+
+func (c *compiler) emit(in inst) int {
+	c.prog = append(c.prog, in)
+	return len(c.prog) - 1
+}
+
+// compile returns false if re uses anything the matcher doesn't support.
+func (c *compiler) compile(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return true
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return false
+		}
+		if last := len(c.prog) - 1; last >= c.joined && c.prog[last].op == opLiteral {
+			c.prog[last].lit += string(re.Rune)
+		} else {
+			c.emit(inst{op: opLiteral, lit: string(re.Rune)})
+		}
+		return true
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return c.run(re, 1, 1, true)
+	case syntax.OpStar:
+		return c.run(re.Sub[0], 0, -1, re.Flags&syntax.NonGreedy == 0)
+	case syntax.OpPlus:
+		return c.run(re.Sub[0], 1, -1, re.Flags&syntax.NonGreedy == 0)
+	case syntax.OpRepeat:
+		return c.run(re.Sub[0], re.Min, re.Max, re.Flags&syntax.NonGreedy == 0)
+	case syntax.OpQuest:
+		if c.run(re.Sub[0], 0, 1, re.Flags&syntax.NonGreedy == 0) {
+			return true
+		}
+		// An optional sequence is an alternative between it and nothing.
+		c.splits = true
+		split := c.emit(inst{op: opSplit})
+		body := len(c.prog)
+		if !c.compile(re.Sub[0]) {
+			return false
+		}
+		if re.Flags&syntax.NonGreedy == 0 {
+			c.prog[split].x, c.prog[split].y = body, len(c.prog)
+		} else {
+			c.prog[split].x, c.prog[split].y = len(c.prog), body
+		}
+		c.joined = len(c.prog)
+		return true
+	case syntax.OpAlternate:
+		c.splits = true
+		var jumps []int
+		for i, sub := range re.Sub {
+			split := -1
+			if i < len(re.Sub)-1 {
+				split = c.emit(inst{op: opSplit})
+				c.prog[split].x = len(c.prog)
+			}
+			if !c.compile(sub) {
+				return false
+			}
+			if split >= 0 {
+				jumps = append(jumps, c.emit(inst{op: opJmp}))
+				c.prog[split].y = len(c.prog)
+			}
+		}
+		for _, j := range jumps {
+			c.prog[j].x = len(c.prog)
+		}
+		c.joined = len(c.prog)
+		return true
+	case syntax.OpCapture:
+		c.emit(inst{op: opSave, n: 2 * re.Cap})
+		if !c.compile(re.Sub[0]) {
+			return false
+		}
+		c.emit(inst{op: opSave, n: 2*re.Cap + 1})
+		return true
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !c.compile(sub) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpBeginText:
+		c.emit(inst{op: opBegin})
+		return true
+	case syntax.OpEndText:
+		c.emit(inst{op: opEnd})
+		return true
+	}
+	return false
+}
+
+// run emits a run of the single character re matches, returning false if re matches anything else.
+func (c *compiler) run(re *syntax.Regexp, min, max int, greedy bool) bool {
+	var cl class
+	switch re.Op {
+	case syntax.OpCharClass:
+		cl = newClass(re.Rune)
+	case syntax.OpAnyChar:
+		cl = class{kind: any}
+	case syntax.OpAnyCharNotNL:
+		cl = class{kind: anyNotNL}
+	case syntax.OpLiteral:
+		if len(re.Rune) != 1 || re.Flags&syntax.FoldCase != 0 {
+			return false
+		}
+		cl = newClass([]rune{re.Rune[0], re.Rune[0]})
+	default:
+		return false
+	}
+	c.emit(inst{op: opRun, class: cl, min: min, max: max, greedy: greedy})
+	return true
+}
+
+type classKind uint8
+
+const (
+	set classKind = iota
+	any
+	anyNotNL
+)
+
+// class is a set of characters.
+type class struct {
+	kind   classKind
+	ascii  [2]uint64 // the ASCII characters in a set
+	ranges []rune    // the set's characters, as pairs of inclusive bounds
+}
+
+func newClass(ranges []rune) class {
+	c := class{kind: set, ranges: ranges}
+	for i := 0; i < len(ranges); i += 2 {
+		for r := ranges[i]; r <= ranges[i+1] && r < utf8.RuneSelf; r++ {
+			c.ascii[r/64] |= 1 << (r % 64)
+		}
+	}
+	return c
+}
+
+func (c *class) contains(r rune) bool {
+	switch c.kind {
+	case any:
+		return true
+	case anyNotNL:
+		return r != '\n'
+	}
+	if r < utf8.RuneSelf {
+		return c.ascii[r/64]&(1<<(r%64)) != 0
+	}
+	for i := 0; i < len(c.ranges); i += 2 {
+		if c.ranges[i] <= r && r <= c.ranges[i+1] {
+			return true
+		}
+	}
+	return false
+}
+
+// bounds returns the class's characters as pairs of inclusive bounds.
+func (c *class) bounds() []rune {
+	switch c.kind {
+	case any:
+		return []rune{0, utf8.MaxRune}
+	case anyNotNL:
+		return []rune{0, '\n' - 1, '\n' + 1, utf8.MaxRune}
+	}
+	return c.ranges
+}
+
+func (c *class) overlaps(d *class) bool {
+	a, b := c.bounds(), d.bounds()
+	for i := 0; i < len(a); i += 2 {
+		for j := 0; j < len(b); j += 2 {
+			if a[i] <= b[j+1] && b[j] <= a[i+1] {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package matcher
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Regexps generated from the layouts Tableau ships, and entries they write.
+const (
+	log4j2Expr = `(?P<date>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3} [+-]\d{4}) (?P<pid>.*?) (?P<thread>\S*) : (?P<level>\w+)\s* (?P<logger>\S+) - (?s)(?P<message>.*)(?-s)`
+	log4j2Line = `2022-08-03 00:09:31.809 +0000  qtp642056770-30 : INFO  com.tableausoftware.tabadmin.webapp.api.v1.LoginController - Login request from client 'unspecified' at '192.168.79.158' for user 'tsmadmin'`
+	httpdExpr  = `(?P<requested_hostname>\S+) (?P<remote_hostname>\S+) (?P<remote_user>\S+) (?P<timestamp>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}) \"(?P<timezone>[\+\-]\d{4})\" (?P<request_port>\d+) \"(?P<request>[^\"]+)\" \"(?P<xff>\S*)\" (?P<status>\d{3}) (?P<bytes>\d+|-) \"(?P<content_length>\d+|-)\" (?P<ms>\d+) (?P<unique_id>\S+) (?P<tableau_error_source>\S+) (?P<tableau_status_code>\S+) (?P<tableau_error_code>\S+) (?P<tableau_service_name>\S+) \"(?P<tableau_trace_id>\S+)\"`
+	httpdLine  = `localhost 127.0.0.1 - 2022-08-03T00:00:02.638 "+0000" 8080 "HEAD /favicon.ico HTTP/1.1" "-" 200 - "-" 335 Yum6grxNY7cqNJiackGy6wAAAJs - - - - "-"`
+	traceLine  = "\tat com.tableausoftware.tabadmin.webapp.impl.linux.LinuxAuthenticationManager.authenticate(LinuxAuthenticationManager.java:62) ~[tabadmin-webapp.jar:2022.1.4]"
+)
+
+var tests = []struct {
+	expr   string
+	inputs []string
+}{
+	{log4j2Expr, []string{log4j2Line, traceLine, "", log4j2Line + "\nat line two\n", "2022-08-03 00:09:31.809 +0000 1 pool 1 : WARN x - y"}},
+	{httpdExpr, []string{httpdLine, traceLine, `localhost 127.0.0.1 - 2022-08-03T00:00:02.638 "+0000" 8080 "GET / HTTP/1.1" "-" 200 1234 "56" 335 id - - - - "-"`}},
+	{`^\[(?P<date>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[\.,]\d{3})\]\[(?P<level>\w+)\s*\]\[(?P<logger>\S*)\s*\] \[(?P<node>\S*)\s*\](?s)(?P<message>.*)(?-s)[$\n]?`, []string{
+		"[2022-08-03T00:00:02,638][INFO ][o.e.n.Node               ] [node1] started",
+		"x[2022-08-03T00:00:02,638][INFO ][o.e.n.Node] [node1] started",
+	}},
+	{`(?P<a>\S+)\s*(?P<b>\s\S+)`, []string{"one   two", "one two", "one", " one  two  "}},
+	{`(?P<a>.*?)(?P<b>x*)y`, []string{"aaxxy", "y", "xxxz", "axyxy"}},
+	{`(?:(?P<a>x)y|(?P<b>x)z)(?:\.\.\.)?`, []string{"xz", "xy...", "xyz", "zz"}},
+	{`(?P<date>\d{2}:\d{2})(?:Z|[+-]\d{2}:\d{2})?$`, []string{"12:34", "12:34Z", "12:34+01:00", "12:34+01", "é12:34"}},
+	{`héllo (?P<w>\pL+)!`, []string{"héllo wörld!", "héllo 世界!", "hello world!", "héllo \xffwörld!"}},
+	{`(?i)case`, []string{"CASE", "case"}},
+}
+
+func TestMatcher(t *testing.T) {
+	for _, tt := range tests {
+		re := regexp.MustCompile(tt.expr)
+		m, err := Compile(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range tt.inputs {
+			if got, want := m.MatchString(s), re.MatchString(s); got != want {
+				t.Errorf("%s: expected match %v for %q, got %v", tt.expr, want, s, got)
+			}
+			got, ok := m.SubmatchIndex(s, nil)
+			if want := re.FindStringSubmatchIndex(s); ok != (want != nil) || !slices.Equal(got, want) {
+				t.Errorf("%s: expected submatches %v for %q, got %v", tt.expr, want, s, got)
+			}
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	t.Run("layout regexps are compiled into programs", func(t *testing.T) {
+		for _, expr := range []string{log4j2Expr, httpdExpr} {
+			if m, _ := Compile(expr); m.prog == nil {
+				t.Errorf("expected %s to be compiled", expr)
+			}
+		}
+	})
+	t.Run("other regexps fall back to package regexp", func(t *testing.T) {
+		if m, _ := Compile(`(?i)case`); m.prog != nil {
+			t.Error("expected case-insensitive regexp to fall back")
+		}
+		if m, _ := Compile(`(?:ab)+`); m.prog != nil {
+			t.Error("expected repeated sequence to fall back")
+		}
+	})
+	t.Run("invalid regexps fail", func(t *testing.T) {
+		if _, err := Compile(`(?P<a>`); err == nil {
+			t.Error("expected error")
+		}
+		if _, err := Cached(`(?P<a>`); err == nil {
+			t.Error("expected cached error")
+		}
+	})
+	t.Run("compiled matchers are cached", func(t *testing.T) {
+		a, _ := Cached(log4j2Expr)
+		b, _ := Cached(log4j2Expr)
+		if a != b {
+			t.Error("expected the same matcher")
+		}
+	})
+	t.Run("greedy runs followed by a disjoint class don't backtrack", func(t *testing.T) {
+		m, _ := Compile(`(?P<thread>\S*) : (?P<level>\w+)\s* x`)
+		var forced []bool
+		for _, in := range m.prog {
+			if in.op == opRun {
+				forced = append(forced, in.forced)
+			}
+		}
+		if !slices.Equal(forced, []bool{true, true, false}) {
+			t.Errorf("unexpected forced runs %v", forced)
+		}
+	})
+}
+
+func TestMatcherBacktracking(t *testing.T) {
+	// Each .* can end at any of the spaces, so backtracking through them all takes exponential time.
+	expr := `(?P<a>.*) (?P<b>.*) (?P<c>.*) (?P<d>.*)x`
+	m, err := Compile(expr)
+	if err != nil || m.prog == nil {
+		t.Fatalf("expected %s to be compiled, got %v", expr, err)
+	}
+	re := regexp.MustCompile(expr)
+	for _, n := range []int{5, 200, 10000} {
+		s := strings.Repeat("a ", n)
+		if _, ok := m.search(s, nil); n > 5 && ok {
+			t.Errorf("expected the search of %d spaces to run out of budget", n)
+		}
+		if got := m.MatchString(s); got {
+			t.Errorf("expected no match of %d spaces", n)
+		}
+		got, _ := m.SubmatchIndex(s+"x", nil)
+		if want := re.FindStringSubmatchIndex(s + "x"); !slices.Equal(got, want) {
+			t.Errorf("expected submatches %v, got %v", want, got)
+		}
+	}
+}
+
+func TestMatcherAllocations(t *testing.T) {
+	m, _ := Compile(log4j2Expr)
+	dst := make([]int, 0, 2*len(m.SubexpNames()))
+	allocs := testing.AllocsPerRun(100, func() {
+		m.MatchString(traceLine)
+		dst, _ = m.SubmatchIndex(log4j2Line, dst)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
+
+func FuzzMatcher(f *testing.F) {
+	for _, tt := range tests {
+		for _, s := range tt.inputs {
+			f.Add(s)
+		}
+	}
+	exprs := make([]*Matcher, len(tests))
+	res := make([]*regexp.Regexp, len(tests))
+	for i, tt := range tests {
+		exprs[i], _ = Compile(tt.expr)
+		res[i] = regexp.MustCompile(tt.expr)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		for i, m := range exprs {
+			got, _ := m.SubmatchIndex(s, nil)
+			if want := res[i].FindStringSubmatchIndex(s); !slices.Equal(got, want) && (len(got) > 0 || want != nil) {
+				t.Errorf("%s: expected submatches %v for %q, got %v", m, want, s, got)
+			}
+		}
+	})
+}
+
+func benchmark(b *testing.B, expr, s string) {
+	re := regexp.MustCompile(expr)
+	m, _ := Compile(expr)
+	b.Run("regexp/match", func(b *testing.B) {
+		for b.Loop() {
+			re.MatchString(s)
+		}
+	})
+	b.Run("matcher/match", func(b *testing.B) {
+		for b.Loop() {
+			m.MatchString(s)
+		}
+	})
+	b.Run("regexp/submatch", func(b *testing.B) {
+		for b.Loop() {
+			re.FindStringSubmatchIndex(s)
+		}
+	})
+	b.Run("matcher/submatch", func(b *testing.B) {
+		var dst []int
+		for b.Loop() {
+			dst, _ = m.SubmatchIndex(s, dst)
+		}
+	})
+}
+
+func BenchmarkLog4j2(b *testing.B)          { benchmark(b, log4j2Expr, log4j2Line) }
+func BenchmarkLog4j2Continued(b *testing.B) { benchmark(b, log4j2Expr, traceLine) }
+func BenchmarkHttpd(b *testing.B)           { benchmark(b, httpdExpr, httpdLine) }
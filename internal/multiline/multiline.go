@@ -0,0 +1,145 @@
+// Package multiline assembles the lines of a log file into entries, such as a message followed by its stack
+// trace, according to rules that say which lines start, continue and end an entry.
+package multiline
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TruncationMarker ends the text of an entry that was cut short because it exceeded the limits.
+const TruncationMarker = " [truncated]"
+
+// Rules decide which lines belong to which entry.
+type Rules struct {
+	// Start says whether a line starts an entry. If nil, every line does.
+	Start func(string) bool
+	// Continue says whether a line that doesn't start an entry continues the pending one. A line that does
+	// neither starts an entry of its own. If nil, every line that doesn't start an entry continues one.
+	Continue func(string) bool
+	// End says whether a line ends its entry, which is then complete without waiting for the next. If nil,
+	// entries end where the next starts, or when they're flushed.
+	End func(string) bool
+}
+
+// Limits bound the entries an Assembler assembles.
+type Limits struct {
+	FlushTimeout time.Duration // how long a pending entry waits for more lines before it's flushed
+	MaxLines     int           // the lines kept of an entry; 0 is unlimited
+	MaxBytes     int           // the bytes kept of an entry's text; 0 is unlimited
+}
+
+// DefaultLimits are the limits of an Assembler unless configured otherwise.
+var DefaultLimits = Limits{
+	FlushTimeout: 5 * time.Second,
+	MaxLines:     1000,
+	MaxBytes:     1 << 20,
+}
+
+// Entry is an assembled entry, whose lines are of type T.
+type Entry[T any] struct {
+	Text      string // the text of the entry's lines, joined by newlines, ending in TruncationMarker if truncated
+	First     T      // the entry's first line
+	Last      T      // the entry's last line, which may have been truncated
+	Lines     int    // the number of the entry's lines, including those truncated
+	Truncated bool   // the entry exceeded the limits
+}
+
+// Assembler assembles lines of type T into entries. It isn't safe for concurrent use.
+type Assembler[T any] struct {
+	rules     Rules
+	limits    Limits
+	text      strings.Builder
+	first     T
+	last      T
+	lines     int
+	kept      int
+	truncated bool
+}
+
+// New returns an Assembler of entries according to rules and limits.
+func New[T any](rules Rules, limits Limits) *Assembler[T] {
+	return &Assembler[T]{rules: rules, limits: limits}
+}
+
+// Limits returns the Assembler's limits.
+func (a *Assembler[T]) Limits() Limits {
+	return a.limits
+}
+
+// Pending says whether lines are waiting to be emitted as an entry.
+func (a *Assembler[T]) Pending() bool {
+	return a.lines > 0
+}
+
+// Add adds a line whose text is text, calling emit with the entries it completes: the pending entry, if the line
+// starts another, and the line's own, if it ends it.
+func (a *Assembler[T]) Add(text string, line T, emit func(Entry[T])) {
+	starts := a.rules.Start == nil || a.rules.Start(text)
+	if !starts && a.rules.Continue != nil && !a.rules.Continue(text) {
+		starts = true
+	}
+	if starts {
+		if e, ok := a.Flush(); ok {
+			emit(e)
+		}
+	}
+	a.append(text, line)
+	if a.rules.End != nil && a.rules.End(text) {
+		if e, ok := a.Flush(); ok {
+			emit(e)
+		}
+	}
+}
+
+// append adds a line to the pending entry, unless it exceeds the limits.
+func (a *Assembler[T]) append(text string, line T) {
+	if a.lines == 0 {
+		a.first = line
+	}
+	a.last = line
+	a.lines++
+	if a.truncated {
+		return
+	}
+	if a.limits.MaxLines > 0 && a.kept == a.limits.MaxLines {
+		a.truncated = true
+		return
+	}
+	if a.kept > 0 {
+		text = "\n" + text
+	}
+	if a.limits.MaxBytes > 0 && a.text.Len()+len(text) > a.limits.MaxBytes {
+		text = text[:a.limits.MaxBytes-a.text.Len()]
+		// Don't split a character
+		for i := len(text) - 1; i >= 0 && i >= len(text)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(text[i]) {
+				if !utf8.FullRuneInString(text[i:]) {
+					text = text[:i]
+				}
+				break
+			}
+		}
+		a.truncated = true
+	}
+	a.text.WriteString(text)
+	a.kept++
+}
+
+// Flush returns the pending entry, if any, which is then no longer pending.
+func (a *Assembler[T]) Flush() (Entry[T], bool) {
+	if a.lines == 0 {
+		return Entry[T]{}, false
+	}
+	text := a.text.String()
+	if a.truncated {
+		text += TruncationMarker
+	}
+	e := Entry[T]{Text: text, First: a.first, Last: a.last, Lines: a.lines, Truncated: a.truncated}
+	var zero T
+	a.text.Reset()
+	a.first, a.last = zero, zero
+	a.lines, a.kept, a.truncated = 0, 0, false
+	return e, true
+}
@@ -0,0 +1,104 @@
+package multiline
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// assemble adds lines to an Assembler, returning the entries it emits, including the one flushed at the end.
+func assemble(a *Assembler[int], lines ...string) []Entry[int] {
+	var entries []Entry[int]
+	emit := func(e Entry[int]) { entries = append(entries, e) }
+	for i, l := range lines {
+		a.Add(l, i+1, emit)
+	}
+	if e, ok := a.Flush(); ok {
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func texts(entries []Entry[int]) []string {
+	var t []string
+	for _, e := range entries {
+		t = append(t, e.Text)
+	}
+	return t
+}
+
+func prefix(p string) func(string) bool {
+	return func(s string) bool { return strings.HasPrefix(s, p) }
+}
+
+func TestAssembler(t *testing.T) {
+	tests := []struct {
+		description string
+		rules       Rules
+		lines       []string
+		want        []string
+	}{
+		{"every line starts an entry", Rules{}, []string{"a", "b"}, []string{"a", "b"}},
+		{"start", Rules{Start: prefix("20")}, []string{"2022 a", "\tat x", "\tat y", "2022 b"}, []string{"2022 a\n\tat x\n\tat y", "2022 b"}},
+		{"continuation before the first start", Rules{Start: prefix("20")}, []string{"\tat x", "2022 a"}, []string{"\tat x", "2022 a"}},
+		{"continue", Rules{Start: prefix("20"), Continue: prefix("\t")}, []string{"2022 a", "\tat x", "other", "\tat y"}, []string{"2022 a\n\tat x", "other\n\tat y"}},
+		{"end", Rules{Start: prefix("{"), End: prefix("}")}, []string{"{", " 1", "}", "trailing"}, []string{"{\n 1\n}", "trailing"}},
+		{"start and end on one line", Rules{Start: prefix("<"), End: func(s string) bool { return strings.HasSuffix(s, ">") }}, []string{"<a>", "<b", "c>"}, []string{"<a>", "<b\nc>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			got := texts(assemble(New[int](tt.rules, Limits{}), tt.lines...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAssemblerEntries(t *testing.T) {
+	a := New[int](Rules{Start: prefix("20")}, Limits{})
+	if a.Pending() {
+		t.Errorf("expected no pending entry")
+	}
+	var emitted []Entry[int]
+	a.Add("2022 a", 1, func(e Entry[int]) { emitted = append(emitted, e) })
+	a.Add("\tat x", 2, func(e Entry[int]) { emitted = append(emitted, e) })
+	if len(emitted) != 0 || !a.Pending() {
+		t.Fatalf("expected the entry to be pending until flushed, got %+v", emitted)
+	}
+	e, ok := a.Flush()
+	if !ok || e.First != 1 || e.Last != 2 || e.Lines != 2 || e.Truncated {
+		t.Errorf("expected the entry of lines 1 to 2, got %+v", e)
+	}
+	if _, ok := a.Flush(); ok || a.Pending() {
+		t.Errorf("expected nothing pending after a flush")
+	}
+}
+
+func TestAssemblerLimits(t *testing.T) {
+	rules := Rules{Start: prefix("20")}
+	t.Run("max lines", func(t *testing.T) {
+		entries := assemble(New[int](rules, Limits{MaxLines: 2}), "2022 a", "\tat x", "\tat y", "\tat z", "2022 b")
+		want := []string{"2022 a\n\tat x" + TruncationMarker, "2022 b"}
+		if got := texts(entries); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+		if e := entries[0]; !e.Truncated || e.Lines != 4 || e.Last != 4 {
+			t.Errorf("expected the truncated lines to be counted, got %+v", e)
+		}
+	})
+	t.Run("max bytes", func(t *testing.T) {
+		got := texts(assemble(New[int](rules, Limits{MaxBytes: 10}), "2022 a", "\tat xyz", "2022 b"))
+		want := []string{"2022 a\n\tat" + TruncationMarker, "2022 b"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	})
+	t.Run("characters aren't split", func(t *testing.T) {
+		got := texts(assemble(New[int](rules, Limits{MaxBytes: 8}), "2022 é€"))
+		want := []string{"2022 é" + TruncationMarker}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+// Package poller discovers changes to the files of directories by periodically stat-ing them, for file systems
+// whose changes aren't notified, e.g. NFS and CIFS mounts and some container volumes.
+package poller
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/highperformance-tech/ts-olly/internal/fileid"
+)
+
+// state is what a scan found of a file.
+type state struct {
+	id      uint64
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+// Poller polls directories and their subdirectories, reporting the changes it finds as fsnotify events: Create
+// for new files and directories, and files replaced by others, Write for files whose size or modification time
+// changed, and Remove for those gone. It's safe for concurrent use.
+type Poller struct {
+	mu    sync.Mutex
+	roots []string
+	files map[string]state
+}
+
+// New returns a Poller of no directories.
+func New() *Poller {
+	return &Poller{files: make(map[string]state)}
+}
+
+// Add polls a directory and its subdirectories. Their files as they are now are the baseline of later changes.
+func (p *Poller) Add(dir string) {
+	dir = filepath.Clean(dir)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.polls(dir) {
+		return
+	}
+	// A directory that contains others replaces them.
+	p.roots = slices.DeleteFunc(p.roots, func(root string) bool { return within(root, dir) })
+	p.roots = append(p.roots, dir)
+	for path, s := range scan(dir) {
+		p.files[path] = s
+	}
+}
+
+// Forget forgets the file at path, so that the next poll reports it as created if it still exists.
+func (p *Poller) Forget(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.files, filepath.Clean(path))
+}
+
+// Polls says whether the file or directory at path is polled.
+func (p *Poller) Polls(path string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.polls(filepath.Clean(path))
+}
+
+func (p *Poller) polls(path string) bool {
+	return slices.ContainsFunc(p.roots, func(root string) bool { return within(path, root) })
+}
+
+// Poll scans the polled directories, returning the changes since the last scan.
+func (p *Poller) Poll() []fsnotify.Event {
+	p.mu.Lock()
+	roots := slices.Clone(p.roots)
+	p.mu.Unlock()
+	files := make(map[string]state)
+	for _, root := range roots {
+		for path, s := range scan(root) {
+			files[path] = s
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var events []fsnotify.Event
+	for path, s := range files {
+		was, ok := p.files[path]
+		switch {
+		case !ok || was.id != s.id || was.dir != s.dir:
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Create})
+		case !s.dir && (was.size != s.size || !was.modTime.Equal(s.modTime)):
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		}
+	}
+	for path, was := range p.files {
+		if !slices.ContainsFunc(roots, func(root string) bool { return within(path, root) }) {
+			// Added during the scan
+			files[path] = was
+			continue
+		}
+		if _, ok := files[path]; !ok {
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+		}
+	}
+	p.files = files
+	// Directories are reported before the files in them.
+	slices.SortFunc(events, func(a, b fsnotify.Event) int { return strings.Compare(a.Name, b.Name) })
+	return events
+}
+
+// Run polls every interval until ctx is done, sending the changes it finds to the returned channel.
+func (p *Poller) Run(ctx context.Context, interval time.Duration) <-chan fsnotify.Event {
+	out := make(chan fsnotify.Event)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, e := range p.Poll() {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- e:
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// scan returns the state of the files in dir and its subdirectories, by path. Files that can't be stat-ed, e.g.
+// because they were removed during the scan, are left out.
+func scan(dir string) map[string]state {
+	files := make(map[string]state)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		id, err := fileid.Query(path)
+		if err != nil {
+			return nil
+		}
+		files[path] = state{id: id, size: info.Size(), modTime: info.ModTime(), dir: info.IsDir()}
+		return nil
+	})
+	return files
+}
+
+// within says whether path is dir or is inside it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
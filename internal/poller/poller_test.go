@@ -0,0 +1,114 @@
+package poller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestPoller(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) {
+		t.Helper()
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("existing.log", "one\n")
+	write("rotated.log", "one\n")
+	write("removed.log", "one\n")
+
+	p := New()
+	p.Add(dir)
+	if events := p.Poll(); len(events) != 0 {
+		t.Fatalf("expected the files found when added to be the baseline, got %v", events)
+	}
+
+	write("existing.log", "two\n")
+	if err := os.Remove(filepath.Join(dir, "removed.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "rotated.log"), filepath.Join(dir, "rotated.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	write("rotated.log", "new\n")
+	if err := os.Mkdir(filepath.Join(dir, "vizqlserver"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write("vizqlserver/vizqlserver_node1-0.log", "one\n")
+
+	want := []fsnotify.Event{
+		{Name: filepath.Join(dir, "existing.log"), Op: fsnotify.Write},
+		{Name: filepath.Join(dir, "removed.log"), Op: fsnotify.Remove},
+		{Name: filepath.Join(dir, "rotated.log"), Op: fsnotify.Create},
+		{Name: filepath.Join(dir, "rotated.log.1"), Op: fsnotify.Create},
+		{Name: filepath.Join(dir, "vizqlserver"), Op: fsnotify.Create},
+		{Name: filepath.Join(dir, "vizqlserver", "vizqlserver_node1-0.log"), Op: fsnotify.Create},
+	}
+	if got := p.Poll(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if events := p.Poll(); len(events) != 0 {
+		t.Errorf("expected no changes, got %v", events)
+	}
+	p.Forget(filepath.Join(dir, "existing.log"))
+	want = []fsnotify.Event{{Name: filepath.Join(dir, "existing.log"), Op: fsnotify.Create}}
+	if got := p.Poll(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected a forgotten file to be created again, got %v", got)
+	}
+}
+
+func TestPoller_Polls(t *testing.T) {
+	dir := t.TempDir()
+	p := New()
+	p.Add(filepath.Join(dir, "httpd"))
+	for path, want := range map[string]bool{
+		filepath.Join(dir, "httpd"):                true,
+		filepath.Join(dir, "httpd", "access.log"):  true,
+		filepath.Join(dir, "httpd2", "access.log"): false,
+		filepath.Join(dir, "vizqlserver", "a.log"): false,
+		dir: false,
+	} {
+		if got := p.Polls(path); got != want {
+			t.Errorf("expected polls %s: %t, got %t", path, want, got)
+		}
+	}
+	p.Add(dir)
+	if !p.Polls(filepath.Join(dir, "vizqlserver", "a.log")) || len(p.roots) != 1 {
+		t.Errorf("expected a parent directory to replace the directories in it, got %v", p.roots)
+	}
+}
+
+func TestPoller_Run(t *testing.T) {
+	dir := t.TempDir()
+	p := New()
+	p.Add(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := p.Run(ctx, 10*time.Millisecond)
+	name := filepath.Join(dir, "new.log")
+	if err := os.WriteFile(name, []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		if e.Name != name || e.Op != fsnotify.Create {
+			t.Errorf("expected %s to be created, got %v", name, e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an event")
+	}
+	cancel()
+	for range events {
+	}
+}
@@ -0,0 +1,154 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// shutdownTimeout bounds how long the final write and flush may take once the records channel closes.
+const shutdownTimeout = 10 * time.Second
+
+// Dispatcher batches records and writes each batch to every one of its sinks. A batch a sink fails to write
+// with a retryable error is written again until it succeeds, while one it rejects is dropped, so that it
+// doesn't hold up the batches after it. Records are acknowledged once every sink has written or dropped them.
+type Dispatcher struct {
+	names         []string
+	sinks         map[string]Sink
+	batchSize     int
+	flushInterval time.Duration
+	onError       func(name string, err error)
+	retry         Backoff
+}
+
+// NewDispatcher returns a dispatcher that writes batches of up to batchSize records to sinks, at least every
+// flushInterval. Write errors are passed to onError, which may be nil.
+func NewDispatcher(sinks map[string]Sink, batchSize int, flushInterval time.Duration, onError func(name string, err error)) *Dispatcher {
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if onError == nil {
+		onError = func(string, error) {}
+	}
+	return &Dispatcher{
+		names:         names,
+		sinks:         sinks,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		onError:       onError,
+		retry:         Backoff{Initial: time.Second, Max: 30 * time.Second, MaxRetries: -1},
+	}
+}
+
+// Run writes records to the sinks until the records channel is closed, then writes any remaining records and
+// flushes the sinks. It does not close the sinks.
+func (d *Dispatcher) Run(ctx context.Context, records <-chan Record) {
+	ticker := time.NewTicker(d.flushInterval)
+	defer ticker.Stop()
+	batch := make([]Record, 0, d.batchSize)
+	for {
+		select {
+		case r, ok := <-records:
+			if !ok {
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+				defer cancel()
+				d.write(ctx, batch)
+				d.flush(ctx)
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) >= d.batchSize {
+				d.write(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			d.write(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// write writes a batch to every sink, retrying the sinks that fail with a retryable error until ctx is done, and
+// acknowledges the batch once they've all written or dropped it.
+func (d *Dispatcher) write(ctx context.Context, batch []Record) {
+	if len(batch) == 0 {
+		return
+	}
+	pending := d.names
+	err := d.retry.Retry(ctx, func(ctx context.Context) error {
+		var failed []string
+		var errs []error
+		for _, name := range pending {
+			if err := d.writeSink(ctx, name, batch); err != nil {
+				failed = append(failed, name)
+				errs = append(errs, err)
+			}
+		}
+		pending = failed
+		return errors.Join(errs...)
+	})
+	if err == nil {
+		ack(batch)
+	}
+}
+
+func ack(batch []Record) {
+	for _, r := range batch {
+		if r.Ack != nil {
+			r.Ack()
+		}
+	}
+}
+
+// writeSink writes a batch to the named sink, counting the outcome and reporting any error. A batch the sink
+// rejects with an error that isn't retryable would be rejected again, so it's dropped: counted, reported and
+// treated as written, like the records a sink reports it dropped from a batch it wrote.
+func (d *Dispatcher) writeSink(ctx context.Context, name string, batch []Record) error {
+	if err := d.sinks[name].Write(ctx, batch); err != nil {
+		metrics.GetOrCreateCounter(fmt.Sprintf("tslogs_sink_errors_total{sink=%q}", name)).Inc()
+		var retryable *RetryableError
+		var dropped *DroppedError
+		switch {
+		case errors.As(err, &retryable) || ctx.Err() != nil:
+			d.onError(name, err)
+			return err
+		case errors.As(err, &dropped):
+			metrics.GetOrCreateCounter(fmt.Sprintf("tslogs_sink_dropped_records_total{sink=%q}", name)).Add(dropped.Records)
+			metrics.GetOrCreateCounter(fmt.Sprintf("tslogs_sink_records_total{sink=%q}", name)).Add(len(batch) - dropped.Records)
+			d.onError(name, err)
+			return nil
+		default:
+			metrics.GetOrCreateCounter(fmt.Sprintf("tslogs_sink_dropped_records_total{sink=%q}", name)).Add(len(batch))
+			d.onError(name, fmt.Errorf("drop %d records: %w", len(batch), err))
+			return nil
+		}
+	}
+	metrics.GetOrCreateCounter(fmt.Sprintf("tslogs_sink_records_total{sink=%q}", name)).Add(len(batch))
+	return nil
+}
+
+func (d *Dispatcher) flush(ctx context.Context) {
+	for _, name := range d.names {
+		if err := d.sinks[name].Flush(ctx); err != nil {
+			d.onError(name, err)
+		}
+	}
+}
+
+// Health returns the health of each sink, keyed by sink name.
+func (d *Dispatcher) Health() map[string]Health {
+	health := make(map[string]Health, len(d.sinks))
+	for name, s := range d.sinks {
+		health[name] = s.Health()
+	}
+	return health
+}
@@ -0,0 +1,368 @@
+// Package elasticsearch implements a sink that writes records to Elasticsearch or OpenSearch with the _bulk API.
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/highperformance-tech/ts-olly/internal/sink"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	sink.Register("elasticsearch", New)
+	sink.Register("opensearch", New)
+}
+
+// DefaultIndex is the index name pattern used unless the configuration says otherwise.
+const DefaultIndex = "tableau-{process}-{yyyy.MM.dd}"
+
+// indexTemplate is a composable index template mapping ts-olly's fields and the capture groups of the
+// log4j, log4j2 and httpd parsers.
+//
+//go:embed template.json
+var indexTemplate []byte
+
+var rejectedCounter = metrics.NewCounter("tslogs_elasticsearch_documents_rejected_total")
+
+// Sink writes batches of records to the _bulk endpoint. Documents the cluster rejects, e.g. because of
+// mapping conflicts, are written to the dead-letter file instead of failing the whole batch.
+type Sink struct {
+	url             string
+	index           indexName
+	username        string
+	password        string
+	apiKey          string
+	installTmpl     bool
+	templateName    string
+	templatePattern string
+	deadLetterPath  string
+	client          *http.Client
+	backoff         sink.Backoff
+	health          sink.HealthTracker
+
+	mu         sync.Mutex
+	deadLetter *os.File
+	indexed    map[string]int // the documents of the last batch that were indexed, if it must be written again
+}
+
+// New creates an Elasticsearch sink. The configuration keys are:
+//   - url: the cluster URL, e.g. https://elasticsearch:9200 (required)
+//   - index: the index name pattern (default: DefaultIndex)
+//   - username, password: HTTP basic auth
+//   - api_key: an Elasticsearch API key, used instead of basic auth
+//   - template.install: install the bundled index template on startup (default false)
+//   - template.name: the template's name (default "ts-olly")
+//   - template.pattern: the indices the template applies to (default: the index prefix followed by *)
+//   - dead_letter.path: file that rejected documents are appended to
+//   - insecure_skip_verify: skip TLS certificate verification (default false)
+//   - timeout: per-request timeout (default 30s)
+//   - retry.initial, retry.max, retry.max_retries: backoff on 429 and 5xx responses
+func New(cfg *viper.Viper) (sink.Sink, error) {
+	cfg.SetDefault("index", DefaultIndex)
+	cfg.SetDefault("template.name", "ts-olly")
+	cfg.SetDefault("timeout", 30*time.Second)
+	pattern := cfg.GetString("index")
+	index, err := parseIndexName(pattern)
+	if err != nil {
+		return nil, err
+	}
+	cfg.SetDefault("template.pattern", indexPrefix(pattern)+"*")
+	s := &Sink{
+		url:             strings.TrimSuffix(cfg.GetString("url"), "/"),
+		index:           index,
+		username:        cfg.GetString("username"),
+		password:        cfg.GetString("password"),
+		apiKey:          cfg.GetString("api_key"),
+		installTmpl:     cfg.GetBool("template.install"),
+		templateName:    cfg.GetString("template.name"),
+		templatePattern: cfg.GetString("template.pattern"),
+		deadLetterPath:  cfg.GetString("dead_letter.path"),
+		client: &http.Client{
+			Timeout: cfg.GetDuration("timeout"),
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.GetBool("insecure_skip_verify")},
+			},
+		},
+		backoff: sink.BackoffFrom(cfg),
+	}
+	if s.url == "" {
+		return nil, errors.New("url is required")
+	}
+	return s, nil
+}
+
+func (s *Sink) Open(ctx context.Context) error {
+	if s.deadLetterPath != "" {
+		f, err := os.OpenFile(s.deadLetterPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("open dead letter file %s: %w", s.deadLetterPath, err)
+		}
+		s.mu.Lock()
+		s.deadLetter = f
+		s.mu.Unlock()
+	}
+	if s.installTmpl {
+		if err := s.installTemplate(ctx); err != nil {
+			s.health.Observe(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// installTemplate creates or replaces the bundled index template, pointed at the configured indices.
+func (s *Sink) installTemplate(ctx context.Context) error {
+	var tmpl map[string]any
+	if err := json.Unmarshal(indexTemplate, &tmpl); err != nil {
+		return fmt.Errorf("decode index template: %w", err)
+	}
+	tmpl["index_patterns"] = []string{s.templatePattern}
+	body, err := json.Marshal(tmpl)
+	if err != nil {
+		return fmt.Errorf("encode index template: %w", err)
+	}
+	return s.backoff.Retry(ctx, func(ctx context.Context) error {
+		_, err := s.do(ctx, http.MethodPut, "/_index_template/"+s.templateName, "application/json", body)
+		if err != nil {
+			return fmt.Errorf("install index template %s: %w", s.templateName, err)
+		}
+		return nil
+	})
+}
+
+// doc is a record on its way to an index.
+type doc struct {
+	index string
+	body  []byte
+}
+
+// key identifies a document among those of a batch.
+func (d doc) key() string {
+	return d.index + "\n" + string(d.body)
+}
+
+// rejection is a document the cluster refused, with the reason it gave.
+type rejection struct {
+	Time     time.Time       `json:"time"`
+	Index    string          `json:"index"`
+	Status   int             `json:"status"`
+	Error    json.RawMessage `json:"error"`
+	Document json.RawMessage `json:"document"`
+}
+
+// Write indexes records with a _bulk request. Throttled documents are sent again, and if they still are when
+// the retries run out, the error is retryable and the documents that were indexed are remembered, so that only
+// the throttled ones are sent when the batch is written again. Rejected documents count as written: they're
+// dead-lettered, or dropped and reported.
+func (s *Sink) Write(ctx context.Context, records []sink.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	indexed := s.indexed
+	s.indexed = nil
+	s.mu.Unlock()
+	pending := make([]doc, 0, len(records))
+	for i := range records {
+		d := doc{index: s.index.render(&records[i]), body: document(records[i].JSON)}
+		if k := d.key(); indexed[k] > 0 {
+			indexed[k]--
+			continue
+		}
+		pending = append(pending, d)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	sent := pending
+	var rejected []rejection
+	err := s.backoff.Retry(ctx, func(ctx context.Context) error {
+		retry, reject, err := s.bulk(ctx, pending)
+		if err != nil {
+			return err
+		}
+		pending = retry
+		rejected = append(rejected, reject...)
+		if len(pending) > 0 {
+			return sink.Retryable(fmt.Errorf("%d documents were throttled", len(pending)), 0)
+		}
+		return nil
+	})
+	if err != nil {
+		s.remember(sent, pending)
+	}
+	if rerr := s.reject(rejected); rerr != nil {
+		err = errors.Join(err, sink.Dropped(rerr, len(rejected)))
+	}
+	s.health.Observe(err)
+	return err
+}
+
+// remember remembers the documents of sent that were indexed, i.e. that aren't pending, for the next Write.
+func (s *Sink) remember(sent, pending []doc) {
+	indexed := make(map[string]int, len(sent))
+	for _, d := range sent {
+		indexed[d.key()]++
+	}
+	for _, d := range pending {
+		indexed[d.key()]--
+	}
+	s.mu.Lock()
+	s.indexed = indexed
+	s.mu.Unlock()
+}
+
+// bulk sends docs in a single _bulk request, and returns the documents that should be retried and those
+// that were rejected outright.
+func (s *Sink) bulk(ctx context.Context, docs []doc) (retry []doc, rejected []rejection, err error) {
+	buf := &bytes.Buffer{}
+	for _, d := range docs {
+		action, _ := json.Marshal(map[string]map[string]string{"create": {"_index": d.index}})
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(d.body)
+		buf.WriteByte('\n')
+	}
+	respBody, err := s.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", buf.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("bulk write: %w", err)
+	}
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, nil, fmt.Errorf("decode bulk response: %w", err)
+	}
+	if !resp.Errors {
+		return nil, nil, nil
+	}
+	if len(resp.Items) != len(docs) {
+		return nil, nil, fmt.Errorf("bulk response has %d items for %d documents", len(resp.Items), len(docs))
+	}
+	for i, item := range resp.Items {
+		for _, result := range item {
+			switch {
+			case result.Status >= 200 && result.Status < 300:
+			case result.Status == http.StatusTooManyRequests || result.Status >= 500:
+				retry = append(retry, docs[i])
+			default:
+				rejected = append(rejected, rejection{
+					Time:     time.Now(),
+					Index:    docs[i].index,
+					Status:   result.Status,
+					Error:    result.Error,
+					Document: docs[i].body,
+				})
+			}
+		}
+	}
+	return retry, rejected, nil
+}
+
+// reject writes rejected documents to the dead-letter file. Without one, they are dropped and reported.
+// Either way, they count as written.
+func (s *Sink) reject(rejected []rejection) error {
+	if len(rejected) == 0 {
+		return nil
+	}
+	rejectedCounter.Add(len(rejected))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deadLetter == nil {
+		return fmt.Errorf("dropped %d rejected documents, first: %s", len(rejected), rejected[0].Error)
+	}
+	enc := json.NewEncoder(s.deadLetter)
+	for _, r := range rejected {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("write dead letter file %s: %w", s.deadLetterPath, err)
+		}
+	}
+	return nil
+}
+
+func (s *Sink) do(ctx context.Context, method, path, contentType string, body []byte) ([]byte, error) {
+	url := s.url + path
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+s.apiKey)
+	} else if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, sink.Retryable(fmt.Errorf("%s %s: %w", method, url, err), 0)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, sink.Retryable(fmt.Errorf("read response from %s: %w", url, err), 0)
+	}
+	if err := sink.CheckResponse(resp, respBody); err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, url, err)
+	}
+	return respBody, nil
+}
+
+func (s *Sink) Flush(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deadLetter == nil {
+		return nil
+	}
+	return s.deadLetter.Sync()
+}
+
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deadLetter == nil {
+		return nil
+	}
+	err := s.deadLetter.Close()
+	s.deadLetter = nil
+	return err
+}
+
+func (s *Sink) Health() sink.Health { return s.health.Health() }
+
+// document returns the record's JSON as it should be indexed. A field can't be text in some documents and an
+// object in others, so a plain-text message is moved to message.message, which is where the log4j and log4j2
+// parsers put the message when the line is parsed.
+func document(record []byte) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(record, &fields); err != nil {
+		return record
+	}
+	message, ok := fields["message"]
+	if !ok || len(message) == 0 || message[0] != '"' {
+		return record
+	}
+	fields["message"], _ = json.Marshal(map[string]json.RawMessage{"message": message})
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return record
+	}
+	return b
+}
@@ -0,0 +1,261 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/sink"
+	"github.com/spf13/viper"
+)
+
+func TestIndexName(t *testing.T) {
+	r := &sink.Record{
+		Time:      time.Date(2022, 7, 28, 23, 30, 0, 0, time.FixedZone("PDT", -7*3600)),
+		Node:      "node1",
+		Process:   "VizPortal",
+		Component: "com.tableau/Main",
+	}
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{DefaultIndex, "tableau-vizportal-2022.07.29"},
+		{"logs", "logs"},
+		{"tableau-{node}-{component}-{yyyy.MM}", "tableau-node1-com.tableau_main-2022.07"},
+		{"tableau-{level}-{yy-MM-dd-HH}", "tableau-unknown-22-07-29-06"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			name, err := parseIndexName(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := name.render(r); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+	for _, pattern := range []string{"tableau-{process", "tableau-{hostname}"} {
+		t.Run(pattern+" is invalid", func(t *testing.T) {
+			if _, err := parseIndexName(pattern); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestDocument(t *testing.T) {
+	tests := []struct {
+		name   string
+		record string
+		want   string
+	}{
+		{"text message is nested", `{"level":"info","message":"hello"}`, `{"level":"info","message":{"message":"hello"}}`},
+		{"parsed message is unchanged", `{"message":{"level":"INFO"}}`, `{"message":{"level":"INFO"}}`},
+		{"no message is unchanged", `{"error":"boom"}`, `{"error":"boom"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(document([]byte(tt.record))); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+// fakeCluster answers bulk requests with the queued per-item statuses, and 201 once they run out.
+type fakeCluster struct {
+	mu        sync.Mutex
+	items     [][]int
+	bulks     []string
+	templates map[string]map[string]any
+}
+
+func (f *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_index_template/"):
+		var tmpl map[string]any
+		if err := json.Unmarshal(body, &tmpl); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if f.templates == nil {
+			f.templates = make(map[string]map[string]any)
+		}
+		f.templates[strings.TrimPrefix(r.URL.Path, "/_index_template/")] = tmpl
+		fmt.Fprint(w, `{"acknowledged":true}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/_bulk":
+		f.bulks = append(f.bulks, string(body))
+		n := strings.Count(string(body), "\n") / 2
+		var statuses []int
+		if len(f.items) > 0 {
+			statuses = f.items[0]
+			f.items = f.items[1:]
+		}
+		var items []string
+		hasErrors := false
+		for i := 0; i < n; i++ {
+			status := http.StatusCreated
+			if i < len(statuses) {
+				status = statuses[i]
+			}
+			if status >= 300 {
+				hasErrors = true
+				items = append(items, fmt.Sprintf(`{"create":{"status":%d,"error":{"type":"mapper_parsing_exception","reason":"status %d"}}}`, status, status))
+			} else {
+				items = append(items, fmt.Sprintf(`{"create":{"status":%d}}`, status))
+			}
+		}
+		fmt.Fprintf(w, `{"took":1,"errors":%t,"items":[%s]}`, hasErrors, strings.Join(items, ","))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newSink(t *testing.T, url string, settings map[string]any) sink.Sink {
+	t.Helper()
+	cfg := viper.New()
+	cfg.Set("url", url)
+	cfg.Set("retry.initial", time.Millisecond)
+	for k, v := range settings {
+		cfg.Set(k, v)
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func testRecords(n int) []sink.Record {
+	records := make([]sink.Record, n)
+	for i := range records {
+		records[i] = sink.Record{
+			Time:    time.Date(2022, 7, 28, 12, 0, 0, 0, time.UTC),
+			Process: "vizportal",
+			JSON:    []byte(fmt.Sprintf(`{"n":%d,"message":{"level":"INFO"}}`, i)),
+		}
+	}
+	return records
+}
+
+func TestWrite(t *testing.T) {
+	t.Run("writes bulk NDJSON to the rendered index", func(t *testing.T) {
+		cluster := &fakeCluster{}
+		srv := httptest.NewServer(cluster)
+		defer srv.Close()
+		s := newSink(t, srv.URL, nil)
+		if err := s.Write(context.Background(), testRecords(2)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := `{"create":{"_index":"tableau-vizportal-2022.07.28"}}` + "\n" + `{"n":0,"message":{"level":"INFO"}}` + "\n" +
+			`{"create":{"_index":"tableau-vizportal-2022.07.28"}}` + "\n" + `{"n":1,"message":{"level":"INFO"}}` + "\n"
+		if len(cluster.bulks) != 1 || cluster.bulks[0] != want {
+			t.Errorf("unexpected bulk requests %q", cluster.bulks)
+		}
+	})
+
+	t.Run("retries throttled documents and dead-letters rejected ones", func(t *testing.T) {
+		cluster := &fakeCluster{items: [][]int{{201, 429, 400}}}
+		srv := httptest.NewServer(cluster)
+		defer srv.Close()
+		deadLetter := filepath.Join(t.TempDir(), "rejected.json")
+		s := newSink(t, srv.URL, map[string]any{"dead_letter.path": deadLetter})
+		if err := s.Write(context.Background(), testRecords(3)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(cluster.bulks) != 2 {
+			t.Fatalf("expected 2 bulk requests, got %d", len(cluster.bulks))
+		}
+		if !strings.Contains(cluster.bulks[1], `"n":1`) || strings.Count(cluster.bulks[1], "\n") != 2 {
+			t.Errorf("expected only the throttled document to be retried, got %q", cluster.bulks[1])
+		}
+		f, err := os.Open(deadLetter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var rejected []rejection
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var r rejection
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				t.Fatal(err)
+			}
+			rejected = append(rejected, r)
+		}
+		if len(rejected) != 1 || rejected[0].Status != 400 || !strings.Contains(string(rejected[0].Document), `"n":2`) {
+			t.Errorf("unexpected dead letters %+v", rejected)
+		}
+		if !strings.Contains(string(rejected[0].Error), "mapper_parsing_exception") {
+			t.Errorf("expected the error to be recorded, got %s", rejected[0].Error)
+		}
+	})
+
+	t.Run("reports rejected documents without a dead letter file", func(t *testing.T) {
+		cluster := &fakeCluster{items: [][]int{{400}}}
+		srv := httptest.NewServer(cluster)
+		defer srv.Close()
+		s := newSink(t, srv.URL, nil)
+		var dropped *sink.DroppedError
+		if err := s.Write(context.Background(), testRecords(1)); !errors.As(err, &dropped) || dropped.Records != 1 {
+			t.Fatalf("expected the rejected document to be reported dropped, got %v", err)
+		}
+		if s.Health().Healthy {
+			t.Error("expected sink to be unhealthy")
+		}
+	})
+
+	t.Run("writes only the throttled documents of a batch written again", func(t *testing.T) {
+		cluster := &fakeCluster{items: [][]int{{201, 429, 400}}}
+		srv := httptest.NewServer(cluster)
+		defer srv.Close()
+		s := newSink(t, srv.URL, map[string]any{"retry.max_retries": 0})
+		var retryable *sink.RetryableError
+		if err := s.Write(context.Background(), testRecords(3)); !errors.As(err, &retryable) {
+			t.Fatalf("expected the throttled document to be retryable, got %v", err)
+		}
+		if err := s.Write(context.Background(), testRecords(3)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(cluster.bulks) != 2 || !strings.Contains(cluster.bulks[1], `"n":1`) || strings.Count(cluster.bulks[1], "\n") != 2 {
+			t.Errorf("expected only the throttled document to be written again, got %q", cluster.bulks)
+		}
+	})
+}
+
+func TestInstallTemplate(t *testing.T) {
+	cluster := &fakeCluster{}
+	srv := httptest.NewServer(cluster)
+	defer srv.Close()
+	newSink(t, srv.URL, map[string]any{"template.install": true, "index": "tsolly-{node}-{yyyy.MM.dd}"})
+	tmpl, ok := cluster.templates["ts-olly"]
+	if !ok {
+		t.Fatalf("expected template to be installed, got %v", cluster.templates)
+	}
+	if patterns, _ := tmpl["index_patterns"].([]any); len(patterns) != 1 || patterns[0] != "tsolly-*" {
+		t.Errorf("expected the template to match the index, got %v", tmpl["index_patterns"])
+	}
+	if _, ok := tmpl["template"].(map[string]any)["mappings"]; !ok {
+		t.Error("expected the template to carry mappings")
+	}
+}
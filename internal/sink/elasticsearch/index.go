@@ -0,0 +1,103 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/highperformance-tech/ts-olly/internal/sink"
+)
+
+// indexFields are the record fields that can be substituted into an index name.
+var indexFields = map[string]func(r *sink.Record) string{
+	"node":      func(r *sink.Record) string { return r.Node },
+	"process":   func(r *sink.Record) string { return r.Process },
+	"processid": func(r *sink.Record) string { return strconv.Itoa(int(r.ProcessID)) },
+	"component": func(r *sink.Record) string { return r.Component },
+	"level":     func(r *sink.Record) string { return r.Level },
+}
+
+// dateFormat converts the Java date pattern letters commonly used in index names to a Go layout.
+var dateFormat = strings.NewReplacer(
+	"yyyy", "2006",
+	"yy", "06",
+	"MM", "01",
+	"dd", "02",
+	"HH", "15",
+)
+
+// indexName is a parsed index name pattern such as tableau-{process}-{yyyy.MM.dd}.
+type indexName []func(r *sink.Record) string
+
+// parseIndexName parses a pattern of literal text and {placeholders}. A placeholder is either the name of a
+// record field, or a date pattern that is formatted with the record's time in UTC.
+func parseIndexName(pattern string) (indexName, error) {
+	var name indexName
+	for rest := pattern; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			name = append(name, literal(rest))
+			break
+		}
+		if open > 0 {
+			name = append(name, literal(rest[:open]))
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed placeholder in index %q", pattern)
+		}
+		placeholder := rest[open+1 : open+end]
+		rest = rest[open+end+1:]
+		if field, ok := indexFields[placeholder]; ok {
+			name = append(name, func(r *sink.Record) string { return sanitize(field(r)) })
+			continue
+		}
+		layout := dateFormat.Replace(placeholder)
+		if layout == placeholder {
+			return nil, fmt.Errorf("unknown placeholder {%s} in index %q", placeholder, pattern)
+		}
+		name = append(name, func(r *sink.Record) string {
+			t := r.Time
+			if t.IsZero() {
+				t = r.ObservedTime
+			}
+			return t.UTC().Format(layout)
+		})
+	}
+	return name, nil
+}
+
+func literal(s string) func(*sink.Record) string {
+	return func(*sink.Record) string { return s }
+}
+
+// render returns the index the record belongs in.
+func (n indexName) render(r *sink.Record) string {
+	var b strings.Builder
+	for _, part := range n {
+		b.WriteString(part(r))
+	}
+	return b.String()
+}
+
+// indexPrefix returns the literal text before the first placeholder of an index name pattern.
+func indexPrefix(pattern string) string {
+	if i := strings.IndexByte(pattern, '{'); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// sanitize makes a field value safe to use in an index name, which must be lowercase and may not contain
+// spaces or any of \/*?"<>|,#:
+func sanitize(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(` \/*?"<>|,#:`, r) {
+			return '_'
+		}
+		return r
+	}, strings.ToLower(s))
+}
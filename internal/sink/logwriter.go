@@ -0,0 +1,48 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// LogWriter adapts a sink to an io.Writer so that a zerolog logger can write ts-olly's own logs to it.
+// Each call to Write is expected to carry a single JSON log event.
+type LogWriter struct {
+	sink    Sink
+	node    string
+	process string
+}
+
+// NewLogWriter returns a writer that delivers each log event to s as a record of the given node and process.
+func NewLogWriter(s Sink, node, process string) *LogWriter {
+	return &LogWriter{sink: s, node: node, process: process}
+}
+
+var _ io.Writer = (*LogWriter)(nil)
+
+func (w *LogWriter) Write(p []byte) (int, error) {
+	now := time.Now()
+	event := struct {
+		Level     string `json:"level"`
+		Component string `json:"component"`
+		Message   string `json:"message"`
+	}{}
+	_ = json.Unmarshal(p, &event)
+	r := Record{
+		Time:         now,
+		ObservedTime: now,
+		Node:         w.node,
+		Process:      w.process,
+		Component:    event.Component,
+		Level:        event.Level,
+		Message:      event.Message,
+		JSON:         bytes.Clone(bytes.TrimRight(p, "\n")),
+	}
+	if err := w.sink.Write(context.Background(), []Record{r}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
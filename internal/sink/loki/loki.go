@@ -0,0 +1,212 @@
+// Package loki implements a sink that pushes records to Grafana Loki using the protobuf push API.
+package loki
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/highperformance-tech/ts-olly/internal/sink"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func init() {
+	sink.Register("loki", New)
+}
+
+// DefaultLabels are the record fields that identify a stream unless the configuration says otherwise.
+var DefaultLabels = []string{"node", "process", "processid", "component", "level"}
+
+// labelValues maps each supported label name to the record field it is taken from.
+var labelValues = map[string]func(r *sink.Record) string{
+	"node":      func(r *sink.Record) string { return r.Node },
+	"process":   func(r *sink.Record) string { return r.Process },
+	"processid": func(r *sink.Record) string { return strconv.Itoa(int(r.ProcessID)) },
+	"component": func(r *sink.Record) string { return r.Component },
+	"level":     func(r *sink.Record) string { return r.Level },
+	"filename":  func(r *sink.Record) string { return r.Filename },
+}
+
+// Sink pushes batches of records to a Loki push endpoint.
+type Sink struct {
+	url      string
+	labels   []string
+	tenantID string
+	username string
+	password string
+	client   *http.Client
+	backoff  sink.Backoff
+	health   sink.HealthTracker
+}
+
+// New creates a Loki sink. The configuration keys are:
+//   - url: the push endpoint, e.g. http://loki:3100/loki/api/v1/push (required)
+//   - labels: the record fields streams are labelled with (default: DefaultLabels)
+//   - tenant_id: sent as X-Scope-OrgID for multi-tenant Loki
+//   - username, password: HTTP basic auth
+//   - timeout: per-request timeout (default 10s)
+//   - retry.initial, retry.max, retry.max_retries: backoff on 429 and 5xx responses
+func New(cfg *viper.Viper) (sink.Sink, error) {
+	cfg.SetDefault("labels", DefaultLabels)
+	cfg.SetDefault("timeout", 10*time.Second)
+	s := &Sink{
+		url:      cfg.GetString("url"),
+		labels:   cfg.GetStringSlice("labels"),
+		tenantID: cfg.GetString("tenant_id"),
+		username: cfg.GetString("username"),
+		password: cfg.GetString("password"),
+		client:   &http.Client{Timeout: cfg.GetDuration("timeout")},
+		backoff:  sink.BackoffFrom(cfg),
+	}
+	if s.url == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	for _, l := range s.labels {
+		if _, ok := labelValues[l]; !ok {
+			return nil, fmt.Errorf("unsupported label %q", l)
+		}
+	}
+	sort.Strings(s.labels)
+	return s, nil
+}
+
+func (s *Sink) Open(context.Context) error { return nil }
+
+func (s *Sink) Write(ctx context.Context, records []sink.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	body := snappy.Encode(nil, encodePushRequest(s.streams(records)))
+	err := s.backoff.Retry(ctx, func(ctx context.Context) error {
+		return s.push(ctx, body)
+	})
+	s.health.Observe(err)
+	return err
+}
+
+func (s *Sink) push(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	if s.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", s.tenantID)
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return sink.Retryable(fmt.Errorf("push to %s: %w", s.url, err), 0)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err := sink.CheckResponse(resp, respBody); err != nil {
+		return fmt.Errorf("push to %s: %w", s.url, err)
+	}
+	return nil
+}
+
+func (s *Sink) Flush(context.Context) error { return nil }
+func (s *Sink) Close() error                { return nil }
+func (s *Sink) Health() sink.Health         { return s.health.Health() }
+
+// stream is a set of entries sharing a label set.
+type stream struct {
+	labels  string
+	entries []entry
+}
+
+type entry struct {
+	time time.Time
+	line []byte
+}
+
+// streams groups records by their label set, keeping streams and entries in the order they were first seen.
+func (s *Sink) streams(records []sink.Record) []*stream {
+	var streams []*stream
+	byLabels := make(map[string]*stream)
+	for i := range records {
+		r := &records[i]
+		labels := s.labelSet(r)
+		st, ok := byLabels[labels]
+		if !ok {
+			st = &stream{labels: labels}
+			byLabels[labels] = st
+			streams = append(streams, st)
+		}
+		t := r.Time
+		if t.IsZero() {
+			t = r.ObservedTime
+		}
+		st.entries = append(st.entries, entry{time: t, line: r.JSON})
+	}
+	return streams
+}
+
+// labelSet renders a record's labels in Loki's selector syntax, e.g. {node="node1", process="vizportal"}.
+// Labels with empty values are left out; a record with no labels at all is labelled job="ts-olly".
+func (s *Sink) labelSet(r *sink.Record) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for _, name := range s.labels {
+		value := labelValues[name](r)
+		if value == "" {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(value))
+	}
+	if b.Len() == 1 {
+		b.WriteString(`job="ts-olly"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// encodePushRequest encodes streams as a logproto.PushRequest:
+//
+//	message PushRequest { repeated Stream streams = 1; }
+//	message Stream { string labels = 1; repeated Entry entries = 2; }
+//	message Entry { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+func encodePushRequest(streams []*stream) []byte {
+	var req []byte
+	for _, st := range streams {
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.BytesType)
+		sb = protowire.AppendString(sb, st.labels)
+		for _, e := range st.entries {
+			var ts []byte
+			ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(e.time.Unix()))
+			ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(e.time.Nanosecond()))
+
+			var eb []byte
+			eb = protowire.AppendTag(eb, 1, protowire.BytesType)
+			eb = protowire.AppendBytes(eb, ts)
+			eb = protowire.AppendTag(eb, 2, protowire.BytesType)
+			eb = protowire.AppendBytes(eb, e.line)
+
+			sb = protowire.AppendTag(sb, 2, protowire.BytesType)
+			sb = protowire.AppendBytes(sb, eb)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, sb)
+	}
+	return req
+}
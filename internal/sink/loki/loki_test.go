@@ -0,0 +1,238 @@
+package loki
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/highperformance-tech/ts-olly/internal/sink"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// pushed is a decoded stream, with its entries' lines.
+type pushed struct {
+	labels string
+	times  []time.Time
+	lines  []string
+}
+
+// decodePushRequest is the inverse of encodePushRequest.
+func decodePushRequest(t *testing.T, b []byte) []pushed {
+	t.Helper()
+	var streams []pushed
+	forEachField(t, b, func(num protowire.Number, v []byte, _ uint64) {
+		var st pushed
+		forEachField(t, v, func(num protowire.Number, v []byte, _ uint64) {
+			switch num {
+			case 1:
+				st.labels = string(v)
+			case 2:
+				var ts time.Time
+				var line string
+				forEachField(t, v, func(num protowire.Number, v []byte, _ uint64) {
+					switch num {
+					case 1:
+						var sec, nsec uint64
+						forEachField(t, v, func(num protowire.Number, _ []byte, n uint64) {
+							if num == 1 {
+								sec = n
+							} else {
+								nsec = n
+							}
+						})
+						ts = time.Unix(int64(sec), int64(nsec))
+					case 2:
+						line = string(v)
+					}
+				})
+				st.times = append(st.times, ts)
+				st.lines = append(st.lines, line)
+			}
+		})
+		streams = append(streams, st)
+	})
+	return streams
+}
+
+func forEachField(t *testing.T, b []byte, fn func(num protowire.Number, v []byte, n uint64)) {
+	t.Helper()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				t.Fatalf("bad bytes: %v", protowire.ParseError(n))
+			}
+			fn(num, v, 0)
+			b = b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				t.Fatalf("bad varint: %v", protowire.ParseError(n))
+			}
+			fn(num, nil, v)
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %v", typ)
+		}
+	}
+}
+
+// fakeLoki records push requests and answers with the queued status codes, then 204.
+type fakeLoki struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (f *fakeLoki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, body)
+	if len(f.statuses) > 0 {
+		status := f.statuses[0]
+		f.statuses = f.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newSink(t *testing.T, url string, settings map[string]any) sink.Sink {
+	t.Helper()
+	cfg := viper.New()
+	cfg.Set("url", url)
+	cfg.Set("retry.initial", time.Millisecond)
+	for k, v := range settings {
+		cfg.Set(k, v)
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestWrite(t *testing.T) {
+	ts := time.Date(2022, 7, 28, 12, 0, 0, 123, time.UTC)
+	records := []sink.Record{
+		{Time: ts, Node: "node1", Process: "vizportal", ProcessID: 0, Level: "info", JSON: []byte(`{"n":1}`)},
+		{Time: ts.Add(time.Second), Node: "node1", Process: "vizportal", ProcessID: 1, Level: "info", JSON: []byte(`{"n":2}`)},
+		{Time: ts.Add(2 * time.Second), Node: "node1", Process: "vizportal", ProcessID: 0, Level: "info", JSON: []byte(`{"n":3}`)},
+	}
+
+	t.Run("groups records into streams by label set", func(t *testing.T) {
+		loki := &fakeLoki{}
+		srv := httptest.NewServer(loki)
+		defer srv.Close()
+		s := newSink(t, srv.URL, map[string]any{"tenant_id": "tableau"})
+		if err := s.Write(context.Background(), records); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(loki.requests) != 1 {
+			t.Fatalf("expected 1 request, got %d", len(loki.requests))
+		}
+		req := loki.requests[0]
+		if req.Header.Get("Content-Type") != "application/x-protobuf" || req.Header.Get("Content-Encoding") != "snappy" {
+			t.Errorf("unexpected headers %v", req.Header)
+		}
+		if req.Header.Get("X-Scope-OrgID") != "tableau" {
+			t.Errorf("expected tenant header, got %q", req.Header.Get("X-Scope-OrgID"))
+		}
+		body, err := snappy.Decode(nil, loki.bodies[0])
+		if err != nil {
+			t.Fatalf("expected snappy body, got %v", err)
+		}
+		streams := decodePushRequest(t, body)
+		if len(streams) != 2 {
+			t.Fatalf("expected 2 streams, got %d", len(streams))
+		}
+		want := `{level="info", node="node1", process="vizportal", processid="0"}`
+		if streams[0].labels != want {
+			t.Errorf("expected labels %s, got %s", want, streams[0].labels)
+		}
+		if len(streams[0].lines) != 2 || streams[0].lines[0] != `{"n":1}` || streams[0].lines[1] != `{"n":3}` {
+			t.Errorf("unexpected entries %v", streams[0].lines)
+		}
+		if !streams[0].times[0].Equal(ts) {
+			t.Errorf("expected timestamp %v, got %v", ts, streams[0].times[0])
+		}
+		if streams[1].labels != `{level="info", node="node1", process="vizportal", processid="1"}` {
+			t.Errorf("unexpected labels %s", streams[1].labels)
+		}
+	})
+
+	t.Run("retries on 429 and 5xx", func(t *testing.T) {
+		loki := &fakeLoki{statuses: []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}}
+		srv := httptest.NewServer(loki)
+		defer srv.Close()
+		s := newSink(t, srv.URL, nil)
+		if err := s.Write(context.Background(), records); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(loki.requests) != 3 {
+			t.Errorf("expected 3 attempts, got %d", len(loki.requests))
+		}
+		if !s.Health().Healthy {
+			t.Error("expected sink to be healthy")
+		}
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		loki := &fakeLoki{statuses: []int{http.StatusBadRequest}}
+		srv := httptest.NewServer(loki)
+		defer srv.Close()
+		s := newSink(t, srv.URL, nil)
+		if err := s.Write(context.Background(), records); err == nil {
+			t.Fatal("expected error")
+		}
+		if len(loki.requests) != 1 {
+			t.Errorf("expected 1 attempt, got %d", len(loki.requests))
+		}
+		if s.Health().Healthy {
+			t.Error("expected sink to be unhealthy")
+		}
+	})
+}
+
+func TestNew(t *testing.T) {
+	t.Run("url is required", func(t *testing.T) {
+		if _, err := New(viper.New()); err == nil {
+			t.Error("expected error")
+		}
+	})
+	t.Run("unknown labels are rejected", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("url", "http://loki")
+		cfg.Set("labels", []string{"node", "hostname"})
+		if _, err := New(cfg); err == nil {
+			t.Error("expected error")
+		}
+	})
+	t.Run("records without labels get a job label", func(t *testing.T) {
+		cfg := viper.New()
+		cfg.Set("url", "http://loki")
+		cfg.Set("labels", []string{"component"})
+		s, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.(*Sink).labelSet(&sink.Record{}); got != `{job="ts-olly"}` {
+			t.Errorf("unexpected labels %s", got)
+		}
+	})
+}
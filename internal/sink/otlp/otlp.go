@@ -0,0 +1,401 @@
+// Package otlp implements a sink that exports records as OpenTelemetry log records over OTLP/gRPC or OTLP/HTTP.
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/highperformance-tech/ts-olly/internal/sink"
+	"github.com/spf13/viper"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func init() {
+	sink.Register("otlp", New)
+}
+
+const (
+	protocolGRPC = "grpc"
+	protocolHTTP = "http/protobuf"
+	scopeName    = "ts-olly"
+)
+
+var rejectedCounter = metrics.NewCounter("tslogs_otlp_log_records_rejected_total")
+
+// Sink exports batches of records to an OTLP endpoint, typically an OpenTelemetry Collector.
+type Sink struct {
+	protocol   string
+	endpoint   string
+	insecure   bool
+	tlsConfig  *tls.Config
+	headers    map[string]string
+	gzip       bool
+	timeout    time.Duration
+	backoff    sink.Backoff
+	health     sink.HealthTracker
+	httpClient *http.Client
+	mu         sync.Mutex
+	conn       *grpc.ClientConn
+	grpcClient collogspb.LogsServiceClient
+}
+
+// New creates an OTLP sink. The configuration keys are:
+//   - protocol: grpc or http/protobuf (default grpc)
+//   - endpoint: host:port for gRPC, e.g. otel-collector:4317, or the URL for HTTP, e.g.
+//     http://otel-collector:4318, to which /v1/logs is appended if it has no path (required)
+//   - insecure: use gRPC without TLS (default false)
+//   - insecure_skip_verify: skip TLS certificate verification (default false)
+//   - headers: extra headers or gRPC metadata sent with every export, e.g. for authentication
+//   - compression: gzip or none (default none)
+//   - timeout: per-export timeout (default 10s)
+//   - retry.initial, retry.max, retry.max_retries: backoff on retryable failures
+func New(cfg *viper.Viper) (sink.Sink, error) {
+	cfg.SetDefault("protocol", protocolGRPC)
+	cfg.SetDefault("timeout", 10*time.Second)
+	s := &Sink{
+		protocol:  cfg.GetString("protocol"),
+		endpoint:  cfg.GetString("endpoint"),
+		insecure:  cfg.GetBool("insecure"),
+		tlsConfig: &tls.Config{InsecureSkipVerify: cfg.GetBool("insecure_skip_verify")},
+		headers:   cfg.GetStringMapString("headers"),
+		timeout:   cfg.GetDuration("timeout"),
+		backoff:   sink.BackoffFrom(cfg),
+	}
+	if s.endpoint == "" {
+		return nil, errors.New("endpoint is required")
+	}
+	switch compression := cfg.GetString("compression"); compression {
+	case "", "none":
+	case "gzip":
+		s.gzip = true
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+	switch s.protocol {
+	case protocolGRPC:
+	case protocolHTTP:
+		u, err := url.Parse(s.endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q: expected a URL", s.endpoint)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/v1/logs"
+		}
+		s.endpoint = u.String()
+		s.httpClient = &http.Client{
+			Timeout:   s.timeout,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: s.tlsConfig},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q (expected %s or %s)", s.protocol, protocolGRPC, protocolHTTP)
+	}
+	return s, nil
+}
+
+func (s *Sink) Open(context.Context) error {
+	if s.protocol != protocolGRPC {
+		return nil
+	}
+	creds := credentials.NewTLS(s.tlsConfig)
+	if s.insecure {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.NewClient(s.endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", s.endpoint, err)
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.grpcClient = collogspb.NewLogsServiceClient(conn)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Sink) Write(ctx context.Context, records []sink.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	req := exportRequest(records)
+	var partial *collogspb.ExportLogsPartialSuccess
+	err := s.backoff.Retry(ctx, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+		var resp *collogspb.ExportLogsServiceResponse
+		var err error
+		if s.protocol == protocolGRPC {
+			resp, err = s.exportGRPC(ctx, req)
+		} else {
+			resp, err = s.exportHTTP(ctx, req)
+		}
+		if err != nil {
+			return err
+		}
+		partial = resp.GetPartialSuccess()
+		return nil
+	})
+	s.health.Observe(err)
+	if err != nil {
+		return err
+	}
+	// The collector accepted the rest of the batch, and exporting the rejected records again wouldn't change
+	// its mind
+	if rejected := partial.GetRejectedLogRecords(); rejected > 0 {
+		rejectedCounter.Add(int(rejected))
+		return sink.Dropped(fmt.Errorf("%s rejected %d log records: %s", s.endpoint, rejected, partial.GetErrorMessage()), int(rejected))
+	}
+	return nil
+}
+
+func (s *Sink) exportGRPC(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	s.mu.Lock()
+	client := s.grpcClient
+	s.mu.Unlock()
+	if client == nil {
+		return nil, errors.New("sink is not open")
+	}
+	if len(s.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(s.headers))
+	}
+	var opts []grpc.CallOption
+	if s.gzip {
+		opts = append(opts, grpc.UseCompressor(grpcgzip.Name))
+	}
+	resp, err := client.Export(ctx, req, opts...)
+	if err != nil {
+		code := status.Code(err)
+		err = fmt.Errorf("export to %s: %w", s.endpoint, err)
+		switch code {
+		case codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.OutOfRange,
+			codes.Unavailable, codes.DataLoss:
+			return nil, sink.Retryable(err, 0)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *Sink) exportHTTP(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("encode export request: %w", err)
+	}
+	if s.gzip {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		gz.Write(body)
+		if err := gz.Close(); err != nil {
+			return nil, fmt.Errorf("compress export request: %w", err)
+		}
+		body = buf.Bytes()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	if s.gzip {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range s.headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpResp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, sink.Retryable(fmt.Errorf("export to %s: %w", s.endpoint, err), 0)
+	}
+	defer httpResp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(httpResp.Body, 64<<10))
+	if err := sink.CheckResponse(httpResp, respBody); err != nil {
+		return nil, fmt.Errorf("export to %s: %w", s.endpoint, err)
+	}
+	resp := &collogspb.ExportLogsServiceResponse{}
+	if err := proto.Unmarshal(respBody, resp); err != nil {
+		return nil, fmt.Errorf("decode response from %s: %w", s.endpoint, err)
+	}
+	return resp, nil
+}
+
+func (s *Sink) Flush(context.Context) error { return nil }
+
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	s.grpcClient = nil
+	return err
+}
+
+func (s *Sink) Health() sink.Health { return s.health.Health() }
+
+// resourceKey identifies the resource a record belongs to.
+type resourceKey struct {
+	node      string
+	process   string
+	processID uint8
+}
+
+// exportRequest groups records by resource, keeping resources and records in the order they were first seen.
+func exportRequest(records []sink.Record) *collogspb.ExportLogsServiceRequest {
+	req := &collogspb.ExportLogsServiceRequest{}
+	scopes := make(map[resourceKey]*logspb.ScopeLogs)
+	for i := range records {
+		r := &records[i]
+		key := resourceKey{r.Node, r.Process, r.ProcessID}
+		scope, ok := scopes[key]
+		if !ok {
+			scope = &logspb.ScopeLogs{Scope: &commonpb.InstrumentationScope{Name: scopeName}}
+			scopes[key] = scope
+			req.ResourceLogs = append(req.ResourceLogs, &logspb.ResourceLogs{
+				Resource:  resource(r),
+				ScopeLogs: []*logspb.ScopeLogs{scope},
+			})
+		}
+		scope.LogRecords = append(scope.LogRecords, logRecord(r))
+	}
+	return req
+}
+
+func resource(r *sink.Record) *resourcepb.Resource {
+	var attrs []*commonpb.KeyValue
+	if r.Process != "" {
+		attrs = append(attrs, stringAttr("service.name", r.Process))
+		attrs = append(attrs, stringAttr("service.instance.id", strconv.Itoa(int(r.ProcessID))))
+	}
+	if r.Node != "" {
+		attrs = append(attrs, stringAttr("host.name", r.Node))
+	}
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+func logRecord(r *sink.Record) *logspb.LogRecord {
+	lr := &logspb.LogRecord{
+		ObservedTimeUnixNano: unixNano(r.ObservedTime),
+		TimeUnixNano:         unixNano(r.Time),
+		SeverityNumber:       severity(r.Level),
+		SeverityText:         r.Level,
+		Body:                 body(r.Message),
+	}
+	if r.Filename != "" {
+		lr.Attributes = append(lr.Attributes,
+			stringAttr("log.file.path", r.Filename),
+			stringAttr("log.file.name", filepath.Base(r.Filename)),
+			intAttr("log.file.offset", r.Offset),
+			intAttr("log.file.line", int64(r.Line)),
+		)
+	}
+	if r.FileID != "" {
+		lr.Attributes = append(lr.Attributes, stringAttr("log.file.id", r.FileID))
+	}
+	if r.Component != "" {
+		lr.Attributes = append(lr.Attributes, stringAttr("component", r.Component))
+	}
+	return lr
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// severity maps a level name to its OpenTelemetry severity number.
+func severity(level string) logspb.SeverityNumber {
+	switch strings.ToLower(level) {
+	case "trace":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_TRACE
+	case "debug":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case "info":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	case "warn", "warning":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case "error":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	case "fatal", "panic":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL
+	}
+	return logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED
+}
+
+// body returns the message as a log body. Messages that are JSON objects, i.e. JSON logs and parsed lines,
+// become maps so that their fields stay queryable.
+func body(message string) *commonpb.AnyValue {
+	if strings.HasPrefix(message, "{") {
+		var v map[string]any
+		d := json.NewDecoder(strings.NewReader(message))
+		d.UseNumber()
+		if err := d.Decode(&v); err == nil {
+			return anyValue(v)
+		}
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: message}}
+}
+
+func anyValue(v any) *commonpb.AnyValue {
+	switch v := v.(type) {
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: i}}
+		}
+		f, _ := v.Float64()
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: f}}
+	case []any:
+		values := make([]*commonpb.AnyValue, len(v))
+		for i, e := range v {
+			values[i] = anyValue(e)
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	case map[string]any:
+		kvs := make([]*commonpb.KeyValue, 0, len(v))
+		for k, e := range v {
+			kvs = append(kvs, &commonpb.KeyValue{Key: k, Value: anyValue(e)})
+		}
+		// Maps iterate in random order; sort so the same message always encodes the same way
+		slices.SortFunc(kvs, func(a, b *commonpb.KeyValue) int { return strings.Compare(a.Key, b.Key) })
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: kvs}}}
+	}
+	return &commonpb.AnyValue{}
+}
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func intAttr(key string, value int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}}}
+}
@@ -0,0 +1,266 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/sink"
+	"github.com/spf13/viper"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	logged   = time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.UTC)
+	observed = logged.Add(2 * time.Second)
+	records  = []sink.Record{
+		{
+			Time:         logged,
+			ObservedTime: observed,
+			Node:         "node1",
+			Filename:     "/logs/vizportal/vizportal_node1-0.log",
+			FileID:       "beef",
+			Process:      "vizportal",
+			ProcessID:    1,
+			Component:    "com.tableau.Main",
+			Line:         7,
+			Offset:       512,
+			Level:        "error",
+			Message:      "boom",
+		},
+		{
+			Time:         logged,
+			ObservedTime: observed,
+			Node:         "node1",
+			Process:      "httpd",
+			Level:        "info",
+			Message:      `{"status":"200","ms":42}`,
+		},
+	}
+)
+
+func attributes(kvs []*commonpb.KeyValue) map[string]*commonpb.AnyValue {
+	attrs := make(map[string]*commonpb.AnyValue)
+	for _, kv := range kvs {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func checkRequest(t *testing.T, req *collogspb.ExportLogsServiceRequest) {
+	t.Helper()
+	if len(req.ResourceLogs) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(req.ResourceLogs))
+	}
+	res := attributes(req.ResourceLogs[0].Resource.Attributes)
+	if res["service.name"].GetStringValue() != "vizportal" || res["service.instance.id"].GetStringValue() != "1" || res["host.name"].GetStringValue() != "node1" {
+		t.Errorf("unexpected resource %v", res)
+	}
+	lr := req.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if lr.TimeUnixNano != uint64(logged.UnixNano()) || lr.ObservedTimeUnixNano != uint64(observed.UnixNano()) {
+		t.Errorf("unexpected timestamps %d, %d", lr.TimeUnixNano, lr.ObservedTimeUnixNano)
+	}
+	if lr.SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_ERROR || lr.SeverityText != "error" {
+		t.Errorf("unexpected severity %v %q", lr.SeverityNumber, lr.SeverityText)
+	}
+	if lr.Body.GetStringValue() != "boom" {
+		t.Errorf("unexpected body %v", lr.Body)
+	}
+	attrs := attributes(lr.Attributes)
+	if attrs["log.file.path"].GetStringValue() != records[0].Filename || attrs["log.file.offset"].GetIntValue() != 512 || attrs["component"].GetStringValue() != "com.tableau.Main" {
+		t.Errorf("unexpected attributes %v", attrs)
+	}
+	body := req.ResourceLogs[1].ScopeLogs[0].LogRecords[0].Body.GetKvlistValue()
+	if body == nil {
+		t.Fatal("expected JSON message to become a map")
+	}
+	fields := attributes(body.Values)
+	if fields["status"].GetStringValue() != "200" || fields["ms"].GetIntValue() != 42 {
+		t.Errorf("unexpected body %v", fields)
+	}
+}
+
+func newSink(t *testing.T, settings map[string]any) sink.Sink {
+	t.Helper()
+	cfg := viper.New()
+	cfg.Set("retry.initial", time.Millisecond)
+	for k, v := range settings {
+		cfg.Set(k, v)
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestHTTP(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*collogspb.ExportLogsServiceRequest
+	var paths []string
+	statuses := []int{http.StatusServiceUnavailable}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		if len(statuses) > 0 {
+			w.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := &collogspb.ExportLogsServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, req)
+		b, _ := proto.Marshal(&collogspb.ExportLogsServiceResponse{})
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(b)
+	}))
+	defer srv.Close()
+
+	s := newSink(t, map[string]any{"protocol": "http/protobuf", "endpoint": srv.URL})
+	if err := s.Write(context.Background(), records); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(paths) != 2 || paths[1] != "/v1/logs" {
+		t.Errorf("expected a retried export to /v1/logs, got %v", paths)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 export, got %d", len(requests))
+	}
+	checkRequest(t, requests[0])
+}
+
+// fakeCollector is an OTLP/gRPC logs service.
+type fakeCollector struct {
+	collogspb.UnimplementedLogsServiceServer
+	mu       sync.Mutex
+	failures int
+	rejected int64
+	requests []*collogspb.ExportLogsServiceRequest
+	metadata []metadata.MD
+}
+
+func (c *fakeCollector) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	md, _ := metadata.FromIncomingContext(ctx)
+	c.metadata = append(c.metadata, md)
+	if c.failures > 0 {
+		c.failures--
+		return nil, status.Error(codes.Unavailable, "collector is starting")
+	}
+	c.requests = append(c.requests, req)
+	if c.rejected > 0 {
+		return &collogspb.ExportLogsServiceResponse{PartialSuccess: &collogspb.ExportLogsPartialSuccess{
+			RejectedLogRecords: c.rejected,
+			ErrorMessage:       "log record too large",
+		}}, nil
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func TestGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := &fakeCollector{failures: 1}
+	srv := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(srv, collector)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	s := newSink(t, map[string]any{
+		"endpoint":    lis.Addr().String(),
+		"insecure":    true,
+		"compression": "gzip",
+		"headers":     map[string]string{"authorization": "Bearer secret"},
+	})
+	if err := s.Write(context.Background(), records); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(collector.metadata) != 2 {
+		t.Errorf("expected the unavailable export to be retried, got %d attempts", len(collector.metadata))
+	}
+	if got := collector.metadata[0].Get("authorization"); len(got) != 1 || got[0] != "Bearer secret" {
+		t.Errorf("expected authorization metadata, got %v", got)
+	}
+	if len(collector.requests) != 1 {
+		t.Fatalf("expected 1 export, got %d", len(collector.requests))
+	}
+	checkRequest(t, collector.requests[0])
+	if !s.Health().Healthy {
+		t.Error("expected sink to be healthy")
+	}
+}
+
+func TestPartialSuccess(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := &fakeCollector{rejected: 1}
+	srv := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(srv, collector)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	s := newSink(t, map[string]any{"endpoint": lis.Addr().String(), "insecure": true})
+	before := rejectedCounter.Get()
+	err = s.Write(context.Background(), records)
+	var dropped *sink.DroppedError
+	if !errors.As(err, &dropped) || dropped.Records != 1 || !strings.Contains(err.Error(), "log record too large") {
+		t.Fatalf("expected 1 dropped record, got %v", err)
+	}
+	if len(collector.requests) != 1 {
+		t.Errorf("expected the export not to be retried, got %d exports", len(collector.requests))
+	}
+	if got := rejectedCounter.Get() - before; got != 1 {
+		t.Errorf("expected 1 rejected record to be counted, got %d", got)
+	}
+	if !s.Health().Healthy {
+		t.Error("expected sink to stay healthy")
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := map[string]map[string]any{
+		"endpoint is required":          {},
+		"protocol must be known":        {"endpoint": "collector:4317", "protocol": "http/json"},
+		"http endpoint must be a URL":   {"endpoint": "collector:4318", "protocol": "http/protobuf"},
+		"compression must be supported": {"endpoint": "collector:4317", "compression": "zstd"},
+	}
+	for name, settings := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := viper.New()
+			for k, v := range settings {
+				cfg.Set(k, v)
+			}
+			if _, err := New(cfg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Backoff controls how a failed delivery is retried.
+type Backoff struct {
+	Initial    time.Duration // delay before the first retry
+	Max        time.Duration // upper bound on the delay between retries
+	MaxRetries int           // give up after this many retries; 0 means never retry, and less than 0 means retry until ctx is done
+}
+
+// BackoffFrom reads a Backoff from the retry.* keys of a sink's configuration.
+func BackoffFrom(cfg *viper.Viper) Backoff {
+	cfg.SetDefault("retry.initial", 500*time.Millisecond)
+	cfg.SetDefault("retry.max", 30*time.Second)
+	cfg.SetDefault("retry.max_retries", 5)
+	return Backoff{
+		Initial:    cfg.GetDuration("retry.initial"),
+		Max:        cfg.GetDuration("retry.max"),
+		MaxRetries: cfg.GetInt("retry.max_retries"),
+	}
+}
+
+// RetryableError marks an error as transient. After, if set, is how long the destination asked us to wait.
+type RetryableError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryableError) Error() string { return e.Err.Error() }
+func (e *RetryableError) Unwrap() error { return e.Err }
+
+// Retryable marks err as transient, so that Retry tries again.
+func Retryable(err error, after time.Duration) error {
+	return &RetryableError{Err: err, After: after}
+}
+
+// DroppedError reports that a sink wrote a batch but for Records of its records, which the destination
+// rejected outright. The batch counts as written, as sending it again would only duplicate the rest.
+type DroppedError struct {
+	Err     error
+	Records int
+}
+
+func (e *DroppedError) Error() string { return e.Err.Error() }
+func (e *DroppedError) Unwrap() error { return e.Err }
+
+// Dropped reports that n records of a written batch were dropped because of err.
+func Dropped(err error, n int) error {
+	return &DroppedError{Err: err, Records: n}
+}
+
+// Retry calls fn until it succeeds, returns an error that isn't retryable, the retries are exhausted,
+// or ctx is done. Delays grow exponentially with jitter, unless the error asks for a specific delay.
+func (b Backoff) Retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	delay := b.Initial
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		var retryable *RetryableError
+		if err == nil || !errors.As(err, &retryable) {
+			return err
+		}
+		if b.MaxRetries >= 0 && attempt >= b.MaxRetries {
+			return fmt.Errorf("giving up after %d retries: %w", attempt, err)
+		}
+		wait := delay/2 + rand.N(delay/2+1)
+		if retryable.After > 0 {
+			wait = retryable.After
+		}
+		if b.Max > 0 && wait > b.Max {
+			wait = b.Max
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(wait):
+		}
+		delay *= 2
+		if b.Max > 0 && delay > b.Max {
+			delay = b.Max
+		}
+	}
+}
+
+// CheckResponse turns an unsuccessful HTTP response into an error, marking 429 and 5xx responses retryable
+// and honouring their Retry-After header. It does not consume or close the body.
+func CheckResponse(resp *http.Response, body []byte) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err := fmt.Errorf("unexpected status %s: %s", resp.Status, truncate(body, 512))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return Retryable(err, retryAfter(resp.Header.Get("Retry-After")))
+	}
+	return err
+}
+
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+func truncate(b []byte, n int) string {
+	if len(b) <= n {
+		return string(b)
+	}
+	return string(b[:n]) + "..."
+}
@@ -0,0 +1,132 @@
+// Package sink delivers ts-olly's output to its destinations. Sink types register a Factory
+// under a name, and are instantiated from configuration by that name.
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Record is a single log entry on its way to a sink.
+type Record struct {
+	Time         time.Time // when the entry was logged
+	ObservedTime time.Time // when ts-olly read the entry
+	Node         string
+	Filename     string
+	FileID       string
+	Process      string
+	ProcessID    uint8
+	Component    string
+	Line         int
+	Offset       int64
+	Level        string
+	Message      string
+	JSON         []byte // the complete record, encoded as a single JSON object
+	// Ack, if set, is called once every sink has accepted the record.
+	Ack func() `json:"-"`
+}
+
+// Sink is a destination for records. Implementations must be safe for concurrent use.
+type Sink interface {
+	// Open prepares the sink for writing, e.g. by opening files or checking connectivity.
+	Open(ctx context.Context) error
+	// Write delivers a batch of records. It returns once the sink has accepted the whole batch.
+	Write(ctx context.Context, records []Record) error
+	// Flush forces any buffered records out to the destination.
+	Flush(ctx context.Context) error
+	// Close flushes and releases the sink's resources.
+	Close() error
+	// Health reports the sink's current state.
+	Health() Health
+}
+
+// Factory creates a sink from its configuration. cfg is never nil.
+type Factory func(cfg *viper.Viper) (Sink, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a sink type available under the given name. It panics if the name is already taken.
+func Register(typ string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[typ]; ok {
+		panic(fmt.Sprintf("sink type %q registered twice", typ))
+	}
+	registry[typ] = factory
+}
+
+// Types returns the names of all registered sink types.
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	types := make([]string, 0, len(registry))
+	for typ := range registry {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New creates a sink of the given type.
+func New(typ string, cfg *viper.Viper) (Sink, error) {
+	registryMu.RLock()
+	factory, ok := registry[typ]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sink type %q (known types: %v)", typ, Types())
+	}
+	if cfg == nil {
+		cfg = viper.New()
+	}
+	s, err := factory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create %s sink: %w", typ, err)
+	}
+	return s, nil
+}
+
+// Health is the state of a sink.
+type Health struct {
+	Healthy   bool      `json:"healthy"`
+	LastError string    `json:"last_error,omitempty"`
+	LastWrite time.Time `json:"last_write,omitempty"`
+}
+
+// HealthTracker keeps a sink's Health up to date. The zero value is healthy.
+type HealthTracker struct {
+	mu        sync.Mutex
+	lastError error
+	lastWrite time.Time
+}
+
+// Observe records the outcome of a write.
+func (t *HealthTracker) Observe(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastError = err
+	if err == nil {
+		t.lastWrite = time.Now()
+	}
+}
+
+// Health returns the current state.
+func (t *HealthTracker) Health() Health {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := Health{
+		Healthy:   t.lastError == nil,
+		LastWrite: t.lastWrite,
+	}
+	if t.lastError != nil {
+		h.LastError = t.lastError.Error()
+	}
+	return h
+}
@@ -0,0 +1,401 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/spool"
+	"github.com/spf13/viper"
+)
+
+// memorySink collects the batches written to it.
+type memorySink struct {
+	mu      sync.Mutex
+	batches [][]Record
+	err     error
+	health  HealthTracker
+}
+
+func (s *memorySink) Open(context.Context) error { return nil }
+func (s *memorySink) Write(_ context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health.Observe(s.err)
+	if s.err != nil {
+		return s.err
+	}
+	s.batches = append(s.batches, append([]Record(nil), records...))
+	return nil
+}
+func (s *memorySink) Flush(context.Context) error { return nil }
+func (s *memorySink) Close() error                { return nil }
+func (s *memorySink) Health() Health              { return s.health.Health() }
+
+func (s *memorySink) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *memorySink) records() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var records []Record
+	for _, b := range s.batches {
+		records = append(records, b...)
+	}
+	return records
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("built-in sinks are registered", func(t *testing.T) {
+		for _, typ := range []string{"stdout", "stderr"} {
+			if _, err := New(typ, nil); err != nil {
+				t.Errorf("expected %s sink, got error %v", typ, err)
+			}
+		}
+	})
+	t.Run("unknown sink type returns error", func(t *testing.T) {
+		if _, err := New("carrier-pigeon", nil); err == nil {
+			t.Error("expected error for unknown sink type")
+		}
+	})
+	t.Run("registering a type twice panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic")
+			}
+		}()
+		Register("stdout", func(*viper.Viper) (Sink, error) { return nil, nil })
+	})
+}
+
+func TestWriterSink(t *testing.T) {
+	t.Run("writes one line per record", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		s := NewWriterSink(buf)
+		if err := s.Open(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		err := s.Write(context.Background(), []Record{{JSON: []byte(`{"a":1}`)}, {JSON: []byte("{\"b\":2}\n")}})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := "{\"a\":1}\n{\"b\":2}\n"
+		if buf.String() != want {
+			t.Errorf("expected %q, got %q", want, buf.String())
+		}
+		if !s.Health().Healthy {
+			t.Error("expected sink to be healthy")
+		}
+	})
+	t.Run("writing before open returns error", func(t *testing.T) {
+		s := NewWriterSink(&bytes.Buffer{})
+		if err := s.Write(context.Background(), []Record{{JSON: []byte(`{}`)}}); err == nil {
+			t.Error("expected error")
+		}
+	})
+	t.Run("file sink appends to its path", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.json")
+		cfg := viper.New()
+		cfg.Set("path", path)
+		s, err := New("file", cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Open(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Write(context.Background(), []Record{{JSON: []byte(`{"a":1}`)}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		b, _ := os.ReadFile(path)
+		if string(b) != "{\"a\":1}\n" {
+			t.Errorf("expected file to contain the record, got %q", b)
+		}
+	})
+	t.Run("file sink requires a path", func(t *testing.T) {
+		if _, err := New("file", nil); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestLogWriter(t *testing.T) {
+	s := &memorySink{}
+	w := NewLogWriter(s, "node1", "ts-olly")
+	if _, err := w.Write([]byte(`{"level":"warn","component":"server","message":"hello"}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	records := s.records()
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	r := records[0]
+	if r.Level != "warn" || r.Component != "server" || r.Message != "hello" || r.Node != "node1" || r.Process != "ts-olly" {
+		t.Errorf("unexpected record %+v", r)
+	}
+	if string(r.JSON) != `{"level":"warn","component":"server","message":"hello"}` {
+		t.Errorf("expected JSON without trailing newline, got %q", r.JSON)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Run("writes full batches to every sink", func(t *testing.T) {
+		a, b := &memorySink{}, &memorySink{}
+		d := NewDispatcher(map[string]Sink{"a": a, "b": b}, 2, time.Hour, nil)
+		records := make(chan Record)
+		done := make(chan struct{})
+		go func() {
+			d.Run(context.Background(), records)
+			close(done)
+		}()
+		for i := 0; i < 5; i++ {
+			records <- Record{Line: i}
+		}
+		close(records)
+		<-done
+		for name, s := range map[string]*memorySink{"a": a, "b": b} {
+			if got := len(s.records()); got != 5 {
+				t.Errorf("sink %s: expected 5 records, got %d", name, got)
+			}
+			if got := len(s.batches); got != 3 {
+				t.Errorf("sink %s: expected 3 batches, got %d", name, got)
+			}
+		}
+	})
+	t.Run("writes partial batches on the flush interval", func(t *testing.T) {
+		s := &memorySink{}
+		d := NewDispatcher(map[string]Sink{"s": s}, 100, 10*time.Millisecond, nil)
+		records := make(chan Record)
+		go d.Run(context.Background(), records)
+		defer close(records)
+		records <- Record{Line: 1}
+		deadline := time.After(time.Second)
+		for len(s.records()) == 0 {
+			select {
+			case <-deadline:
+				t.Fatal("expected record to be written on the flush interval")
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	})
+	t.Run("reports errors and health per sink", func(t *testing.T) {
+		good, bad := &memorySink{}, &memorySink{err: errors.New("backend down")}
+		var failed []string
+		d := NewDispatcher(map[string]Sink{"good": good, "bad": bad}, 1, time.Hour, func(name string, err error) {
+			failed = append(failed, name)
+		})
+		d.retry = Backoff{}
+		records := make(chan Record, 1)
+		records <- Record{}
+		close(records)
+		d.Run(context.Background(), records)
+		if len(failed) != 1 || failed[0] != "bad" {
+			t.Errorf("expected only the bad sink to fail, got %v", failed)
+		}
+		health := d.Health()
+		if !health["good"].Healthy || health["bad"].Healthy {
+			t.Errorf("unexpected health %+v", health)
+		}
+		if health["bad"].LastError != "backend down" {
+			t.Errorf("expected last error to be reported, got %q", health["bad"].LastError)
+		}
+	})
+	t.Run("retries failing sinks and acknowledges records once every sink has written them", func(t *testing.T) {
+		good, flaky := &memorySink{}, &memorySink{err: Retryable(errors.New("backend down"), 0)}
+		d := NewDispatcher(map[string]Sink{"good": good, "flaky": flaky}, 1, time.Hour, func(name string, err error) {
+			flaky.setErr(nil)
+		})
+		d.retry = Backoff{Initial: time.Millisecond, MaxRetries: -1}
+		acks := 0
+		records := make(chan Record, 1)
+		records <- Record{Ack: func() { acks++ }}
+		close(records)
+		d.Run(context.Background(), records)
+		if len(good.records()) != 1 || len(flaky.records()) != 1 {
+			t.Errorf("expected each sink to write the record once, got %d and %d", len(good.records()), len(flaky.records()))
+		}
+		if acks != 1 {
+			t.Errorf("expected the record to be acknowledged once, got %d", acks)
+		}
+	})
+	t.Run("does not acknowledge records a sink never writes", func(t *testing.T) {
+		bad := &memorySink{err: Retryable(errors.New("backend down"), 0)}
+		d := NewDispatcher(map[string]Sink{"bad": bad}, 1, time.Hour, nil)
+		d.retry = Backoff{Initial: time.Millisecond, MaxRetries: -1}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		acked := false
+		records := make(chan Record, 1)
+		records <- Record{Ack: func() { acked = true }}
+		close(records)
+		d.Run(ctx, records)
+		if acked {
+			t.Error("expected the record not to be acknowledged")
+		}
+	})
+	t.Run("drops and acknowledges batches a sink rejects", func(t *testing.T) {
+		good, rejecting := &memorySink{}, &memorySink{err: errors.New("bad request")}
+		var errs []error
+		d := NewDispatcher(map[string]Sink{"good": good, "rejecting": rejecting}, 1, time.Hour, func(name string, err error) {
+			errs = append(errs, err)
+		})
+		d.retry = Backoff{Initial: time.Millisecond, MaxRetries: -1}
+		acks := 0
+		records := make(chan Record, 2)
+		records <- Record{Ack: func() { acks++ }}
+		records <- Record{Ack: func() { acks++ }}
+		close(records)
+		d.Run(context.Background(), records)
+		if acks != 2 || len(good.records()) != 2 {
+			t.Errorf("expected both records to be written and acknowledged, got %d written and %d acknowledged", len(good.records()), acks)
+		}
+		if len(errs) != 2 {
+			t.Errorf("expected each rejection to be reported once, got %v", errs)
+		}
+	})
+	t.Run("acknowledges batches a sink wrote but for records it dropped", func(t *testing.T) {
+		s := &memorySink{err: Dropped(errors.New("document rejected"), 1)}
+		var errs []error
+		d := NewDispatcher(map[string]Sink{"s": s}, 2, time.Hour, func(name string, err error) {
+			errs = append(errs, err)
+		})
+		d.retry = Backoff{Initial: time.Millisecond, MaxRetries: -1}
+		acks := 0
+		records := make(chan Record, 2)
+		records <- Record{Ack: func() { acks++ }}
+		records <- Record{Ack: func() { acks++ }}
+		close(records)
+		d.Run(context.Background(), records)
+		if acks != 2 || len(errs) != 1 {
+			t.Errorf("expected the batch to be acknowledged and the drop reported once, got %d acknowledged and %v", acks, errs)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond, MaxRetries: 2}
+	t.Run("retries retryable errors until success", func(t *testing.T) {
+		attempts := 0
+		err := b.Retry(context.Background(), func(context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return Retryable(errors.New("busy"), 0)
+			}
+			return nil
+		})
+		if err != nil || attempts != 3 {
+			t.Errorf("expected success after 3 attempts, got %v after %d", err, attempts)
+		}
+	})
+	t.Run("gives up after max retries", func(t *testing.T) {
+		attempts := 0
+		err := b.Retry(context.Background(), func(context.Context) error {
+			attempts++
+			return Retryable(errors.New("busy"), 0)
+		})
+		if err == nil || attempts != 3 {
+			t.Errorf("expected failure after 3 attempts, got %v after %d", err, attempts)
+		}
+	})
+	t.Run("does not retry other errors", func(t *testing.T) {
+		attempts := 0
+		_ = b.Retry(context.Background(), func(context.Context) error {
+			attempts++
+			return errors.New("bad request")
+		})
+		if attempts != 1 {
+			t.Errorf("expected 1 attempt, got %d", attempts)
+		}
+	})
+}
+
+func TestRunSpooled(t *testing.T) {
+	waitFor := func(t *testing.T, s *memorySink, n int) {
+		t.Helper()
+		deadline := time.After(time.Second)
+		for len(s.records()) < n {
+			select {
+			case <-deadline:
+				t.Fatalf("expected %d records, got %d", n, len(s.records()))
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	dir := t.TempDir()
+	sp, err := spool.Open(dir, spool.Options{SegmentBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, bad := &memorySink{}, &memorySink{err: Retryable(errors.New("backend down"), 0)}
+	d := NewDispatcher(map[string]Sink{"good": good, "bad": bad}, 10, time.Millisecond, nil)
+	d.retry = Backoff{Initial: time.Millisecond, Max: time.Millisecond, MaxRetries: -1}
+	var acks atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	records := make(chan Record)
+	done := make(chan struct{})
+	go func() {
+		d.RunSpooled(ctx, records, sp)
+		close(done)
+	}()
+	for i := 0; i < 5; i++ {
+		records <- Record{Line: i, JSON: []byte(`{}`), Ack: func() { acks.Add(1) }}
+	}
+	waitFor(t, good, 5)
+	if len(bad.records()) != 0 {
+		t.Fatal("expected the failing sink to have no records")
+	}
+	if acks.Load() != 0 {
+		t.Error("expected no records to be acknowledged before every sink has written them")
+	}
+	bad.setErr(nil)
+	waitFor(t, bad, 5)
+	if got := bad.records(); got[0].Line != 0 || got[4].Line != 4 {
+		t.Errorf("expected records in order, got %+v", got)
+	}
+	deadline := time.After(time.Second)
+	for acks.Load() != 5 {
+		select {
+		case <-deadline:
+			t.Fatalf("expected 5 records to be acknowledged, got %d", acks.Load())
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	// Records a sink hasn't written by shutdown are replayed on the next run
+	bad.setErr(Retryable(errors.New("backend down again"), 0))
+	records <- Record{Line: 5, JSON: []byte(`{}`)}
+	waitFor(t, good, 6)
+	cancel()
+	close(records)
+	<-done
+	sp.Close()
+
+	sp, err = spool.Open(dir, spool.Options{SegmentBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sp.Close()
+	bad.setErr(nil)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	records = make(chan Record)
+	go d.RunSpooled(ctx, records, sp)
+	defer close(records)
+	waitFor(t, bad, 6)
+	if got := len(good.records()); got != 6 {
+		t.Errorf("expected no records to be replayed to the sink that had written them, got %d", got)
+	}
+}
@@ -0,0 +1,282 @@
+// Package splunk implements a sink that sends records to a Splunk HTTP Event Collector (HEC).
+package splunk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/sink"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	sink.Register("splunk", New)
+}
+
+const (
+	eventPath = "/services/collector/event"
+	ackPath   = "/services/collector/ack"
+)
+
+// Sink sends batches of records to a HEC endpoint. With indexer acknowledgement enabled, Write only returns
+// once Splunk confirms the batch has been indexed.
+type Sink struct {
+	url              string
+	token            string
+	index            string
+	sourcetypePrefix string
+	gzip             bool
+	ack              bool
+	ackTimeout       time.Duration
+	ackPollInterval  time.Duration
+	channel          string
+	client           *http.Client
+	backoff          sink.Backoff
+	health           sink.HealthTracker
+}
+
+// New creates a Splunk HEC sink. The configuration keys are:
+//   - url: the HEC base URL, e.g. https://splunk:8088 (required)
+//   - token: the HEC token (required)
+//   - index: the index to write to (default: the token's default index)
+//   - sourcetype_prefix: prepended to process and component to form the sourcetype (default "tableau")
+//   - gzip: compress request bodies (default false)
+//   - ack: wait for indexer acknowledgement of every batch (default false)
+//   - ack_timeout, ack_poll_interval: how long and how often to poll for acknowledgement (default 60s, 1s)
+//   - channel: the HEC channel used for acknowledgement (default: random)
+//   - insecure_skip_verify: skip TLS certificate verification (default false)
+//   - timeout: per-request timeout (default 10s)
+//   - retry.initial, retry.max, retry.max_retries: backoff on 429 and 5xx responses
+func New(cfg *viper.Viper) (sink.Sink, error) {
+	cfg.SetDefault("sourcetype_prefix", "tableau")
+	cfg.SetDefault("ack_timeout", 60*time.Second)
+	cfg.SetDefault("ack_poll_interval", time.Second)
+	cfg.SetDefault("timeout", 10*time.Second)
+	s := &Sink{
+		url:              strings.TrimSuffix(cfg.GetString("url"), "/"),
+		token:            cfg.GetString("token"),
+		index:            cfg.GetString("index"),
+		sourcetypePrefix: cfg.GetString("sourcetype_prefix"),
+		gzip:             cfg.GetBool("gzip"),
+		ack:              cfg.GetBool("ack"),
+		ackTimeout:       cfg.GetDuration("ack_timeout"),
+		ackPollInterval:  cfg.GetDuration("ack_poll_interval"),
+		channel:          cfg.GetString("channel"),
+		client: &http.Client{
+			Timeout: cfg.GetDuration("timeout"),
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: cfg.GetBool("insecure_skip_verify")},
+			},
+		},
+		backoff: sink.BackoffFrom(cfg),
+	}
+	if s.url == "" {
+		return nil, errors.New("url is required")
+	}
+	if s.token == "" {
+		return nil, errors.New("token is required")
+	}
+	if s.channel == "" {
+		s.channel = newChannel()
+	}
+	return s, nil
+}
+
+func (s *Sink) Open(context.Context) error { return nil }
+
+func (s *Sink) Write(ctx context.Context, records []sink.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	body, err := s.encode(records)
+	if err != nil {
+		s.health.Observe(err)
+		return err
+	}
+	err = s.backoff.Retry(ctx, func(ctx context.Context) error {
+		ackID, err := s.send(ctx, body)
+		if err != nil || !s.ack {
+			return err
+		}
+		return s.waitForAck(ctx, ackID)
+	})
+	s.health.Observe(err)
+	return err
+}
+
+func (s *Sink) Flush(context.Context) error { return nil }
+func (s *Sink) Close() error                { return nil }
+func (s *Sink) Health() sink.Health         { return s.health.Health() }
+
+// event is a single HEC event.
+type event struct {
+	Time       json.Number       `json:"time"`
+	Host       string            `json:"host,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Sourcetype string            `json:"sourcetype"`
+	Index      string            `json:"index,omitempty"`
+	Event      json.RawMessage   `json:"event"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// encode renders records as concatenated HEC events, gzipped if configured.
+func (s *Sink) encode(records []sink.Record) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var w io.Writer = buf
+	var gz *gzip.Writer
+	if s.gzip {
+		gz = gzip.NewWriter(buf)
+		w = gz
+	}
+	enc := json.NewEncoder(w)
+	for i := range records {
+		if err := enc.Encode(s.event(&records[i])); err != nil {
+			return nil, fmt.Errorf("encode event: %w", err)
+		}
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, fmt.Errorf("compress events: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *Sink) event(r *sink.Record) event {
+	t := r.Time
+	if t.IsZero() {
+		t = r.ObservedTime
+	}
+	raw := json.RawMessage(r.JSON)
+	if !json.Valid(raw) {
+		raw, _ = json.Marshal(string(r.JSON))
+	}
+	fields := map[string]string{
+		"process":   r.Process,
+		"processid": strconv.Itoa(int(r.ProcessID)),
+		"component": r.Component,
+		"level":     r.Level,
+		"fileid":    r.FileID,
+	}
+	for k, v := range fields {
+		if v == "" {
+			delete(fields, k)
+		}
+	}
+	return event{
+		Time:       json.Number(strconv.FormatFloat(float64(t.UnixMicro())/1e6, 'f', 6, 64)),
+		Host:       r.Node,
+		Source:     r.Filename,
+		Sourcetype: s.sourcetype(r),
+		Index:      s.index,
+		Event:      raw,
+		Fields:     fields,
+	}
+}
+
+// sourcetype is derived from the record's process and component, e.g. tableau:vizportal:tomcat.
+func (s *Sink) sourcetype(r *sink.Record) string {
+	parts := []string{s.sourcetypePrefix}
+	if r.Process != "" {
+		parts = append(parts, r.Process)
+	}
+	if r.Component != "" {
+		parts = append(parts, r.Component)
+	}
+	return strings.Join(parts, ":")
+}
+
+// response is HEC's reply to an event or ack request.
+type response struct {
+	Text  string          `json:"text"`
+	Code  int             `json:"code"`
+	AckID *int64          `json:"ackId"`
+	Acks  map[string]bool `json:"acks"`
+}
+
+// send posts a batch of events and returns the ack ID HEC assigned to it.
+func (s *Sink) send(ctx context.Context, body []byte) (int64, error) {
+	var resp response
+	if err := s.post(ctx, eventPath, body, s.gzip, &resp); err != nil {
+		return 0, err
+	}
+	if !s.ack {
+		return 0, nil
+	}
+	if resp.AckID == nil {
+		return 0, errors.New("indexer acknowledgement is not enabled for this token")
+	}
+	return *resp.AckID, nil
+}
+
+// waitForAck polls until the batch with the given ack ID is indexed. If it isn't acknowledged in time, the
+// batch is reported as retryable so that it's sent again.
+func (s *Sink) waitForAck(ctx context.Context, ackID int64) error {
+	body, _ := json.Marshal(map[string][]int64{"acks": {ackID}})
+	deadline := time.Now().Add(s.ackTimeout)
+	for {
+		var resp response
+		if err := s.post(ctx, ackPath, body, false, &resp); err != nil {
+			return err
+		}
+		if resp.Acks[strconv.FormatInt(ackID, 10)] {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return sink.Retryable(fmt.Errorf("batch %d not acknowledged within %s", ackID, s.ackTimeout), 0)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.ackPollInterval):
+		}
+	}
+}
+
+func (s *Sink) post(ctx context.Context, path string, body []byte, gzipped bool, v *response) error {
+	url := s.url + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Splunk "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Splunk-Request-Channel", s.channel)
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return sink.Retryable(fmt.Errorf("post to %s: %w", url, err), 0)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err := sink.CheckResponse(resp, respBody); err != nil {
+		return fmt.Errorf("post to %s: %w", url, err)
+	}
+	if err := json.Unmarshal(respBody, v); err != nil {
+		return fmt.Errorf("decode response from %s: %w", url, err)
+	}
+	return nil
+}
+
+// newChannel returns a random UUID to identify this sink's HEC channel.
+func newChannel() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
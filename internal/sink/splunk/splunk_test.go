@@ -0,0 +1,231 @@
+package splunk
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/sink"
+	"github.com/spf13/viper"
+)
+
+// fakeHEC accepts events and acknowledges each batch after the given number of ack polls.
+type fakeHEC struct {
+	mu         sync.Mutex
+	pollsUntil int
+	statuses   []int
+	headers    []http.Header
+	events     []map[string]any
+	nextAckID  int64
+	ackPolls   int
+}
+
+func (f *fakeHEC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.headers = append(f.headers, r.Header.Clone())
+	if r.Header.Get("Authorization") != "Splunk secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"text":"Invalid token","code":4}`)
+		return
+	}
+	switch r.URL.Path {
+	case eventPath:
+		if len(f.statuses) > 0 {
+			status := f.statuses[0]
+			f.statuses = f.statuses[1:]
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{"text":"Server is busy","code":9}`)
+			return
+		}
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		dec := json.NewDecoder(body)
+		for dec.More() {
+			var e map[string]any
+			if err := dec.Decode(&e); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.events = append(f.events, e)
+		}
+		fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, f.nextAckID)
+		f.nextAckID++
+	case ackPath:
+		f.ackPolls++
+		var req struct{ Acks []int64 }
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		acks := make(map[string]bool)
+		for _, id := range req.Acks {
+			acks[fmt.Sprint(id)] = f.ackPolls >= f.pollsUntil
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"acks": acks})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newSink(t *testing.T, url string, settings map[string]any) sink.Sink {
+	t.Helper()
+	cfg := viper.New()
+	cfg.Set("url", url)
+	cfg.Set("token", "secret")
+	cfg.Set("retry.initial", time.Millisecond)
+	cfg.Set("ack_poll_interval", time.Millisecond)
+	for k, v := range settings {
+		cfg.Set(k, v)
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+var records = []sink.Record{
+	{
+		Time:      time.Date(2022, 7, 28, 13, 41, 28, 862e6, time.UTC),
+		Node:      "node1",
+		Filename:  "/logs/vizportal/vizportal_node1-0.log",
+		FileID:    "beef",
+		Process:   "vizportal",
+		ProcessID: 1,
+		Component: "tomcat",
+		Level:     "error",
+		JSON:      []byte(`{"message":"boom"}`),
+	},
+	{
+		Time:    time.Date(2022, 7, 28, 13, 41, 29, 0, time.UTC),
+		Node:    "node1",
+		Process: "httpd",
+		JSON:    []byte(`{"message":"GET /"}`),
+	},
+}
+
+func TestWrite(t *testing.T) {
+	t.Run("maps records to HEC events", func(t *testing.T) {
+		hec := &fakeHEC{}
+		srv := httptest.NewServer(hec)
+		defer srv.Close()
+		s := newSink(t, srv.URL, map[string]any{"index": "tableau", "gzip": true})
+		if err := s.Write(context.Background(), records); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(hec.events) != 2 {
+			t.Fatalf("expected 2 events, got %d", len(hec.events))
+		}
+		e := hec.events[0]
+		if e["time"] != 1659015688.862 {
+			t.Errorf("expected the logged time, got %v", e["time"])
+		}
+		if e["host"] != "node1" || e["source"] != records[0].Filename || e["index"] != "tableau" {
+			t.Errorf("unexpected event metadata %v", e)
+		}
+		if e["sourcetype"] != "tableau:vizportal:tomcat" {
+			t.Errorf("unexpected sourcetype %v", e["sourcetype"])
+		}
+		if event, ok := e["event"].(map[string]any); !ok || event["message"] != "boom" {
+			t.Errorf("expected the record as the event, got %v", e["event"])
+		}
+		fields, _ := e["fields"].(map[string]any)
+		if fields["process"] != "vizportal" || fields["processid"] != "1" || fields["level"] != "error" || fields["fileid"] != "beef" {
+			t.Errorf("unexpected fields %v", fields)
+		}
+		if hec.events[1]["sourcetype"] != "tableau:httpd" {
+			t.Errorf("expected sourcetype without component, got %v", hec.events[1]["sourcetype"])
+		}
+		if _, ok := hec.events[1]["fields"].(map[string]any)["component"]; ok {
+			t.Error("expected empty fields to be left out")
+		}
+	})
+
+	t.Run("waits for indexer acknowledgement", func(t *testing.T) {
+		hec := &fakeHEC{pollsUntil: 3}
+		srv := httptest.NewServer(hec)
+		defer srv.Close()
+		s := newSink(t, srv.URL, map[string]any{"ack": true, "channel": "ts-olly-test"})
+		if err := s.Write(context.Background(), records); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if hec.ackPolls != 3 {
+			t.Errorf("expected 3 ack polls, got %d", hec.ackPolls)
+		}
+		for _, h := range hec.headers {
+			if h.Get("X-Splunk-Request-Channel") != "ts-olly-test" {
+				t.Errorf("expected channel header, got %v", h)
+			}
+		}
+	})
+
+	t.Run("resends batches that aren't acknowledged in time", func(t *testing.T) {
+		hec := &fakeHEC{pollsUntil: 1 << 30}
+		srv := httptest.NewServer(hec)
+		defer srv.Close()
+		s := newSink(t, srv.URL, map[string]any{"ack": true, "ack_timeout": 5 * time.Millisecond, "retry.max_retries": 1})
+		if err := s.Write(context.Background(), records); err == nil {
+			t.Fatal("expected error")
+		}
+		if len(hec.events) != 4 {
+			t.Errorf("expected the batch to be sent twice, got %d events", len(hec.events))
+		}
+		if s.Health().Healthy {
+			t.Error("expected sink to be unhealthy")
+		}
+	})
+
+	t.Run("retries when the server is busy", func(t *testing.T) {
+		hec := &fakeHEC{statuses: []int{http.StatusServiceUnavailable}}
+		srv := httptest.NewServer(hec)
+		defer srv.Close()
+		s := newSink(t, srv.URL, nil)
+		if err := s.Write(context.Background(), records); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(hec.events) != 2 {
+			t.Errorf("expected 2 events, got %d", len(hec.events))
+		}
+	})
+
+	t.Run("does not retry a bad token", func(t *testing.T) {
+		hec := &fakeHEC{}
+		srv := httptest.NewServer(hec)
+		defer srv.Close()
+		s := newSink(t, srv.URL, map[string]any{"token": "wrong"})
+		err := s.Write(context.Background(), records)
+		if err == nil || !strings.Contains(err.Error(), "Invalid token") {
+			t.Fatalf("expected invalid token error, got %v", err)
+		}
+		if len(hec.headers) != 1 {
+			t.Errorf("expected 1 attempt, got %d", len(hec.headers))
+		}
+	})
+}
+
+func TestNew(t *testing.T) {
+	for _, key := range []string{"url", "token"} {
+		t.Run(key+" is required", func(t *testing.T) {
+			cfg := viper.New()
+			cfg.Set("url", "https://splunk:8088")
+			cfg.Set("token", "secret")
+			cfg.Set(key, "")
+			if _, err := New(cfg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
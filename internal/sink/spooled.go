@@ -0,0 +1,164 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/highperformance-tech/ts-olly/internal/spool"
+)
+
+// RunSpooled is like Run, but appends records to sp and gives each sink its own reader of it. A sink that is
+// slow or down falls behind without holding up the pipeline or the other sinks, and its batches are retried
+// until they're written or dropped. Records are acknowledged once every sink has committed them. Whatever a
+// sink hasn't written when RunSpooled returns is replayed from the spool on the next run. Appended records
+// are synced to disk a batch at a time, or as soon as no more records are waiting.
+func (d *Dispatcher) RunSpooled(ctx context.Context, records <-chan Record, sp *spool.Spool) {
+	acks := &spoolAcks{spool: sp}
+	appended := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, name := range d.names {
+		r, err := sp.Reader(name)
+		if err != nil {
+			d.onError(name, err)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.deliver(ctx, name, r, appended, acks)
+		}()
+	}
+	unsynced := 0
+	for r := range records {
+		b, err := json.Marshal(r)
+		var seq int64
+		if err == nil {
+			seq, err = sp.Append(ctx, b)
+		}
+		if err != nil {
+			metrics.GetOrCreateCounter(`tslogs_spool_errors_total`).Inc()
+			d.onError("spool", fmt.Errorf("spool record: %w", err))
+			if ctx.Err() == nil && !errors.Is(err, spool.ErrClosed) && r.Ack != nil {
+				// The record will never be spooled, so don't let it hold up the records after it
+				r.Ack()
+			}
+			continue
+		}
+		acks.add(seq, r.Ack)
+		if unsynced++; unsynced >= d.batchSize || len(records) == 0 {
+			unsynced = 0
+			if err := sp.Sync(); err != nil && !errors.Is(err, spool.ErrClosed) {
+				metrics.GetOrCreateCounter(`tslogs_spool_errors_total`).Inc()
+				d.onError("spool", err)
+			}
+		}
+	}
+	close(appended)
+	wg.Wait()
+}
+
+// spoolAcks holds the acknowledgements of spooled records until every reader has committed them.
+type spoolAcks struct {
+	spool   *spool.Spool
+	mu      sync.Mutex
+	pending []spooledAck // in sequence order
+}
+
+type spooledAck struct {
+	seq int64
+	ack func()
+}
+
+func (a *spoolAcks) add(seq int64, ack func()) {
+	if ack != nil {
+		a.mu.Lock()
+		a.pending = append(a.pending, spooledAck{seq, ack})
+		a.mu.Unlock()
+	}
+	a.release()
+}
+
+// release acknowledges the records that every reader has committed.
+func (a *spoolAcks) release() {
+	committed := a.spool.Committed()
+	a.mu.Lock()
+	n := 0
+	for n < len(a.pending) && a.pending[n].seq < committed {
+		n++
+	}
+	released := a.pending[:n:n]
+	a.pending = a.pending[n:]
+	a.mu.Unlock()
+	for _, p := range released {
+		p.ack()
+	}
+}
+
+// deliver writes the batches read from r to the named sink until ctx is done. It then writes whatever was
+// appended before shutdown, for as long as the shutdown timeout allows, and flushes the sink.
+func (d *Dispatcher) deliver(ctx context.Context, name string, r *spool.Reader, appended <-chan struct{}, acks *spoolAcks) {
+	for {
+		entries, err := r.Read(ctx, d.batchSize, d.flushInterval)
+		if err != nil {
+			break
+		}
+		if !d.deliverBatch(ctx, name, r, entries, acks) {
+			break
+		}
+	}
+	<-appended
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+	for ctx.Err() == nil {
+		entries, err := r.TryRead(d.batchSize)
+		if err != nil || len(entries) == 0 {
+			break
+		}
+		if err := d.writeSink(ctx, name, decodeRecords(entries)); err != nil {
+			break
+		}
+		d.commit(name, r, entries, acks)
+	}
+	if err := d.sinks[name].Flush(ctx); err != nil {
+		d.onError(name, err)
+	}
+}
+
+// deliverBatch writes entries to the named sink, retrying until it succeeds, drops them, or ctx is done, and
+// commits them.
+func (d *Dispatcher) deliverBatch(ctx context.Context, name string, r *spool.Reader, entries []spool.Entry, acks *spoolAcks) bool {
+	batch := decodeRecords(entries)
+	err := d.retry.Retry(ctx, func(ctx context.Context) error {
+		return d.writeSink(ctx, name, batch)
+	})
+	if err != nil {
+		return false
+	}
+	d.commit(name, r, entries, acks)
+	return true
+}
+
+func (d *Dispatcher) commit(name string, r *spool.Reader, entries []spool.Entry, acks *spoolAcks) {
+	if err := r.Commit(entries[len(entries)-1].Next); err != nil {
+		d.onError(name, err)
+		return
+	}
+	acks.release()
+}
+
+func decodeRecords(entries []spool.Entry) []Record {
+	records := make([]Record, 0, len(entries))
+	for _, e := range entries {
+		var r Record
+		if err := json.Unmarshal(e.Data, &r); err != nil {
+			metrics.GetOrCreateCounter(`tslogs_spool_errors_total`).Inc()
+			continue
+		}
+		records = append(records, r)
+	}
+	return records
+}
@@ -0,0 +1,117 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+func init() {
+	Register("stdout", func(*viper.Viper) (Sink, error) {
+		return NewWriterSink(os.Stdout), nil
+	})
+	Register("stderr", func(*viper.Viper) (Sink, error) {
+		return NewWriterSink(os.Stderr), nil
+	})
+	Register("file", newFileSink)
+}
+
+// WriterSink writes each record as a line of JSON to an io.Writer.
+type WriterSink struct {
+	mu     sync.Mutex
+	open   func() (io.Writer, error)
+	w      *bufio.Writer
+	closer io.Closer
+	health HealthTracker
+}
+
+// NewWriterSink returns a sink that writes to w. Closing the sink does not close w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{
+		open: func() (io.Writer, error) { return w, nil },
+	}
+}
+
+// newFileSink returns a sink that appends to the file at the configured path.
+func newFileSink(cfg *viper.Viper) (Sink, error) {
+	path := cfg.GetString("path")
+	if path == "" {
+		return nil, errors.New("path is required")
+	}
+	s := &WriterSink{}
+	s.open = func() (io.Writer, error) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", path, err)
+		}
+		s.closer = f
+		return f, nil
+	}
+	return s, nil
+}
+
+func (s *WriterSink) Open(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w != nil {
+		return nil
+	}
+	w, err := s.open()
+	if err != nil {
+		s.health.Observe(err)
+		return err
+	}
+	s.w = bufio.NewWriter(w)
+	return nil
+}
+
+func (s *WriterSink) Write(_ context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return errors.New("sink is not open")
+	}
+	for _, r := range records {
+		s.w.Write(r.JSON)
+		if len(r.JSON) == 0 || r.JSON[len(r.JSON)-1] != '\n' {
+			s.w.WriteByte('\n')
+		}
+	}
+	err := s.w.Flush()
+	s.health.Observe(err)
+	return err
+}
+
+func (s *WriterSink) Flush(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return nil
+	}
+	return s.w.Flush()
+}
+
+func (s *WriterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return nil
+	}
+	err := s.w.Flush()
+	s.w = nil
+	if s.closer != nil {
+		err = errors.Join(err, s.closer.Close())
+		s.closer = nil
+	}
+	return err
+}
+
+func (s *WriterSink) Health() Health {
+	return s.health.Health()
+}
@@ -0,0 +1,283 @@
+package spool
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Position identifies an entry in the spool.
+type Position struct {
+	Segment int64 `json:"segment"` // the first sequence number of the segment holding the entry
+	Offset  int64 `json:"offset"`  // the entry's byte offset in that segment
+	Seq     int64 `json:"seq"`     // the entry's sequence number
+}
+
+// Entry is an entry read from the spool.
+type Entry struct {
+	Data []byte
+	// Next is the position after the entry. Committing it marks the entry, and every entry before it, as consumed.
+	Next Position
+}
+
+// Reader consumes the spool independently of other readers. Its committed position is persisted in the
+// spool directory under its name.
+type Reader struct {
+	s         *Spool
+	name      string
+	path      string
+	pos       Position // the next entry to read
+	committed Position // the next entry after the last committed one
+}
+
+// Reader returns the reader with the given name, resuming from its last committed position. A reader
+// without one starts at the oldest entry in the spool.
+func (s *Spool) Reader(name string) (*Reader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	if r, ok := s.readers[name]; ok {
+		return r, nil
+	}
+	r := &Reader{s: s, name: name, path: filepath.Join(s.dir, name+cursorExt)}
+	oldest := s.segments[0]
+	r.committed = Position{Segment: oldest.first, Seq: oldest.first}
+	b, err := os.ReadFile(r.path)
+	switch {
+	case err == nil:
+		var p Position
+		if err := json.Unmarshal(b, &p); err != nil {
+			return nil, fmt.Errorf("read spool cursor %s: %w", r.path, err)
+		}
+		r.committed = s.clampLocked(p)
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("read spool cursor %s: %w", r.path, err)
+	}
+	r.pos = r.committed
+	s.readers[name] = r
+	s.metrics.NewGauge(fmt.Sprintf("tslogs_spool_depth{dir=%q, reader=%q}", s.dir, name), func() float64 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return float64(s.next - r.committed.Seq)
+	})
+	return r, nil
+}
+
+// clampLocked moves a position that no longer exists, e.g. because its segment was dropped or truncated, to
+// the nearest entry after it.
+func (s *Spool) clampLocked(p Position) Position {
+	seg, i := s.segmentLocked(p.Segment)
+	switch {
+	case seg == nil && i == len(s.segments):
+		head := s.segments[len(s.segments)-1]
+		return Position{Segment: head.first, Offset: head.size, Seq: s.next}
+	case seg == nil:
+		return Position{Segment: s.segments[i].first, Seq: s.segments[i].first}
+	case p.Offset > seg.size || p.Seq > seg.first+seg.count:
+		return Position{Segment: seg.first, Offset: seg.size, Seq: seg.first + seg.count}
+	}
+	return p
+}
+
+// Depth returns the number of entries the reader hasn't committed.
+func (r *Reader) Depth() int64 {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return r.s.next - r.committed.Seq
+}
+
+// Read returns up to max entries. It waits until at least one entry is available, and then up to linger for
+// more, so that a steady trickle of entries is read in batches.
+func (r *Reader) Read(ctx context.Context, max int, linger time.Duration) ([]Entry, error) {
+	var entries []Entry
+	var lingering <-chan time.Time
+	for {
+		r.s.mu.Lock()
+		closed := r.s.closed
+		appended := r.s.appended
+		r.s.mu.Unlock()
+		if closed {
+			if len(entries) > 0 {
+				return entries, nil
+			}
+			return nil, ErrClosed
+		}
+		batch, err := r.read(max - len(entries))
+		entries = append(entries, batch...)
+		if err != nil || len(entries) >= max || (len(entries) > 0 && linger <= 0) {
+			return entries, err
+		}
+		if len(entries) > 0 && lingering == nil {
+			timer := time.NewTimer(linger)
+			defer timer.Stop()
+			lingering = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			if len(entries) > 0 {
+				return entries, nil
+			}
+			return nil, ctx.Err()
+		case <-lingering:
+			return entries, nil
+		case <-appended:
+		}
+	}
+}
+
+// TryRead returns up to max entries that are available right away.
+func (r *Reader) TryRead(max int) ([]Entry, error) {
+	r.s.mu.Lock()
+	closed := r.s.closed
+	r.s.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	return r.read(max)
+}
+
+// span is the part of a segment a reader has yet to read.
+type span struct {
+	seg  *segment
+	from Position // the reader's position in the segment
+	end  int64    // the size of the segment's complete entries when the span was taken
+}
+
+// read reads up to max entries from the reader's position. Segments are read without holding the spool's
+// lock, so that appends aren't held up meanwhile; entries read from a segment that was dropped in the
+// meantime are discarded.
+func (r *Reader) read(max int) ([]Entry, error) {
+	var entries []Entry
+	for len(entries) < max {
+		r.s.mu.Lock()
+		sp, ok := r.spanLocked()
+		r.s.mu.Unlock()
+		if !ok {
+			break
+		}
+		f, err := os.Open(sp.seg.path)
+		if err != nil {
+			r.s.mu.Lock()
+			moved := r.pos != sp.from
+			r.s.mu.Unlock()
+			if moved {
+				continue
+			}
+			return entries, fmt.Errorf("open spool segment %s: %w", sp.seg.path, err)
+		}
+		batch, next, err := sp.read(f, max-len(entries))
+		f.Close()
+		r.s.mu.Lock()
+		if r.pos != sp.from {
+			// The segment was dropped while it was read, and the reader moved past it
+			r.s.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			// The rest of the segment can't be trusted; skip to the next one
+			next = Position{Segment: sp.seg.first, Offset: sp.seg.size, Seq: sp.seg.first + sp.seg.count}
+			r.s.dropped.Inc()
+		}
+		r.pos = next
+		r.s.mu.Unlock()
+		entries = append(entries, batch...)
+	}
+	return entries, nil
+}
+
+// spanLocked moves the reader past the segments it has read and returns what's left to read of the next one,
+// or false if it has read every entry.
+func (r *Reader) spanLocked() (span, bool) {
+	for r.pos.Seq < r.s.next {
+		seg, i := r.s.segmentLocked(r.pos.Segment)
+		if seg == nil {
+			r.pos = r.s.clampLocked(r.pos)
+			continue
+		}
+		if r.pos.Offset < seg.size {
+			return span{seg: seg, from: r.pos, end: seg.size}, true
+		}
+		if i == len(r.s.segments)-1 {
+			break
+		}
+		next := r.s.segments[i+1]
+		r.pos = Position{Segment: next.first, Seq: next.first}
+	}
+	return span{}, false
+}
+
+// read reads up to max entries of the span from its segment file f, and returns them with the position after
+// the last one. An entry that can't be read is reported along with the entries before it.
+func (sp span) read(f *os.File, max int) ([]Entry, Position, error) {
+	pos := sp.from
+	var entries []Entry
+	header := make([]byte, headerSize)
+	for len(entries) < max && pos.Offset < sp.end {
+		data, err := readEntry(f, pos.Offset, header)
+		if err != nil {
+			return entries, pos, err
+		}
+		pos = Position{Segment: sp.seg.first, Offset: pos.Offset + headerSize + int64(len(data)), Seq: pos.Seq + 1}
+		entries = append(entries, Entry{Data: data, Next: pos})
+	}
+	return entries, pos, nil
+}
+
+func readEntry(f *os.File, offset int64, header []byte) ([]byte, error) {
+	if _, err := f.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	if _, err := f.ReadAt(data, offset+headerSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if crc32.Checksum(data, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return data, nil
+}
+
+// Commit marks every entry before p as consumed, persists the position, and deletes segments that every
+// reader has consumed.
+func (r *Reader) Commit(p Position) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if r.s.closed {
+		return ErrClosed
+	}
+	if p.Seq <= r.committed.Seq {
+		return nil
+	}
+	r.committed = p
+	if err := writeCursor(r.path, p); err != nil {
+		return err
+	}
+	return r.s.trimLocked()
+}
+
+func writeCursor(path string, p Position) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("encode spool cursor: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("write spool cursor %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("rename spool cursor %s: %w", tmp, err)
+	}
+	return nil
+}
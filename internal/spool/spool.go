@@ -0,0 +1,398 @@
+// Package spool is a bounded, on-disk write-ahead queue. Entries are appended to a sequence of segment files,
+// and each named Reader consumes them at its own pace, committing its position so that whatever it hadn't
+// committed is replayed after a restart.
+package spool
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// Policy decides what Append does when the spool is full.
+type Policy int
+
+const (
+	// Block makes Append wait until readers commit enough entries to free space.
+	Block Policy = iota
+	// DropOldest deletes the oldest segment, whether or not every reader has consumed it.
+	DropOldest
+)
+
+// ParsePolicy parses "block" or "drop_oldest".
+func ParsePolicy(s string) (Policy, error) {
+	switch s {
+	case "block":
+		return Block, nil
+	case "drop_oldest":
+		return DropOldest, nil
+	}
+	return Block, fmt.Errorf("unknown spool policy %q (expected block or drop_oldest)", s)
+}
+
+// Options configure a spool.
+type Options struct {
+	SegmentBytes int64  // roll over to a new segment file once the current one reaches this size
+	MaxBytes     int64  // the most the segment files may add up to; 0 means unbounded
+	Policy       Policy // what to do when MaxBytes would be exceeded
+}
+
+// ErrClosed is returned by operations on a closed spool.
+var ErrClosed = errors.New("spool is closed")
+
+const (
+	segmentExt = ".seg"
+	cursorExt  = ".cursor"
+	// Each entry is stored as its length and CRC-32C, both big-endian uint32s, followed by its data.
+	headerSize = 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// segment is a file of consecutive entries.
+type segment struct {
+	first int64 // sequence number of the segment's first entry
+	count int64 // number of entries
+	size  int64 // bytes of complete entries
+	path  string
+}
+
+// Spool is safe for concurrent use by one or more writers and any number of readers.
+type Spool struct {
+	dir  string
+	opts Options
+
+	mu       sync.Mutex
+	segments []*segment // oldest first; the last one is being appended to
+	head     *os.File
+	next     int64 // sequence number of the next entry
+	bytes    int64 // total size of all segments
+	readers  map[string]*Reader
+	appended chan struct{} // closed and replaced whenever entries are appended
+	freed    chan struct{} // closed and replaced whenever segments are deleted
+	unsynced bool          // whether entries were appended to the head segment since it was last synced
+	closed   bool
+
+	metrics *metrics.Set
+	dropped *metrics.Counter
+}
+
+// Open opens the spool in dir, creating it if necessary. Entries left by a previous run are kept, and a
+// partially written entry at the end of a segment, e.g. after a crash, is truncated.
+func Open(dir string, opts Options) (*Spool, error) {
+	if opts.SegmentBytes <= 0 {
+		return nil, errors.New("segment size must be positive")
+	}
+	if opts.MaxBytes > 0 && opts.MaxBytes < 2*opts.SegmentBytes {
+		return nil, fmt.Errorf("max size %d must be at least twice the segment size %d", opts.MaxBytes, opts.SegmentBytes)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create spool directory %s: %w", dir, err)
+	}
+	s := &Spool{
+		dir:      dir,
+		opts:     opts,
+		readers:  make(map[string]*Reader),
+		appended: make(chan struct{}),
+		freed:    make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.metrics = metrics.NewSet()
+	s.metrics.NewGauge(fmt.Sprintf("tslogs_spool_bytes{dir=%q}", dir), func() float64 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return float64(s.bytes)
+	})
+	s.metrics.NewGauge(fmt.Sprintf("tslogs_spool_segments{dir=%q}", dir), func() float64 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return float64(len(s.segments))
+	})
+	s.dropped = s.metrics.NewCounter(fmt.Sprintf("tslogs_spool_dropped_total{dir=%q}", dir))
+	metrics.RegisterSet(s.metrics)
+	return s, nil
+}
+
+// load reads the existing segments and opens the last one for appending.
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("read spool directory %s: %w", s.dir, err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		first, err := strconv.ParseInt(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seg := &segment{first: first, path: filepath.Join(s.dir, name)}
+		if err := seg.scan(); err != nil {
+			return err
+		}
+		s.segments = append(s.segments, seg)
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].first < s.segments[j].first })
+	if len(s.segments) == 0 {
+		return s.newSegmentLocked(0)
+	}
+	for _, seg := range s.segments {
+		s.bytes += seg.size
+	}
+	last := s.segments[len(s.segments)-1]
+	s.next = last.first + last.count
+	f, err := os.OpenFile(last.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open spool segment %s: %w", last.path, err)
+	}
+	s.head = f
+	return nil
+}
+
+// scan counts the segment's complete entries and truncates anything after them.
+func (seg *segment) scan() error {
+	f, err := os.OpenFile(seg.path, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("open spool segment %s: %w", seg.path, err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	header := make([]byte, headerSize)
+	var data []byte
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			break
+		}
+		n := binary.BigEndian.Uint32(header[0:4])
+		if cap(data) < int(n) {
+			data = make([]byte, n)
+		}
+		data = data[:n]
+		if _, err := io.ReadFull(r, data); err != nil {
+			break
+		}
+		if crc32.Checksum(data, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+			break
+		}
+		seg.count++
+		seg.size += headerSize + int64(n)
+	}
+	if err := f.Truncate(seg.size); err != nil {
+		return fmt.Errorf("truncate spool segment %s: %w", seg.path, err)
+	}
+	return nil
+}
+
+func (s *Spool) newSegmentLocked(first int64) error {
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", first, segmentExt))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("create spool segment %s: %w", path, err)
+	}
+	s.head = f
+	s.segments = append(s.segments, &segment{first: first, path: path})
+	return nil
+}
+
+// Append adds an entry to the spool and returns its sequence number. If the spool is full, it blocks or drops
+// the oldest entries, depending on the policy. The entry is only synced to disk by Sync, or when its segment is
+// rolled over or the spool closed, so until then a crash of the system may lose it.
+func (s *Spool) Append(ctx context.Context, data []byte) (int64, error) {
+	entrySize := headerSize + int64(len(data))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if s.closed {
+			return 0, ErrClosed
+		}
+		if s.opts.MaxBytes <= 0 || s.bytes+entrySize <= s.opts.MaxBytes {
+			break
+		}
+		if entrySize > s.opts.MaxBytes/2 {
+			return 0, fmt.Errorf("entry of %d bytes is too large for the spool", len(data))
+		}
+		if s.opts.Policy == DropOldest {
+			if len(s.segments) == 1 {
+				if err := s.rollLocked(); err != nil {
+					return 0, err
+				}
+			}
+			if err := s.dropOldestLocked(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		freed := s.freed
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			return 0, ctx.Err()
+		case <-freed:
+		}
+		s.mu.Lock()
+	}
+
+	buf := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(data, crcTable))
+	copy(buf[headerSize:], data)
+	if _, err := s.head.Write(buf); err != nil {
+		return 0, fmt.Errorf("append to spool: %w", err)
+	}
+	s.unsynced = true
+	seq := s.next
+	head := s.segments[len(s.segments)-1]
+	head.count++
+	head.size += entrySize
+	s.bytes += entrySize
+	s.next++
+	close(s.appended)
+	s.appended = make(chan struct{})
+	if head.size >= s.opts.SegmentBytes {
+		return seq, s.rollLocked()
+	}
+	return seq, nil
+}
+
+// Sync syncs the entries appended since the last sync to disk. Appends aren't held up while it waits for the
+// disk.
+func (s *Spool) Sync() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	head, unsynced := s.head, s.unsynced
+	s.unsynced = false
+	s.mu.Unlock()
+	if !unsynced {
+		return nil
+	}
+	// A head rolled over in the meantime was synced before it was closed
+	if err := head.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+		s.mu.Lock()
+		s.unsynced = true
+		s.mu.Unlock()
+		return fmt.Errorf("sync spool segment: %w", err)
+	}
+	return nil
+}
+
+// rollLocked syncs and closes the current segment and starts a new one.
+func (s *Spool) rollLocked() error {
+	if err := s.head.Sync(); err != nil {
+		return fmt.Errorf("sync spool segment: %w", err)
+	}
+	s.unsynced = false
+	if err := s.head.Close(); err != nil {
+		return fmt.Errorf("close spool segment: %w", err)
+	}
+	return s.newSegmentLocked(s.next)
+}
+
+// dropOldestLocked deletes the oldest segment, moving readers that hadn't consumed all of it past it.
+func (s *Spool) dropOldestLocked() error {
+	oldest, next := s.segments[0], s.segments[1]
+	var lost int64
+	for _, r := range s.readers {
+		if r.committed.Seq < next.first {
+			lost = max(lost, next.first-max(r.committed.Seq, oldest.first))
+			r.committed = Position{Segment: next.first, Seq: next.first}
+		}
+		if r.pos.Seq < next.first {
+			r.pos = Position{Segment: next.first, Seq: next.first}
+		}
+	}
+	s.dropped.Add(int(lost))
+	return s.deleteOldestLocked()
+}
+
+// trimLocked deletes segments that every reader has committed.
+func (s *Spool) trimLocked() error {
+	if len(s.readers) == 0 {
+		return nil
+	}
+	for len(s.segments) > 1 {
+		end := s.segments[0].first + s.segments[0].count
+		for _, r := range s.readers {
+			if r.committed.Seq < end {
+				return nil
+			}
+		}
+		if err := s.deleteOldestLocked(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Spool) deleteOldestLocked() error {
+	oldest := s.segments[0]
+	if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete spool segment %s: %w", oldest.path, err)
+	}
+	s.segments = s.segments[1:]
+	s.bytes -= oldest.size
+	close(s.freed)
+	s.freed = make(chan struct{})
+	return nil
+}
+
+// segmentLocked returns the segment whose first entry has the given sequence number, and its index.
+func (s *Spool) segmentLocked(first int64) (*segment, int) {
+	i := sort.Search(len(s.segments), func(i int) bool { return s.segments[i].first >= first })
+	if i < len(s.segments) && s.segments[i].first == first {
+		return s.segments[i], i
+	}
+	return nil, i
+}
+
+// Committed returns the sequence number of the oldest entry that some reader hasn't committed yet. Every entry
+// before it has been consumed by every reader.
+func (s *Spool) Committed() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	committed := s.next
+	for _, r := range s.readers {
+		committed = min(committed, r.committed.Seq)
+	}
+	return committed
+}
+
+// Bytes returns the total size of the spool's segments.
+func (s *Spool) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+// Close syncs the spool to disk and releases its resources. Blocked calls to Append and Read return ErrClosed.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.appended)
+	close(s.freed)
+	metrics.UnregisterSet(s.metrics, true)
+	return errors.Join(s.head.Sync(), s.head.Close())
+}
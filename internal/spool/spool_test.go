@@ -0,0 +1,249 @@
+package spool
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func mustOpen(t *testing.T, dir string, opts Options) *Spool {
+	t.Helper()
+	s, err := Open(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func appendN(t *testing.T, s *Spool, from, n int) {
+	t.Helper()
+	for i := from; i < from+n; i++ {
+		if _, err := s.Append(context.Background(), []byte(fmt.Sprintf("entry-%03d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readAll(t *testing.T, r *Reader) []Entry {
+	t.Helper()
+	var all []Entry
+	for {
+		entries, err := r.TryRead(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 0 {
+			return all
+		}
+		all = append(all, entries...)
+	}
+}
+
+func data(entries []Entry) []string {
+	var s []string
+	for _, e := range entries {
+		s = append(s, string(e.Data))
+	}
+	return s
+}
+
+func TestSpool(t *testing.T) {
+	t.Run("readers consume entries independently across segments", func(t *testing.T) {
+		s := mustOpen(t, t.TempDir(), Options{SegmentBytes: 40})
+		a, _ := s.Reader("a")
+		b, _ := s.Reader("b")
+		appendN(t, s, 0, 10)
+		got := data(readAll(t, a))
+		if len(got) != 10 || got[0] != "entry-000" || got[9] != "entry-009" {
+			t.Errorf("unexpected entries %v", got)
+		}
+		if got := data(readAll(t, b)); len(got) != 10 {
+			t.Errorf("expected the second reader to see all 10 entries, got %d", len(got))
+		}
+	})
+
+	t.Run("uncommitted entries are replayed after reopening", func(t *testing.T) {
+		dir := t.TempDir()
+		s, err := Open(dir, Options{SegmentBytes: 40})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _ := s.Reader("sink")
+		appendN(t, s, 0, 10)
+		entries := readAll(t, r)
+		if err := r.Commit(entries[3].Next); err != nil {
+			t.Fatal(err)
+		}
+		if r.Depth() != 6 {
+			t.Errorf("expected depth 6, got %d", r.Depth())
+		}
+		if s.Committed() != 4 {
+			t.Errorf("expected entries before 4 to be committed, got %d", s.Committed())
+		}
+		s.Close()
+
+		s = mustOpen(t, dir, Options{SegmentBytes: 40})
+		r, _ = s.Reader("sink")
+		got := data(readAll(t, r))
+		if len(got) != 6 || got[0] != "entry-004" {
+			t.Errorf("expected entries 4-9 to be replayed, got %v", got)
+		}
+		appendN(t, s, 10, 1)
+		if got := data(readAll(t, r)); len(got) != 1 || got[0] != "entry-010" {
+			t.Errorf("expected to keep appending after reopening, got %v", got)
+		}
+	})
+
+	t.Run("committed segments are deleted", func(t *testing.T) {
+		dir := t.TempDir()
+		s := mustOpen(t, dir, Options{SegmentBytes: 40})
+		a, _ := s.Reader("a")
+		b, _ := s.Reader("b")
+		appendN(t, s, 0, 10)
+		before := s.Bytes()
+		entries := readAll(t, a)
+		a.Commit(entries[len(entries)-1].Next)
+		if s.Bytes() != before {
+			t.Error("expected segments to be kept until every reader commits them")
+		}
+		entries = readAll(t, b)
+		b.Commit(entries[len(entries)-1].Next)
+		if s.Bytes() >= before {
+			t.Errorf("expected committed segments to be deleted, still %d bytes", s.Bytes())
+		}
+		segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+		if len(segments) != 1 {
+			t.Errorf("expected only the current segment to remain, got %v", segments)
+		}
+	})
+
+	t.Run("drop oldest policy keeps the spool under its cap", func(t *testing.T) {
+		s := mustOpen(t, t.TempDir(), Options{SegmentBytes: 40, MaxBytes: 80, Policy: DropOldest})
+		r, _ := s.Reader("sink")
+		appendN(t, s, 0, 20)
+		if s.Bytes() > 80 {
+			t.Errorf("expected at most 80 bytes, got %d", s.Bytes())
+		}
+		got := data(readAll(t, r))
+		if len(got) == 0 || got[len(got)-1] != "entry-019" || got[0] == "entry-000" {
+			t.Errorf("expected only the newest entries, got %v", got)
+		}
+	})
+
+	t.Run("block policy waits for readers to free space", func(t *testing.T) {
+		s := mustOpen(t, t.TempDir(), Options{SegmentBytes: 40, MaxBytes: 80, Policy: Block})
+		r, _ := s.Reader("sink")
+		appendN(t, s, 0, 4)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if _, err := s.Append(ctx, []byte("entry-004")); err == nil {
+			t.Fatal("expected append to block until the context is done")
+		}
+		done := make(chan error)
+		go func() {
+			_, err := s.Append(context.Background(), []byte("entry-004"))
+			done <- err
+		}()
+		entries := readAll(t, r)
+		r.Commit(entries[len(entries)-1].Next)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected append to proceed once space was freed")
+		}
+	})
+
+	t.Run("read waits for entries and lingers for more", func(t *testing.T) {
+		s := mustOpen(t, t.TempDir(), Options{SegmentBytes: 1 << 20})
+		r, _ := s.Reader("sink")
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			appendN(t, s, 0, 1)
+			time.Sleep(10 * time.Millisecond)
+			appendN(t, s, 1, 1)
+		}()
+		entries, err := r.Read(context.Background(), 10, time.Second/2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Errorf("expected both entries in one batch, got %d", len(entries))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := r.Read(ctx, 10, 0); err == nil {
+			t.Error("expected read to give up when the context is done")
+		}
+	})
+
+	t.Run("a corrupt entry skips the rest of its segment", func(t *testing.T) {
+		dir := t.TempDir()
+		s := mustOpen(t, dir, Options{SegmentBytes: 40})
+		r, _ := s.Reader("sink")
+		appendN(t, s, 0, 4)
+		segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+		f, _ := os.OpenFile(segments[0], os.O_WRONLY, 0644)
+		f.WriteAt([]byte("x"), headerSize)
+		f.Close()
+		got := data(readAll(t, r))
+		if len(got) != 1 || got[0] != "entry-003" {
+			t.Errorf("expected the entries of the next segment, got %v", got)
+		}
+	})
+
+	t.Run("sync flushes appended entries", func(t *testing.T) {
+		s, err := Open(t.TempDir(), Options{SegmentBytes: 1 << 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendN(t, s, 0, 3)
+		if err := s.Sync(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if err := s.Sync(); err != nil {
+			t.Errorf("expected nothing to sync, got %v", err)
+		}
+		s.Close()
+		if err := s.Sync(); err != ErrClosed {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	})
+
+	t.Run("a torn entry at the end of a segment is truncated", func(t *testing.T) {
+		dir := t.TempDir()
+		s, err := Open(dir, Options{SegmentBytes: 1 << 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendN(t, s, 0, 3)
+		s.Close()
+		segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+		f, _ := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0644)
+		f.Write([]byte{0, 0, 0, 9, 1, 2})
+		f.Close()
+
+		s = mustOpen(t, dir, Options{SegmentBytes: 1 << 20})
+		r, _ := s.Reader("sink")
+		appendN(t, s, 3, 1)
+		got := data(readAll(t, r))
+		if len(got) != 4 || got[3] != "entry-003" {
+			t.Errorf("expected the torn entry to be discarded, got %v", got)
+		}
+	})
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := Open(t.TempDir(), Options{SegmentBytes: 100, MaxBytes: 150}); err == nil {
+		t.Error("expected error when the cap is smaller than two segments")
+	}
+	if _, err := ParsePolicy("drop_newest"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
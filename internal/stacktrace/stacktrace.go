@@ -0,0 +1,178 @@
+// Package stacktrace extracts Java exceptions, with their stack traces and causes, from log messages.
+package stacktrace
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Frame is a stack frame, e.g. at com.tableausoftware.Foo.bar(Foo.java:42).
+type Frame struct {
+	Class  string `json:"class"`
+	Method string `json:"method"`
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+}
+
+// Exception is a Java exception and the chain of exceptions that caused it.
+type Exception struct {
+	Type    string     `json:"type"`
+	Message string     `json:"message,omitempty"`
+	Frames  []Frame    `json:"frames,omitempty"`
+	Omitted int        `json:"omitted,omitempty"` // frames in common with the exception it caused, e.g. ... 12 more
+	Cause   *Exception `json:"cause,omitempty"`
+	Hash    string     `json:"hash,omitempty"` // identifies the types and frames of the whole chain; set on the outermost exception
+}
+
+// typeRe matches the fully-qualified name of a throwable class, e.g. java.lang.IllegalStateException.
+var typeRe = regexp.MustCompile(`^[A-Za-z_$][\w$]*(?:\.[A-Za-z_$][\w$]*)+$`)
+
+// omittedRe matches the line that ends the frames a cause shares with the exception it caused.
+var omittedRe = regexp.MustCompile(`^\s*\.\.\. (\d+) (?:more|common frames omitted)$`)
+
+// Parse finds the first exception in a message: a line naming a throwable, optionally followed by more lines
+// of its message, then the frames of its stack trace, each of its causes and any frames they omit.
+func Parse(message string) (*Exception, bool) {
+	lines := strings.Split(message, "\n")
+	first := -1
+	for i, line := range lines {
+		if _, ok := parseFrame(line); ok {
+			first = i
+			break
+		}
+	}
+	if first < 1 {
+		return nil, false
+	}
+	// The header is the closest line above the first frame that names a throwable.
+	header := -1
+	for i := first - 1; i >= 0; i-- {
+		if _, ok := parseHeader(lines[i]); ok {
+			header = i
+			break
+		}
+	}
+	if header < 0 {
+		return nil, false
+	}
+	root, _ := parseHeader(lines[header])
+	root.Message = joinMessage(root.Message, lines[header+1:first])
+	current := root
+	suppressed := ""
+	for i := first; i < len(lines); i++ {
+		line := lines[i]
+		if suppressed != "" {
+			// Suppressed exceptions are indented under the exception they were added to; skip them.
+			if strings.HasPrefix(line, suppressed) {
+				continue
+			}
+			suppressed = ""
+		}
+		if f, ok := parseFrame(line); ok {
+			current.Frames = append(current.Frames, f)
+			continue
+		}
+		if m := omittedRe.FindStringSubmatch(line); m != nil {
+			current.Omitted, _ = strconv.Atoi(m[1])
+			continue
+		}
+		trimmed := strings.TrimLeft(line, " \t")
+		if rest, ok := strings.CutPrefix(trimmed, "Suppressed: "); ok {
+			if _, ok := parseHeader(rest); ok {
+				suppressed = line[:len(line)-len(trimmed)] + "\t"
+				continue
+			}
+		}
+		if rest, ok := strings.CutPrefix(trimmed, "Caused by: "); ok {
+			if cause, ok := parseHeader(rest); ok {
+				j := i + 1
+				for j < len(lines) {
+					if _, ok := parseFrame(lines[j]); ok {
+						break
+					}
+					j++
+				}
+				cause.Message = joinMessage(cause.Message, lines[i+1:j])
+				current.Cause = cause
+				current = cause
+				i = j - 1
+				continue
+			}
+		}
+		break
+	}
+	root.Hash = hash(root)
+	return root, true
+}
+
+// parseHeader parses a line naming a throwable, e.g. java.io.IOException: Broken pipe.
+func parseHeader(line string) (*Exception, bool) {
+	line = strings.TrimSpace(line)
+	if _, rest, ok := strings.Cut(line, "Exception in thread "); ok && strings.HasPrefix(rest, `"`) {
+		if i := strings.Index(rest[1:], `" `); i >= 0 {
+			line = rest[i+3:]
+		}
+	}
+	name, message, _ := strings.Cut(line, ": ")
+	name = strings.TrimSuffix(name, ":")
+	if !typeRe.MatchString(name) {
+		return nil, false
+	}
+	return &Exception{Type: name, Message: message}, true
+}
+
+// joinMessage appends the continuation lines of a multi-line exception message.
+func joinMessage(message string, more []string) string {
+	for _, line := range more {
+		message += "\n" + line
+	}
+	return message
+}
+
+// parseFrame parses a stack frame, e.g. "\tat java.base/java.lang.Thread.run(Thread.java:829) ~[?:?]".
+func parseFrame(line string) (Frame, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimLeft(line, " \t"), "at ")
+	if !ok {
+		return Frame{}, false
+	}
+	qualified, location, ok := strings.Cut(rest, "(")
+	if !ok {
+		return Frame{}, false
+	}
+	location, _, ok = strings.Cut(location, ")")
+	if !ok {
+		return Frame{}, false
+	}
+	// Drop the class loader and module, e.g. app//, or java.base/.
+	if i := strings.LastIndexByte(qualified, '/'); i >= 0 {
+		qualified = qualified[i+1:]
+	}
+	i := strings.LastIndexByte(qualified, '.')
+	if i <= 0 {
+		return Frame{}, false
+	}
+	f := Frame{Class: qualified[:i], Method: qualified[i+1:]}
+	if file, line, ok := strings.Cut(location, ":"); ok {
+		f.File = file
+		f.Line, _ = strconv.Atoi(line)
+	} else if location != "Native Method" && location != "Unknown Source" {
+		f.File = location
+	}
+	return f, true
+}
+
+// hash identifies an exception chain by its types and the methods of its frames, leaving out messages and
+// line numbers, which differ between otherwise identical failures and between builds.
+func hash(e *Exception) string {
+	h := fnv.New64a()
+	for ; e != nil; e = e.Cause {
+		fmt.Fprintln(h, e.Type)
+		for _, f := range e.Frames {
+			fmt.Fprintln(h, f.Class, f.Method)
+		}
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,112 @@
+package stacktrace
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		description string
+		given       string
+		expected    *Exception
+	}{
+		{"frames with files, modules and jar versions", strings.Join([]string{
+			"Login failed",
+			"java.lang.IllegalStateException: session expired",
+			"\tat com.tableausoftware.tabadmin.webapp.impl.linux.LinuxAuthenticationManager.authenticate(LinuxAuthenticationManager.java:62) ~[tabadmin-webapp.jar:2022.1.4]",
+			"\tat java.base/java.lang.Thread.run(Thread.java:829) [?:?]",
+			"\tat app//org.eclipse.jetty.server.Server.handle(Server.java:516)",
+			"\tat jdk.internal.reflect.NativeMethodAccessorImpl.invoke0(Native Method)",
+			"\tat com.sun.proxy.$Proxy12.find(Unknown Source)",
+		}, "\n"), &Exception{
+			Type:    "java.lang.IllegalStateException",
+			Message: "session expired",
+			Frames: []Frame{
+				{Class: "com.tableausoftware.tabadmin.webapp.impl.linux.LinuxAuthenticationManager", Method: "authenticate", File: "LinuxAuthenticationManager.java", Line: 62},
+				{Class: "java.lang.Thread", Method: "run", File: "Thread.java", Line: 829},
+				{Class: "org.eclipse.jetty.server.Server", Method: "handle", File: "Server.java", Line: 516},
+				{Class: "jdk.internal.reflect.NativeMethodAccessorImpl", Method: "invoke0"},
+				{Class: "com.sun.proxy.$Proxy12", Method: "find"},
+			},
+		}},
+		{"causes with omitted frames", strings.Join([]string{
+			"com.tableausoftware.domain.exceptions.BackgroundJobException: Extract refresh failed",
+			"\tat com.tableausoftware.backgrounder.Job.run(Job.java:10)",
+			"Caused by: java.sql.SQLException: connection refused:",
+			"  host unreachable",
+			"\tat org.postgresql.Driver.connect(Driver.java:20)",
+			"\t... 1 more",
+			"Caused by: java.net.ConnectException",
+			"\tat java.net.Socket.connect(Socket.java:30)",
+			"\t... 2 common frames omitted",
+			"2022-08-03 00:09:31.809 +0000 next entry",
+		}, "\n"), &Exception{
+			Type:    "com.tableausoftware.domain.exceptions.BackgroundJobException",
+			Message: "Extract refresh failed",
+			Frames:  []Frame{{Class: "com.tableausoftware.backgrounder.Job", Method: "run", File: "Job.java", Line: 10}},
+			Cause: &Exception{
+				Type:    "java.sql.SQLException",
+				Message: "connection refused:\n  host unreachable",
+				Frames:  []Frame{{Class: "org.postgresql.Driver", Method: "connect", File: "Driver.java", Line: 20}},
+				Omitted: 1,
+				Cause: &Exception{
+					Type:    "java.net.ConnectException",
+					Frames:  []Frame{{Class: "java.net.Socket", Method: "connect", File: "Socket.java", Line: 30}},
+					Omitted: 2,
+				},
+			},
+		}},
+		{"uncaught exceptions and suppressed exceptions", strings.Join([]string{
+			`Exception in thread "main" java.io.IOException: Broken pipe`,
+			"\tat Main.main(Main.java:5)",
+			"\tSuppressed: java.io.IOException: close failed",
+			"\t\tat Main.close(Main.java:9)",
+			"\t\t... 1 more",
+			"\tat Main.start(Main.java:3)",
+		}, "\n"), &Exception{
+			Type:    "java.io.IOException",
+			Message: "Broken pipe",
+			Frames: []Frame{
+				{Class: "Main", Method: "main", File: "Main.java", Line: 5},
+				{Class: "Main", Method: "start", File: "Main.java", Line: 3},
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			got, ok := Parse(tt.given)
+			if !ok {
+				t.Fatalf("expected an exception in %q", tt.given)
+			}
+			got.Hash = ""
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("given %q, expected %+v, got %+v", tt.given, tt.expected, got)
+			}
+		})
+	}
+	t.Run("messages without a stack trace", func(t *testing.T) {
+		for _, s := range []string{
+			"",
+			"Login request from client 'unspecified' at '192.168.79.158' for user 'tsmadmin'",
+			"java.lang.NullPointerException",
+			"waiting at the gate\n\tat noon (lunch)",
+		} {
+			if e, ok := Parse(s); ok {
+				t.Errorf("expected no exception in %q, got %+v", s, e)
+			}
+		}
+	})
+	t.Run("hashes ignore messages and line numbers", func(t *testing.T) {
+		a, _ := Parse("java.lang.IllegalStateException: job 1\n\tat a.B.c(B.java:1)\nCaused by: java.io.IOException: x\n\tat d.E.f(E.java:2)")
+		b, _ := Parse("java.lang.IllegalStateException: job 2\n\tat a.B.c(B.java:7)\nCaused by: java.io.IOException: y\n\tat d.E.f(E.java:8)")
+		c, _ := Parse("java.lang.IllegalStateException: job 1\n\tat a.B.c(B.java:1)\nCaused by: java.io.IOException: x\n\tat d.E.g(E.java:2)")
+		if a.Hash == "" || a.Hash != b.Hash {
+			t.Errorf("expected equal hashes, got %q and %q", a.Hash, b.Hash)
+		}
+		if a.Hash == c.Hash {
+			t.Errorf("expected different hashes for different frames, got %q", a.Hash)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+// Package startpos decides where tailing of a log file that already exists at startup begins.
+package startpos
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Mode is a start-position policy.
+type Mode int
+
+const (
+	// Checkpoint resumes from the last checkpoint, or from the end of files without one.
+	Checkpoint Mode = iota
+	// End skips everything already written.
+	End
+	// Beginning replays every existing file in full.
+	Beginning
+	// Since replays entries logged at or after a point in time.
+	Since
+)
+
+// Policy is a start-position policy. It implements flag.Value so it can be set from the command line.
+type Policy struct {
+	Mode  Mode
+	Since time.Time
+}
+
+// Parse parses a policy of the form end, beginning, checkpoint or since=<RFC3339>.
+// The boolean values true and false are accepted as beginning and end respectively.
+func Parse(s string) (Policy, error) {
+	switch s {
+	case "checkpoint":
+		return Policy{Mode: Checkpoint}, nil
+	case "end", "false":
+		return Policy{Mode: End}, nil
+	case "beginning", "true":
+		return Policy{Mode: Beginning}, nil
+	}
+	if value, ok := strings.CutPrefix(s, "since="); ok {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return Policy{}, fmt.Errorf("parse since time %q: %w", value, err)
+		}
+		return Policy{Mode: Since, Since: since}, nil
+	}
+	return Policy{}, fmt.Errorf("unknown start position policy %q (want end, beginning, checkpoint or since=<RFC3339>)", s)
+}
+
+func (p *Policy) String() string {
+	switch p.Mode {
+	case End:
+		return "end"
+	case Beginning:
+		return "beginning"
+	case Since:
+		return "since=" + p.Since.Format(time.RFC3339)
+	default:
+		return "checkpoint"
+	}
+}
+
+// Set implements flag.Value.
+func (p *Policy) Set(s string) error {
+	policy, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
+
+// IsBoolFlag lets the policy flag be given without a value, which selects Beginning.
+func (p *Policy) IsBoolFlag() bool {
+	return true
+}
+
+// ErrNoTimestamps is returned by Search when no line in the file carries a timestamp.
+var ErrNoTimestamps = errors.New("no timestamps found")
+
+// Search returns the offset of the first entry in r whose timestamp is at or after since. Lines for
+// which timestamp returns false are treated as continuations of the preceding entry. Timestamps are
+// assumed to be non-decreasing, so the file is binary searched rather than read in full. If every
+// entry is older than since, size is returned.
+func Search(r io.ReaderAt, size int64, since time.Time, timestamp func(line string) (time.Time, bool)) (int64, error) {
+	// after reports whether the first entry starting at or after pos was logged at or after since,
+	// and that entry's offset. It is monotonic in pos, which is what makes the binary search valid.
+	after := func(pos int64) (bool, int64, error) {
+		offset, ts, found, err := nextEntry(r, size, pos, timestamp)
+		if err != nil || !found {
+			return true, size, err
+		}
+		return !ts.Before(since), offset, nil
+	}
+
+	if _, _, found, err := nextEntry(r, size, 0, timestamp); err != nil {
+		return 0, err
+	} else if !found {
+		return 0, ErrNoTimestamps
+	}
+
+	// Find the smallest position whose next entry is recent enough.
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		ok, _, err := after(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	_, offset, err := after(lo)
+	return offset, err
+}
+
+// nextEntry finds the first line starting at or after pos that carries a timestamp.
+func nextEntry(r io.ReaderAt, size, pos int64, timestamp func(line string) (time.Time, bool)) (int64, time.Time, bool, error) {
+	start := pos
+	if pos > 0 {
+		// Start one byte early so a line beginning exactly at pos is recognized by the preceding newline.
+		start = pos - 1
+	}
+	reader := bufio.NewReader(io.NewSectionReader(r, start, size-start))
+	offset := start
+	if pos > 0 {
+		skipped, err := reader.ReadString('\n')
+		offset += int64(len(skipped))
+		if err == io.EOF {
+			return 0, time.Time{}, false, nil
+		}
+		if err != nil {
+			return 0, time.Time{}, false, fmt.Errorf("read line at offset %d: %w", start, err)
+		}
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if ts, ok := timestamp(strings.TrimRight(line, "\r\n")); ok {
+				return offset, ts, true, nil
+			}
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			return 0, time.Time{}, false, nil
+		}
+		if err != nil {
+			return 0, time.Time{}, false, fmt.Errorf("read line at offset %d: %w", offset, err)
+		}
+	}
+}
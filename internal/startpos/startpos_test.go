@@ -0,0 +1,112 @@
+package startpos
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/highperformance-tech/ts-olly/internal/timestamp"
+)
+
+func TestParse(t *testing.T) {
+	since := time.Date(2022, 7, 28, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		given   string
+		want    Policy
+		wantErr bool
+	}{
+		{"checkpoint", Policy{Mode: Checkpoint}, false},
+		{"end", Policy{Mode: End}, false},
+		{"false", Policy{Mode: End}, false},
+		{"beginning", Policy{Mode: Beginning}, false},
+		{"true", Policy{Mode: Beginning}, false},
+		{"since=2022-07-28T12:00:00Z", Policy{Mode: Since, Since: since}, false},
+		{"since=yesterday", Policy{}, true},
+		{"middle", Policy{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.given, func(t *testing.T) {
+			got, err := Parse(tt.given)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.given, err, tt.wantErr)
+			}
+			if got.Mode != tt.want.Mode || !got.Since.Equal(tt.want.Since) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.given, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyFlag(t *testing.T) {
+	t.Run("flag without a value reads from the beginning", func(t *testing.T) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var p Policy
+		fs.Var(&p, "read-existing-logs", "")
+		if err := fs.Parse([]string{"-read-existing-logs"}); err != nil {
+			t.Fatal(err)
+		}
+		if p.Mode != Beginning {
+			t.Errorf("expected beginning, got %s", p.String())
+		}
+	})
+	t.Run("flag with a since value", func(t *testing.T) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var p Policy
+		fs.Var(&p, "read-existing-logs", "")
+		if err := fs.Parse([]string{"-read-existing-logs=since=2022-07-28T12:00:00Z"}); err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != "since=2022-07-28T12:00:00Z" {
+			t.Errorf("expected since=2022-07-28T12:00:00Z, got %s", p.String())
+		}
+	})
+}
+
+func TestSearch(t *testing.T) {
+	// One entry per minute from 12:00 to 12:59, each followed by a stack trace line.
+	var b strings.Builder
+	offsets := make(map[int]int64)
+	for minute := 0; minute < 60; minute++ {
+		offsets[minute] = int64(b.Len())
+		fmt.Fprintf(&b, "2022-07-28 12:%02d:00.000 +0000 main : INFO  com.tableau.Main - entry %d\n", minute, minute)
+		b.WriteString("\tat com.tableau.Main.run(Main.java:1)\n")
+	}
+	content := b.String()
+	r := strings.NewReader(content)
+	size := int64(len(content))
+
+	tests := []struct {
+		name  string
+		since time.Time
+		want  int64
+	}{
+		{"before the first entry", time.Date(2022, 7, 28, 11, 0, 0, 0, time.UTC), 0},
+		{"exactly the first entry", time.Date(2022, 7, 28, 12, 0, 0, 0, time.UTC), 0},
+		{"exactly a middle entry", time.Date(2022, 7, 28, 12, 30, 0, 0, time.UTC), offsets[30]},
+		{"between two entries", time.Date(2022, 7, 28, 12, 30, 30, 0, time.UTC), offsets[31]},
+		{"the last entry", time.Date(2022, 7, 28, 12, 59, 0, 0, time.UTC), offsets[59]},
+		{"after the last entry", time.Date(2022, 7, 28, 13, 0, 0, 0, time.UTC), size},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Search(r, size, tt.since, timestamp.Sniff)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Search() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("file without timestamps", func(t *testing.T) {
+		content := "no timestamp here\nnor here\n"
+		_, err := Search(strings.NewReader(content), int64(len(content)), time.Now(), timestamp.Sniff)
+		if !errors.Is(err, ErrNoTimestamps) {
+			t.Errorf("expected %v, got %v", ErrNoTimestamps, err)
+		}
+	})
+}
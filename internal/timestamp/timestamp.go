@@ -0,0 +1,67 @@
+// Package timestamp recognizes and parses the timestamps found in Tableau Server log lines.
+package timestamp
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// candidate locates a timestamp in a line and describes how to parse it. When the
+// regexp has more than one capture group, the groups are joined by a space before parsing.
+type candidate struct {
+	re     *regexp.Regexp
+	layout string
+}
+
+// candidates are the timestamp shapes written by the processes of a Tableau Server node.
+var candidates = []candidate{
+	// log4j/log4j2 Java processes: 2022-07-28 13:41:28.862 +0000
+	{regexp.MustCompile(`(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3} [+-]\d{4})`), "2006-01-02 15:04:05.000 -0700"},
+	{regexp.MustCompile(`(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3} [+-]\d{4})`), "2006-01-02 15:04:05,000 -0700"},
+	// httpd access logs: 2022-08-02T15:16:44.042 "+0000"
+	{regexp.MustCompile(`(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}) "([+-]\d{4})"`), "2006-01-02T15:04:05.000 -0700"},
+	// native JSON logs: {"ts":"2022-07-28T13:41:28.862", ...}
+	{regexp.MustCompile(`"ts":\s*"(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3})"`), "2006-01-02T15:04:05.000"},
+	// httpd error logs: [Tue Aug 02 15:16:44.042345 2022]
+	{regexp.MustCompile(`^\[(\w{3} \w{3} \d{2} \d{2}:\d{2}:\d{2}\.\d{6} \d{4})\]`), "Mon Jan 02 15:04:05.000000 2006"},
+	// tomcat: 28-Jul-2022 13:41:28.862
+	{regexp.MustCompile(`^(\d{2}-\w{3}-\d{4} \d{2}:\d{2}:\d{2}\.\d{3})`), "02-Jan-2006 15:04:05.000"},
+	// redis: 1234:M 28 Jul 2022 13:41:28.862
+	{regexp.MustCompile(`^\d+:\w (\d{2} \w{3} \d{4} \d{2}:\d{2}:\d{2}\.\d{3})`), "02 Jan 2006 15:04:05.000"},
+	// postgres: 2022-07-28 13:41:28.862 UTC
+	{regexp.MustCompile(`(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3} [A-Z]{3,4})\b`), "2006-01-02 15:04:05.000 MST"},
+	// elasticsearch: [2022-07-28T13:41:28,862]
+	{regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2},\d{3})\]`), "2006-01-02T15:04:05,000"},
+}
+
+// window is how far into a line a timestamp is looked for. Lines start with their timestamp, or follow a few
+// short fields such as a level or an address, while the dates further on are part of the message.
+const window = 128
+
+// Sniff finds and parses the recognizable timestamp nearest the start of line, within its first window bytes,
+// so that a date quoted in a message isn't taken for the line's. Timestamps without a zone are interpreted in
+// the local time zone.
+func Sniff(line string) (time.Time, bool) {
+	if len(line) > window {
+		line = line[:window]
+	}
+	var found time.Time
+	start := -1
+	for _, c := range candidates {
+		m := c.re.FindStringSubmatchIndex(line)
+		if m == nil || (start >= 0 && m[0] >= start) {
+			continue
+		}
+		groups := make([]string, 0, len(m)/2-1)
+		for i := 2; i < len(m); i += 2 {
+			groups = append(groups, line[m[i]:m[i+1]])
+		}
+		t, err := time.ParseInLocation(c.layout, strings.Join(groups, " "), time.Local)
+		if err != nil {
+			continue
+		}
+		found, start = t, m[0]
+	}
+	return found, start >= 0
+}
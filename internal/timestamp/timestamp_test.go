@@ -0,0 +1,56 @@
+package timestamp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSniff(t *testing.T) {
+	utc := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	local := func(s string) time.Time {
+		ts, err := time.ParseInLocation("2006-01-02T15:04:05.999999", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	tests := []struct {
+		name string
+		line string
+		want time.Time
+		ok   bool
+	}{
+		{"log4j", `2022-07-28 13:41:28.862 +0000 (,,,,,,) scheduled-background-job-runner-1 backgrounder: INFO  com.tableausoftware.model.workgroup.service.BackgroundJobService - find next pending job`, utc("2022-07-28T13:41:28.862Z"), true},
+		{"log4j with comma", `2022-07-28 13:41:28,862 -0700 main : INFO  com.tableau.Main - started`, utc("2022-07-28T20:41:28.862Z"), true},
+		{"log4j2 level first", `INFO  2022-07-28 13:41:28.862 +0200 main : com.tableau.Main - started`, utc("2022-07-28T11:41:28.862Z"), true},
+		{"httpd access", `localhost 127.0.0.1 - 2022-08-03T00:00:02.638 "+0000" 8080 "HEAD /favicon.ico HTTP/1.1" "-" 200 - "-" 335 Yum6grxNY7cqNJiackGy6wAAAJs - - - - "-"`, utc("2022-08-03T00:00:02.638Z"), true},
+		{"native json", `{"ts":"2022-07-28T13:41:28.862","pid":1234,"tid":"5678","sev":"info","k":"end-query","v":{}}`, local("2022-07-28T13:41:28.862"), true},
+		{"httpd error", `[Tue Aug 02 15:16:44.042345 2022] [mpm_winnt:notice] [pid 1234:tid 5678] AH00354: Child: Starting 64 worker threads.`, local("2022-08-02T15:16:44.042345"), true},
+		{"tomcat", `28-Jul-2022 13:41:28.862 INFO [main] org.apache.catalina.startup.Catalina.start Server startup`, local("2022-07-28T13:41:28.862"), true},
+		{"redis", `1234:M 28 Jul 2022 13:41:28.862 * Ready to accept connections`, local("2022-07-28T13:41:28.862"), true},
+		{"postgres", `2022-07-28 13:41:28.862 UTC [1234] LOG:  checkpoint starting: time`, utc("2022-07-28T13:41:28.862Z"), true},
+		{"elasticsearch", `[2022-07-28T13:41:28,862][INFO ][o.e.n.Node               ] [node1] started`, local("2022-07-28T13:41:28.862"), true},
+		{"date in the message", `2022-07-28 13:41:28,862 -0700 main : INFO  com.tableau.Main - job queued at 2021-01-01 00:00:00.000 +0000`, utc("2022-07-28T20:41:28.862Z"), true},
+		{"date far into the line", `INFO  com.tableau.Main - ` + strings.Repeat("x", 128) + ` 2022-07-28 13:41:28.862 +0000`, time.Time{}, false},
+		{"continuation line", "\tat com.tableausoftware.Foo.bar(Foo.java:42)", time.Time{}, false},
+		{"empty line", ``, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Sniff(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("Sniff() ok = %v, want %v", ok, tt.ok)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Sniff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}